@@ -0,0 +1,63 @@
+package installation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// PreflightClusterCapacity verifies that the cluster has at least minNodes Ready nodes and that their allocatable
+// CPU and memory add up to at least minCPU and minMemory. Zero thresholds are not checked. All shortfalls are reported.
+func (i *InstallAppStudio) PreflightClusterCapacity(ctx context.Context, minNodes int, minCPU, minMemory resource.Quantity) error {
+	if err := i.checkKubeClient(); err != nil {
+		return err
+	}
+
+	nodes, err := i.kubeClient().CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %+v", err)
+	}
+
+	readyNodes := 0
+	cpu, memory := resource.Quantity{}, resource.Quantity{}
+	for _, node := range nodes.Items {
+		if !nodeReady(&node) {
+			continue
+		}
+		readyNodes++
+		cpu.Add(node.Status.Allocatable[corev1.ResourceCPU])
+		memory.Add(node.Status.Allocatable[corev1.ResourceMemory])
+	}
+	klog.Infof("cluster has %d ready nodes with %s CPU and %s memory allocatable", readyNodes, cpu.String(), memory.String())
+
+	var shortfalls []string
+	if readyNodes < minNodes {
+		shortfalls = append(shortfalls, fmt.Sprintf("%d ready nodes, at least %d required", readyNodes, minNodes))
+	}
+	if !minCPU.IsZero() && cpu.Cmp(minCPU) < 0 {
+		shortfalls = append(shortfalls, fmt.Sprintf("%s allocatable CPU, at least %s required", cpu.String(), minCPU.String()))
+	}
+	if !minMemory.IsZero() && memory.Cmp(minMemory) < 0 {
+		shortfalls = append(shortfalls, fmt.Sprintf("%s allocatable memory, at least %s required", memory.String(), minMemory.String()))
+	}
+	if len(shortfalls) > 0 {
+		return fmt.Errorf("the cluster doesn't have enough capacity: %s", strings.Join(shortfalls, ", "))
+	}
+
+	return nil
+}
+
+// nodeReady reports whether the Ready condition of the node is true
+func nodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package installation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testNode(name string, ready corev1.ConditionStatus, cpu, memory string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(cpu),
+				corev1.ResourceMemory: resource.MustParse(memory),
+			},
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}},
+		},
+	}
+}
+
+func TestPreflightClusterCapacity(t *testing.T) {
+	i := &InstallAppStudio{clientset: fake.NewSimpleClientset(
+		testNode("worker-1", corev1.ConditionTrue, "8", "32Gi"),
+		testNode("worker-2", corev1.ConditionTrue, "7500m", "32Gi"),
+		// Not ready nodes don't count
+		testNode("worker-3", corev1.ConditionFalse, "8", "32Gi"),
+	)}
+
+	assert.NoError(t, i.PreflightClusterCapacity(context.Background(), 2, resource.MustParse("15"), resource.MustParse("64Gi")))
+	assert.NoError(t, i.PreflightClusterCapacity(context.Background(), 0, resource.Quantity{}, resource.Quantity{}))
+}
+
+func TestPreflightClusterCapacityNotEnough(t *testing.T) {
+	i := &InstallAppStudio{clientset: fake.NewSimpleClientset(
+		testNode("worker-1", corev1.ConditionTrue, "8", "32Gi"),
+		testNode("worker-2", corev1.ConditionUnknown, "8", "32Gi"),
+	)}
+
+	err := i.PreflightClusterCapacity(context.Background(), 3, resource.MustParse("16"), resource.MustParse("64Gi"))
+	assert.EqualError(t, err, "the cluster doesn't have enough capacity: 1 ready nodes, at least 3 required, "+
+		"8 allocatable CPU, at least 16 required, 32Gi allocatable memory, at least 64Gi required")
+
+	// Only the configured thresholds are checked
+	assert.NoError(t, i.PreflightClusterCapacity(context.Background(), 1, resource.Quantity{}, resource.MustParse("32Gi")))
+}
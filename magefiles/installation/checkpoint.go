@@ -0,0 +1,111 @@
+package installation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"k8s.io/klog/v2"
+)
+
+// installCheckpoint records the phases completed by an installation of an infra-deployments commit, see checkpointKey
+type installCheckpoint struct {
+	CommitSHA string   `json:"commitSHA"`
+	Phases    []string `json:"phases"`
+}
+
+// readCheckpoint reads the checkpoint file. An empty checkpoint is returned if the file doesn't exist
+func readCheckpoint(path string) (*installCheckpoint, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return &installCheckpoint{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint file %s: %+v", path, err)
+	}
+	checkpoint := &installCheckpoint{}
+	if err := json.Unmarshal(data, checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint file %s: %+v", path, err)
+	}
+	return checkpoint, nil
+}
+
+// writeCheckpoint replaces the checkpoint file, so an interrupted write doesn't leave a corrupted checkpoint behind
+func writeCheckpoint(path string, checkpoint *installCheckpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %+v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write checkpoint file %s: %+v", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write checkpoint file %s: %+v", path, err)
+	}
+	return nil
+}
+
+// loadCheckpoint returns the checkpoint of the previous run. A checkpoint which can't be read is ignored
+func (i *InstallAppStudio) loadCheckpoint() *installCheckpoint {
+	if i.CheckpointFile == "" {
+		return &installCheckpoint{}
+	}
+	checkpoint, err := readCheckpoint(i.CheckpointFile)
+	if err != nil {
+		klog.Warningf("ignoring checkpoint of the previous run: %+v", err)
+		return &installCheckpoint{}
+	}
+	return checkpoint
+}
+
+// checkpointKey returns the commit the checkpoint of the installation is recorded for: the installed commit or, when
+// it's not pinned, the commit of upstream main. The rebase of the clone on upstream main creates a new local commit
+// on every run, so the installed commit of an unpinned installation never matches the previous run
+func (i *InstallAppStudio) checkpointKey() string {
+	result := i.Result()
+	if result.UpstreamCommitSHA != "" {
+		return result.UpstreamCommitSHA
+	}
+	return result.CommitSHA
+}
+
+// checkpointed returns true if the phase was completed by a previous run installing the same commit
+func (i *InstallAppStudio) checkpointed(checkpoint *installCheckpoint, phase string) bool {
+	commitSHA := i.checkpointKey()
+	return commitSHA != "" && checkpoint.CommitSHA == commitSHA && slices.Contains(checkpoint.Phases, phase)
+}
+
+// saveCheckpoint adds the completed phase to the checkpoint file. A checkpoint of another commit is discarded
+func (i *InstallAppStudio) saveCheckpoint(checkpoint *installCheckpoint, phase string) {
+	if i.CheckpointFile == "" {
+		return
+	}
+	if commitSHA := i.checkpointKey(); checkpoint.CommitSHA != commitSHA {
+		if len(checkpoint.Phases) > 0 {
+			klog.Infof("discarding checkpoint of commit %s, installing commit %s", checkpoint.CommitSHA, commitSHA)
+		}
+		*checkpoint = installCheckpoint{CommitSHA: commitSHA}
+	}
+	if slices.Contains(checkpoint.Phases, phase) {
+		// e.g. the clone phase, which runs again when an installation is resumed
+		return
+	}
+	checkpoint.Phases = append(checkpoint.Phases, phase)
+	if err := writeCheckpoint(i.CheckpointFile, checkpoint); err != nil {
+		klog.Warningf("failed to save checkpoint: %+v", err)
+	}
+}
+
+// removeCheckpoint deletes the checkpoint file after a completed installation, so the next one runs all the phases
+func (i *InstallAppStudio) removeCheckpoint() {
+	if i.CheckpointFile == "" {
+		return
+	}
+	if err := os.Remove(i.CheckpointFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		klog.Warningf("failed to remove checkpoint file %s: %+v", i.CheckpointFile, err)
+	}
+}
@@ -0,0 +1,174 @@
+package installation
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCheckpointFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	checkpoint, err := readCheckpoint(path)
+	assert.NoError(t, err)
+	assert.Equal(t, &installCheckpoint{}, checkpoint)
+
+	assert.NoError(t, writeCheckpoint(path, &installCheckpoint{CommitSHA: "3f78685", Phases: []string{PhaseClone, PhaseBootstrap}}))
+	checkpoint, err = readCheckpoint(path)
+	assert.NoError(t, err)
+	assert.Equal(t, &installCheckpoint{CommitSHA: "3f78685", Phases: []string{PhaseClone, PhaseBootstrap}}, checkpoint)
+
+	assert.NoError(t, os.WriteFile(path, []byte("{"), 0600))
+	_, err = readCheckpoint(path)
+	assert.ErrorContains(t, err, "failed to parse checkpoint file")
+}
+
+// checkpointedPhases returns phases recording their runs, the clone phase resolves the given commit
+func checkpointedPhases(i *InstallAppStudio, commitSHA string, runs *[]string, failing string) []installPhase {
+	phase := func(name string) installPhase {
+		return installPhase{name: name, weight: 1, run: func(ctx context.Context) error {
+			*runs = append(*runs, name)
+			if name == PhaseClone {
+				i.mu.Lock()
+				i.result.CommitSHA = commitSHA
+				i.mu.Unlock()
+			}
+			if name == failing {
+				return fmt.Errorf("%s failed", name)
+			}
+			return nil
+		}}
+	}
+	return []installPhase{phase(PhaseClone), phase(PhaseBootstrap), phase(PhaseExtraManifests), phase(PhaseQuaySecret)}
+}
+
+func TestRunPhasesResumesFromCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	i := &InstallAppStudio{CheckpointFile: path}
+
+	var runs []string
+	assert.Error(t, i.runPhases(context.Background(), checkpointedPhases(i, "3f78685", &runs, PhaseExtraManifests)))
+	checkpoint, err := readCheckpoint(path)
+	assert.NoError(t, err)
+	assert.Equal(t, &installCheckpoint{CommitSHA: "3f78685", Phases: []string{PhaseClone, PhaseBootstrap}}, checkpoint)
+
+	// The clone phase runs again, but it's recorded once
+	runs = nil
+	assert.Error(t, i.runPhases(context.Background(), checkpointedPhases(i, "3f78685", &runs, PhaseQuaySecret)))
+	assert.Equal(t, []string{PhaseClone, PhaseExtraManifests, PhaseQuaySecret}, runs)
+	checkpoint, err = readCheckpoint(path)
+	assert.NoError(t, err)
+	assert.Equal(t, &installCheckpoint{CommitSHA: "3f78685", Phases: []string{PhaseClone, PhaseBootstrap, PhaseExtraManifests}}, checkpoint)
+
+	runs = nil
+	assert.NoError(t, i.runPhases(context.Background(), checkpointedPhases(i, "3f78685", &runs, "")))
+	assert.Equal(t, []string{PhaseClone, PhaseQuaySecret}, runs)
+	assert.Equal(t, float64(100), i.Progress())
+	assert.NoFileExists(t, path, "checkpoint is removed after a completed installation")
+}
+
+func TestRunPhasesDiscardsCheckpointOfAnotherCommit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	assert.NoError(t, writeCheckpoint(path, &installCheckpoint{CommitSHA: "3f78685", Phases: []string{PhaseClone, PhaseBootstrap, PhaseExtraManifests}}))
+	i := &InstallAppStudio{CheckpointFile: path}
+
+	var runs []string
+	assert.Error(t, i.runPhases(context.Background(), checkpointedPhases(i, "89e6c98", &runs, PhaseQuaySecret)))
+	assert.Equal(t, []string{PhaseClone, PhaseBootstrap, PhaseExtraManifests, PhaseQuaySecret}, runs)
+	checkpoint, err := readCheckpoint(path)
+	assert.NoError(t, err)
+	assert.Equal(t, &installCheckpoint{CommitSHA: "89e6c98", Phases: []string{PhaseClone, PhaseBootstrap, PhaseExtraManifests}}, checkpoint)
+}
+
+func TestInstallResumedAfterBootstrapExportsInstallationEnvironments(t *testing.T) {
+	isolateInstallationEnvironments(t)
+	sourceDir, source := newFixtureRepo(t)
+	assert.NoError(t, os.MkdirAll(filepath.Join(sourceDir, filepath.Dir(bootstrapScript)), 0755))
+	commitFile(t, source, sourceDir, bootstrapScript, "#!/bin/bash\n")
+	head, err := source.Head()
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	assert.NoError(t, writeCheckpoint(path, &installCheckpoint{CommitSHA: head.Hash().String(), Phases: []string{PhaseClone, PhaseBootstrap}}))
+	runner := &recordingRunner{}
+	i := &InstallAppStudio{
+		InfraDeploymentsCloneDir:         filepath.Join(t.TempDir(), "infra-deployments"),
+		InfraDeploymentsBranch:           "main",
+		InfraDeploymentsOrganizationName: "redhat-appstudio",
+		InfraDeploymentsCommit:           head.Hash().String(),
+		NoFork:                           true,
+		QuayToken:                        base64.StdEncoding.EncodeToString([]byte(testDockerConfig)),
+		SecretSource:                     EnvSecretSource{},
+		CheckpointFile:                   path,
+		CommandRunner:                    runner,
+		clientset:                        fake.NewSimpleClientset(),
+		cloneURL:                         sourceDir,
+	}
+
+	assert.NoError(t, i.InstallAppStudioPreviewMode())
+	assert.Empty(t, runner.commands, "the checkpointed bootstrap is not run again")
+	assert.Equal(t, i.QuayToken, os.Getenv("QUAY_TOKEN"))
+	assert.Equal(t, testDockerConfig, string(getQuaySecret(t, i).Data[corev1.DockerConfigJsonKey]))
+}
+
+// rebasingRunner simulates the rebase of the clone on upstream main by committing on top of the cloned branch, which
+// creates a new local commit on every run. Other commands are recorded
+type rebasingRunner struct {
+	t        *testing.T
+	commands []Command
+}
+
+func (r *rebasingRunner) Run(ctx context.Context, command Command) error {
+	if command.Name != "git" {
+		r.commands = append(r.commands, command)
+		return nil
+	}
+	repo, err := git.PlainOpen(command.Dir)
+	assert.NoError(r.t, err)
+	commitFile(r.t, repo, command.Dir, "fork-change", time.Now().String())
+	return nil
+}
+
+func TestResumeUnpinnedInstallation(t *testing.T) {
+	isolateInstallationEnvironments(t)
+	sourceDir, source := newFixtureRepo(t)
+	assert.NoError(t, os.MkdirAll(filepath.Join(sourceDir, filepath.Dir(bootstrapScript)), 0755))
+	commitFile(t, source, sourceDir, bootstrapScript, "#!/bin/bash\n")
+	upstream, err := source.Head()
+	assert.NoError(t, err)
+
+	runner := &rebasingRunner{t: t}
+	i := &InstallAppStudio{
+		InfraDeploymentsCloneDir:         filepath.Join(t.TempDir(), "infra-deployments"),
+		InfraDeploymentsBranch:           "main",
+		InfraDeploymentsOrganizationName: "redhat-appstudio",
+		NoFork:                           true,
+		SecretSource:                     fakeSecretSource{dockerConfig: []byte(`{"auths":{}}`)},
+		CheckpointFile:                   filepath.Join(t.TempDir(), "checkpoint.json"),
+		BootstrapShell:                   "bash",
+		CommandRunner:                    runner,
+		clientset:                        fake.NewSimpleClientset(),
+		cloneURL:                         sourceDir,
+	}
+
+	assert.ErrorContains(t, i.InstallAppStudioPreviewMode(), "no auths found")
+	assert.Len(t, runner.commands, 1, "the bootstrap is run")
+	firstCommit := i.Result().CommitSHA
+	assert.Equal(t, upstream.Hash().String(), i.Result().UpstreamCommitSHA)
+	assert.NotEqual(t, upstream.Hash().String(), firstCommit)
+
+	i.SecretSource = fakeSecretSource{dockerConfig: []byte(testDockerConfig)}
+	assert.NoError(t, i.InstallAppStudioPreviewMode())
+	assert.Len(t, runner.commands, 1, "the checkpointed bootstrap is not run again")
+	assert.NotEqual(t, firstCommit, i.Result().CommitSHA, "the rebase created a new local commit")
+	assert.NoFileExists(t, i.CheckpointFile)
+}
@@ -0,0 +1,58 @@
+package installation
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// Fields of InstallAppStudio holding credentials, their values are redacted by DiffConfig
+var secretConfigFields = []string{"QuayToken", "DefaultImageQuayOrgOAuth2Token", "GitHubAppPrivateKey"}
+
+// DiffConfig returns the differences of the exported fields of the two configurations, one "Field: value -> other value"
+// line per differing field. Credentials are redacted, and of clients, hooks and channels only whether they are set is compared.
+func (i *InstallAppStudio) DiffConfig(other *InstallAppStudio) []string {
+	if other == nil {
+		other = &InstallAppStudio{}
+	}
+
+	value, otherValue := reflect.ValueOf(i).Elem(), reflect.ValueOf(other).Elem()
+	var diffs []string
+	for index := 0; index < value.NumField(); index++ {
+		field := value.Type().Field(index)
+		if !field.IsExported() {
+			continue
+		}
+		a, b := configFieldValue(value.Field(index)), configFieldValue(otherValue.Field(index))
+		if reflect.DeepEqual(a, b) {
+			continue
+		}
+		if slices.Contains(secretConfigFields, field.Name) {
+			a, b = redactConfigValue(a), redactConfigValue(b)
+		}
+		diffs = append(diffs, fmt.Sprintf("%s: %v -> %v", field.Name, a, b))
+	}
+
+	return diffs
+}
+
+// configFieldValue returns the compared value of a field: "set" or "unset" for clients, hooks and channels
+func configFieldValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Func, reflect.Chan, reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return "unset"
+		}
+		return "set"
+	default:
+		return v.Interface()
+	}
+}
+
+// redactConfigValue hides a non-empty credential
+func redactConfigValue(v interface{}) interface{} {
+	if v == "" {
+		return `""`
+	}
+	return redactedEnvValue
+}
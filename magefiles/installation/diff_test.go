@@ -0,0 +1,36 @@
+package installation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffConfig(t *testing.T) {
+	good := &InstallAppStudio{
+		InfraDeploymentsBranch: "main",
+		Components:             []string{"build-service"},
+		QuayToken:              "good-token",
+		HTTPTimeout:            30 * time.Second,
+		SecretLabels:           map[string]string{"team": "qe"},
+	}
+	failing := &InstallAppStudio{
+		InfraDeploymentsBranch: "feature",
+		Components:             []string{"build-service"},
+		QuayToken:              "other-token",
+		HTTPTimeout:            30 * time.Second,
+		SecretLabels:           map[string]string{"team": "qe"},
+		CommandRunner:          &recordingRunner{},
+	}
+
+	assert.Equal(t, []string{
+		"InfraDeploymentsBranch: feature -> main",
+		"QuayToken: <redacted> -> <redacted>",
+		"CommandRunner: set -> unset",
+	}, failing.DiffConfig(good))
+	assert.Empty(t, good.DiffConfig(good))
+
+	failing.QuayToken = ""
+	assert.Contains(t, failing.DiffConfig(good), `QuayToken: "" -> <redacted>`)
+}
@@ -0,0 +1,54 @@
+package installation
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Reads the free disk space of the filesystem holding a directory. Replaced in unit tests
+var freeDiskSpace = filesystemFreeBytes
+
+// CheckDiskSpace verifies that the filesystem holding TmpDirectory has at least MinFreeDiskBytes of free space.
+// The check is skipped when MinFreeDiskBytes is not positive.
+func (i *InstallAppStudio) CheckDiskSpace() error {
+	if i.MinFreeDiskBytes <= 0 {
+		return nil
+	}
+
+	// TmpDirectory may not be created yet, check the filesystem of its closest existing parent
+	dir, err := filepath.Abs(i.TmpDirectory)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %+v", i.TmpDirectory, err)
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	free, err := freeDiskSpace(dir)
+	if err != nil {
+		return fmt.Errorf("failed to get free disk space of %s: %+v", dir, err)
+	}
+	if free < i.MinFreeDiskBytes {
+		return fmt.Errorf("not enough free disk space in %s: %d MiB available, at least %d MiB required", dir, free>>20, i.MinFreeDiskBytes>>20)
+	}
+
+	return nil
+}
+
+// parseDiskSpace parses the MIN_FREE_DISK_SPACE quantity, e.g. 2Gi, into bytes. Empty disables the check
+func parseDiskSpace(space string) (int64, error) {
+	if space == "" {
+		return 0, nil
+	}
+	quantity, err := resource.ParseQuantity(space)
+	if err != nil {
+		return 0, fmt.Errorf("invalid free disk space %q, expected a quantity, e.g. 2Gi: %+v", space, err)
+	}
+	return quantity.Value(), nil
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package installation
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// filesystemFreeBytes is not implemented outside of unix systems, where MinFreeDiskBytes has to stay disabled
+func filesystemFreeBytes(string) (int64, error) {
+	return 0, fmt.Errorf("checking free disk space is not supported on %s", runtime.GOOS)
+}
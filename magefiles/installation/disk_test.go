@@ -0,0 +1,50 @@
+package installation
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeFreeDiskSpace reports the given free space for all filesystems and records the checked paths
+func fakeFreeDiskSpace(t *testing.T, freeBytes int64) *[]string {
+	var paths []string
+	original := freeDiskSpace
+	freeDiskSpace = func(dir string) (int64, error) {
+		paths = append(paths, dir)
+		return freeBytes, nil
+	}
+	t.Cleanup(func() { freeDiskSpace = original })
+	return &paths
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	tmpDir := t.TempDir()
+	paths := fakeFreeDiskSpace(t, 4<<30)
+
+	i := &InstallAppStudio{TmpDirectory: filepath.Join(tmpDir, "not", "created"), MinFreeDiskBytes: 2 << 30}
+	assert.NoError(t, i.CheckDiskSpace())
+	assert.Equal(t, []string{tmpDir}, *paths)
+
+	i.MinFreeDiskBytes = 8 << 30
+	assert.ErrorContains(t, i.CheckDiskSpace(), "not enough free disk space in "+tmpDir+": 4096 MiB available, at least 8192 MiB required")
+}
+
+func TestCheckDiskSpaceDisabled(t *testing.T) {
+	paths := fakeFreeDiskSpace(t, 0)
+
+	assert.NoError(t, (&InstallAppStudio{TmpDirectory: t.TempDir()}).CheckDiskSpace())
+	assert.Empty(t, *paths)
+}
+
+func TestParseDiskSpace(t *testing.T) {
+	for space, expected := range map[string]int64{"": 0, "2Gi": 2 << 30, "500M": 500_000_000, "1024": 1024} {
+		parsed, err := parseDiskSpace(space)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, parsed, space)
+	}
+
+	_, err := parseDiskSpace("lots")
+	assert.ErrorContains(t, err, `invalid free disk space "lots"`)
+}
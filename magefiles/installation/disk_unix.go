@@ -0,0 +1,15 @@
+//go:build unix
+
+package installation
+
+import "syscall"
+
+// filesystemFreeBytes returns the disk space available to unprivileged users in the filesystem holding dir
+func filesystemFreeBytes(dir string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	// #nosec G115 -- block size and counts are never negative
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
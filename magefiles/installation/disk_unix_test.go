@@ -0,0 +1,18 @@
+//go:build unix
+
+package installation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilesystemFreeBytes(t *testing.T) {
+	free, err := filesystemFreeBytes(t.TempDir())
+	assert.NoError(t, err)
+	assert.Positive(t, free)
+
+	_, err = filesystemFreeBytes("/does/not/exist")
+	assert.Error(t, err)
+}
@@ -0,0 +1,86 @@
+package installation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// Fields of InstallAppStudio holding clients, only whether they are set is persisted
+var clientConfigFields = []string{"KubernetesClient"}
+
+// effectiveConfig is the record written by PersistEffectiveConfig
+type effectiveConfig struct {
+	// Exported fields of InstallAppStudio by name
+	Config map[string]interface{} `json:"config"`
+	Result effectiveResult        `json:"result"`
+}
+
+// effectiveResult is the InstallResult of the persisted record, with the errors of the phases as strings
+type effectiveResult struct {
+	CommitSHA         string            `json:"commitSHA,omitempty"`
+	InstanceSuffix    string            `json:"instanceSuffix,omitempty"`
+	TouchedNamespaces []string          `json:"touchedNamespaces,omitempty"`
+	Environment       map[string]string `json:"environment,omitempty"`
+	Phases            []effectivePhase  `json:"phases,omitempty"`
+}
+
+type effectivePhase struct {
+	Name     string `json:"name"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// PersistEffectiveConfig writes the resolved configuration, after the envs, defaults, profiles and overrides are
+// applied, together with the result of the last installation into the file as JSON, for the record of the run.
+// Credentials are redacted, and of clients, hooks and channels only whether they are set is written.
+func (i *InstallAppStudio) PersistEffectiveConfig(path string) error {
+	record := effectiveConfig{Config: map[string]interface{}{}}
+	value := reflect.ValueOf(i).Elem()
+	for index := 0; index < value.NumField(); index++ {
+		field := value.Type().Field(index)
+		if !field.IsExported() {
+			continue
+		}
+		fieldValue := value.Field(index)
+		v := configFieldValue(fieldValue)
+		switch {
+		case slices.Contains(secretConfigFields, field.Name):
+			v = redactConfigValue(v)
+		case fieldValue.Kind() == reflect.Pointer && !fieldValue.IsNil() && !slices.Contains(clientConfigFields, field.Name):
+			// Pointers to data like the quota specs are persisted with their content
+			v = fieldValue.Interface()
+		case field.Type == reflect.TypeOf(time.Duration(0)):
+			v = fieldValue.Interface().(time.Duration).String()
+		}
+		record.Config[field.Name] = v
+	}
+
+	result := i.Result()
+	record.Result = effectiveResult{
+		CommitSHA:         result.CommitSHA,
+		InstanceSuffix:    result.InstanceSuffix,
+		TouchedNamespaces: result.TouchedNamespaces,
+		Environment:       result.Environment,
+	}
+	for _, phase := range result.Phases {
+		persisted := effectivePhase{Name: phase.Name, Duration: phase.Duration.String()}
+		if phase.Err != nil {
+			persisted.Error = phase.Err.Error()
+		}
+		record.Result.Phases = append(record.Result.Phases, persisted)
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal effective config: %+v", err)
+	}
+	if err := os.WriteFile(filepath.Clean(path), data, 0600); err != nil {
+		return fmt.Errorf("failed to write effective config to %s: %+v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package installation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestPersistEffectiveConfig(t *testing.T) {
+	unsetEnv(t, "ISOLATE_CLONE_DIR")
+	unsetEnv(t, "INSTALLER_LOG_FORMAT")
+	i := &InstallAppStudio{
+		QuayToken:                 "quay-token",
+		GitHubAppPrivateKey:       "",
+		InfraDeploymentsBranch:    "main",
+		CommandRunner:             &recordingRunner{},
+		E2ENamespaceResourceQuota: &corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4")}},
+	}
+	assert.NoError(t, i.ApplyProfile(ProfileCI))
+	// Explicit overrides of the profile
+	i.CloneRetries = 2
+	i.HTTPTimeout = 45 * time.Second
+	assert.Error(t, i.runPhases(context.Background(), []installPhase{
+		noopPhase(PhaseClone, 20),
+		{name: PhaseBootstrap, weight: 70, run: func(ctx context.Context) error { return errors.New("bootstrap failed") }},
+	}))
+
+	path := filepath.Join(t.TempDir(), "effective-config.json")
+	assert.NoError(t, i.PersistEffectiveConfig(path))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "quay-token")
+
+	var record struct {
+		Config map[string]interface{}
+		Result struct {
+			Phases []map[string]string
+		}
+	}
+	assert.NoError(t, json.Unmarshal(data, &record))
+	assert.Equal(t, redactedEnvValue, record.Config["QuayToken"])
+	assert.Equal(t, `""`, record.Config["GitHubAppPrivateKey"])
+	assert.Equal(t, "main", record.Config["InfraDeploymentsBranch"])
+	assert.Equal(t, float64(2), record.Config["CloneRetries"])
+	assert.Equal(t, float64(1), record.Config["CloneDepth"])
+	assert.Equal(t, LogFormatJSON, record.Config["LogFormat"])
+	assert.Equal(t, "45s", record.Config["HTTPTimeout"])
+	assert.Equal(t, "set", record.Config["CommandRunner"])
+	assert.Equal(t, "unset", record.Config["KubernetesClient"])
+	assert.Equal(t, map[string]interface{}{"hard": map[string]interface{}{"cpu": "4"}}, record.Config["E2ENamespaceResourceQuota"])
+
+	assert.Len(t, record.Result.Phases, 2)
+	assert.Equal(t, "bootstrap", record.Result.Phases[1]["name"])
+	assert.Equal(t, "bootstrap failed", record.Result.Phases[1]["error"])
+}
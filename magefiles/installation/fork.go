@@ -0,0 +1,78 @@
+package installation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"k8s.io/klog/v2"
+)
+
+// Branch of the forks checked by verifyForkRelated
+const forkCheckBranch = "main"
+
+// verifyForkRelated checks that the main branch of every fork shares a common ancestor with the checked out
+// commit of the infra-deployments clone, i.e. the fork is a real fork and not an unrelated repository
+func (i *InstallAppStudio) verifyForkRelated(ctx context.Context) error {
+	repo, err := git.PlainOpen(i.InfraDeploymentsCloneDir)
+	if err != nil {
+		return fmt.Errorf("failed to open infra-deployments clone %s: %+v", i.InfraDeploymentsCloneDir, err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("failed to resolve HEAD of %s: %+v", i.InfraDeploymentsCloneDir, err)
+	}
+	headCommit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return fmt.Errorf("failed to read commit %s: %+v", head.Hash(), err)
+	}
+	var auth transport.AuthMethod
+	appAuth, err := i.cloneAuth(ctx)
+	if err != nil {
+		return err
+	}
+	if appAuth != nil {
+		auth = appAuth
+	}
+
+	forkRemotes, names := i.forkRemotes()
+	for _, name := range names {
+		url := forkRemotes[name]
+		// Fetched into a separate namespace, so the refs of the remotes are left alone
+		ref := plumbing.ReferenceName(fmt.Sprintf("refs/fork-check/%s/%s", name, forkCheckBranch))
+		remote := git.NewRemote(repo.Storer, &config.RemoteConfig{Name: name, URLs: []string{url}})
+		err := remote.FetchContext(ctx, &git.FetchOptions{
+			RefSpecs: []config.RefSpec{config.RefSpec(fmt.Sprintf("+refs/heads/%s:%s", forkCheckBranch, ref))},
+			Auth:     auth,
+		})
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return fmt.Errorf("failed to fetch fork %s (%s): %+v", name, url, err)
+		}
+
+		forkRef, err := repo.Reference(ref, true)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s branch of fork %s (%s): %+v", forkCheckBranch, name, url, err)
+		}
+		if err := repo.Storer.RemoveReference(ref); err != nil {
+			klog.Warningf("failed to remove %s: %+v", ref, err)
+		}
+		forkCommit, err := repo.CommitObject(forkRef.Hash())
+		if err != nil {
+			return fmt.Errorf("failed to read commit %s of fork %s: %+v", forkRef.Hash(), name, err)
+		}
+		bases, err := headCommit.MergeBase(forkCommit)
+		if err != nil {
+			return fmt.Errorf("failed to find common ancestor with fork %s: %+v", name, err)
+		}
+		if len(bases) == 0 {
+			return fmt.Errorf("fork %s (%s) has no common history with infra-deployments, it is not a fork of it", name, url)
+		}
+		klog.Infof("fork %s shares history with infra-deployments at commit %s", name, bases[0].Hash)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package installation
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyForkRelated(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "")
+	upstreamDir, upstream := newFixtureRepo(t)
+	cloneDir := filepath.Join(t.TempDir(), "infra-deployments")
+	_, err := git.PlainClone(cloneDir, false, &git.CloneOptions{URL: upstreamDir})
+	assert.NoError(t, err)
+
+	// The fork has commits of its own on top of the upstream history
+	forkDir := filepath.Join(t.TempDir(), "fork")
+	fork, err := git.PlainClone(forkDir, false, &git.CloneOptions{URL: upstreamDir})
+	assert.NoError(t, err)
+	commitFile(t, fork, forkDir, "fork-change", "content")
+	commitFile(t, upstream, upstreamDir, "upstream-change", "content")
+
+	i := &InstallAppStudio{InfraDeploymentsCloneDir: cloneDir, ForkRemotes: map[string]string{"personal": forkDir}}
+	assert.NoError(t, i.verifyForkRelated(context.Background()))
+
+	// The fetched refs are not kept in the clone
+	repo, err := git.PlainOpen(cloneDir)
+	assert.NoError(t, err)
+	_, err = repo.Reference(plumbing.ReferenceName("refs/fork-check/personal/main"), false)
+	assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+}
+
+func TestVerifyForkRelatedRejectsUnrelatedRepository(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "")
+	upstreamDir, _ := newFixtureRepo(t)
+	cloneDir := filepath.Join(t.TempDir(), "infra-deployments")
+	_, err := git.PlainClone(cloneDir, false, &git.CloneOptions{URL: upstreamDir})
+	assert.NoError(t, err)
+
+	unrelatedDir := t.TempDir()
+	unrelated, err := git.PlainInitWithOptions(unrelatedDir, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.NewBranchReferenceName("main")},
+	})
+	assert.NoError(t, err)
+	commitFile(t, unrelated, unrelatedDir, "other-project", "content")
+
+	i := &InstallAppStudio{InfraDeploymentsCloneDir: cloneDir, ForkRemotes: map[string]string{"personal": unrelatedDir}}
+	assert.ErrorContains(t, i.verifyForkRelated(context.Background()), "fork personal ("+unrelatedDir+") has no common history with infra-deployments")
+}
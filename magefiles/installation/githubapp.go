@@ -0,0 +1,173 @@
+package installation
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	plumbingHttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const githubAPIURL = "https://api.github.com"
+
+// Env holding the GitHub token when GitHubTokenEnvVar is not set
+const defaultGitHubTokenEnvVar = "GITHUB_TOKEN"
+
+// githubAppTokenSource mints installation access tokens of a GitHub App, used e.g. for cloning private forks.
+// Tokens are cached and a fresh one is minted shortly before the cached one expires.
+type githubAppTokenSource struct {
+	appID      string
+	privateKey *rsa.PrivateKey
+	// Repository (owner/name) the app is installed for
+	repository string
+	apiURL     string
+	client     *http.Client
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// newGitHubAppTokenSource creates a token source from the app id and the (optionally base64-encoded) PEM private key.
+// The GitHub API is called with the given client
+func newGitHubAppTokenSource(appID, privateKey, repository string, client *http.Client) (*githubAppTokenSource, error) {
+	if appID == "" || privateKey == "" {
+		return nil, fmt.Errorf("GitHub App id and private key are required for GitHub App authentication")
+	}
+	pem := []byte(privateKey)
+	if decoded, err := base64.StdEncoding.DecodeString(privateKey); err == nil {
+		pem = decoded
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: %+v", err)
+	}
+
+	return &githubAppTokenSource{
+		appID:      appID,
+		privateKey: key,
+		repository: repository,
+		apiURL:     githubAPIURL,
+		client:     client,
+	}, nil
+}
+
+// Token returns a valid installation access token
+func (s *githubAppTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Now().Add(time.Minute).Before(s.expiresAt) {
+		return s.token, nil
+	}
+
+	appJWT, err := s.appJWT(time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	installation := struct {
+		ID int64 `json:"id"`
+	}{}
+	if err := s.githubRequest(ctx, http.MethodGet, fmt.Sprintf("%s/repos/%s/installation", s.apiURL, s.repository), appJWT, &installation); err != nil {
+		return "", fmt.Errorf("failed to find installation of GitHub App %s for %s: %+v", s.appID, s.repository, err)
+	}
+
+	accessToken := struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{}
+	if err := s.githubRequest(ctx, http.MethodPost, fmt.Sprintf("%s/app/installations/%s/access_tokens", s.apiURL, strconv.FormatInt(installation.ID, 10)), appJWT, &accessToken); err != nil {
+		return "", fmt.Errorf("failed to create installation access token of GitHub App %s: %+v", s.appID, err)
+	}
+	s.token, s.expiresAt = accessToken.Token, accessToken.ExpiresAt
+
+	return s.token, nil
+}
+
+// appJWT creates the JWT authenticating as the GitHub App, as described in
+// https://docs.github.com/en/apps/creating-github-apps/authenticating-with-a-github-app/generating-a-json-web-token-jwt-for-a-github-app
+func (s *githubAppTokenSource) appJWT(now time.Time) (string, error) {
+	claims := jwt.RegisteredClaims{
+		// Issued in the past to allow for clock drift
+		IssuedAt:  jwt.NewNumericDate(now.Add(-time.Minute)),
+		ExpiresAt: jwt.NewNumericDate(now.Add(9 * time.Minute)),
+		Issuer:    s.appID,
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(s.privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GitHub App JWT: %+v", err)
+	}
+	return signed, nil
+}
+
+func (s *githubAppTokenSource) githubRequest(ctx context.Context, method, url, appJWT string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+appJWT)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// cloneAuth returns the credentials for cloning infra-deployments: an installation token when GitHub App
+// authentication is enabled, or the GitHub token from the environment. Nil is returned when there are none
+func (i *InstallAppStudio) cloneAuth(ctx context.Context) (*plumbingHttp.BasicAuth, error) {
+	if !i.UseGitHubAppAuth {
+		if token := i.githubToken(); token != "" {
+			return &plumbingHttp.BasicAuth{Username: "x-access-token", Password: token}, nil
+		}
+		return nil, nil
+	}
+
+	if i.githubAppTokens == nil {
+		tokens, err := newGitHubAppTokenSource(i.GitHubAppID, i.GitHubAppPrivateKey, fmt.Sprintf("%s/infra-deployments", i.InfraDeploymentsOrganizationName), i.httpClient())
+		if err != nil {
+			return nil, err
+		}
+		i.githubAppTokens = tokens
+	}
+	token, err := i.githubAppTokens.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &plumbingHttp.BasicAuth{Username: "x-access-token", Password: token}, nil
+}
+
+// httpClient returns the client used for the GitHub API and quay registry requests, timing out after HTTPTimeout
+func (i *InstallAppStudio) httpClient() *http.Client {
+	timeout := i.HTTPTimeout
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+	return &http.Client{Timeout: timeout}
+}
+
+// githubToken returns the GitHub token from the GitHubTokenEnvVar env, GITHUB_TOKEN by default
+func (i *InstallAppStudio) githubToken() string {
+	envVar := i.GitHubTokenEnvVar
+	if envVar == "" {
+		envVar = defaultGitHubTokenEnvVar
+	}
+	return os.Getenv(envVar)
+}
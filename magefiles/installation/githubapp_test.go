@@ -0,0 +1,147 @@
+package installation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFakeGitHubAPI(t *testing.T, key *rsa.PrivateKey, expiresIn time.Duration) (*httptest.Server, *int) {
+	minted := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := jwt.ParseWithClaims(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
+			assert.Equal(t, jwt.SigningMethodRS256, token.Method)
+			return &key.PublicKey, nil
+		})
+		if !assert.NoError(t, err) || !assert.Equal(t, "12345", token.Claims.(*jwt.RegisteredClaims).Issuer) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/my-org/infra-deployments/installation":
+			_, _ = w.Write([]byte(`{"id":42}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/app/installations/42/access_tokens":
+			minted++
+			_, _ = fmt.Fprintf(w, `{"token":"token-%d","expires_at":"%s"}`, minted, time.Now().Add(expiresIn).Format(time.RFC3339))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &minted
+}
+
+func newTestGitHubAppKey(t *testing.T) (*rsa.PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return key, base64.StdEncoding.EncodeToString(keyPEM)
+}
+
+func TestGitHubAppTokenSource(t *testing.T) {
+	key, encodedKey := newTestGitHubAppKey(t)
+	server, minted := newFakeGitHubAPI(t, key, time.Hour)
+
+	tokens, err := newGitHubAppTokenSource("12345", encodedKey, "my-org/infra-deployments", http.DefaultClient)
+	assert.NoError(t, err)
+	tokens.apiURL = server.URL
+
+	token, err := tokens.Token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", token)
+
+	// The cached token is still valid
+	token, err = tokens.Token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", token)
+	assert.Equal(t, 1, *minted)
+}
+
+func TestGitHubAppTokenSourceMintsFreshTokenWhenExpiring(t *testing.T) {
+	key, encodedKey := newTestGitHubAppKey(t)
+	server, minted := newFakeGitHubAPI(t, key, 30*time.Second)
+
+	i := &InstallAppStudio{UseGitHubAppAuth: true, GitHubAppID: "12345", GitHubAppPrivateKey: encodedKey, InfraDeploymentsOrganizationName: "my-org"}
+	tokens, err := newGitHubAppTokenSource(i.GitHubAppID, i.GitHubAppPrivateKey, "my-org/infra-deployments", i.httpClient())
+	assert.NoError(t, err)
+	tokens.apiURL = server.URL
+	i.githubAppTokens = tokens
+
+	auth, err := i.cloneAuth(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "x-access-token", auth.Username)
+	assert.Equal(t, "token-1", auth.Password)
+
+	auth, err = i.cloneAuth(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "token-2", auth.Password)
+	assert.Equal(t, 2, *minted)
+}
+
+func TestGitHubAppTokenSourceRequiresCredentials(t *testing.T) {
+	_, err := newGitHubAppTokenSource("", "", "my-org/infra-deployments", http.DefaultClient)
+	assert.ErrorContains(t, err, "GitHub App id and private key are required")
+
+	_, err = newGitHubAppTokenSource("12345", "not a key", "my-org/infra-deployments", http.DefaultClient)
+	assert.ErrorContains(t, err, "failed to parse GitHub App private key")
+}
+
+func TestCloneAuthWithGitHubToken(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "default-token")
+	t.Setenv("CI_GITHUB_TOKEN", "ci-token")
+
+	auth, err := (&InstallAppStudio{}).cloneAuth(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "default-token", auth.Password)
+
+	i := &InstallAppStudio{GitHubTokenEnvVar: "CI_GITHUB_TOKEN"}
+	auth, err = i.cloneAuth(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "x-access-token", auth.Username)
+	assert.Equal(t, "ci-token", auth.Password)
+
+	isolateInstallationEnvironments(t)
+	i.setInstallationEnvironments()
+	assert.Equal(t, "ci-token", os.Getenv("MY_GITHUB_TOKEN"))
+
+	t.Setenv("CI_GITHUB_TOKEN", "")
+	auth, err = i.cloneAuth(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, auth)
+}
+
+func TestGitHubAppTokenSourceHTTPTimeout(t *testing.T) {
+	_, encodedKey := newTestGitHubAppKey(t)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	i := &InstallAppStudio{UseGitHubAppAuth: true, GitHubAppID: "12345", GitHubAppPrivateKey: encodedKey, InfraDeploymentsOrganizationName: "my-org", HTTPTimeout: 50 * time.Millisecond}
+	tokens, err := newGitHubAppTokenSource(i.GitHubAppID, i.GitHubAppPrivateKey, "my-org/infra-deployments", i.httpClient())
+	assert.NoError(t, err)
+	tokens.apiURL = server.URL
+	i.githubAppTokens = tokens
+
+	_, err = i.cloneAuth(context.Background())
+	assert.ErrorContains(t, err, "Client.Timeout exceeded")
+}
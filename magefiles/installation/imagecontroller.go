@@ -0,0 +1,54 @@
+package installation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// Secret of image-controller with the quay token and organization, created by the bootstrap from
+	// IMAGE_CONTROLLER_QUAY_TOKEN and IMAGE_CONTROLLER_QUAY_ORG
+	imageControllerQuaySecret = "quaytoken"
+	imageControllerQuayOrgKey = "organization"
+)
+
+// Names of quay.io organizations
+var quayOrgNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{1,254}$`)
+
+// SetImageControllerQuayOrg changes the quay organization image-controller creates repositories in
+// and restarts image-controller, so the change is applied without a reinstallation
+func (i *InstallAppStudio) SetImageControllerQuayOrg(ctx context.Context, org string) error {
+	if !quayOrgNameRegexp.MatchString(org) {
+		return fmt.Errorf("invalid quay organization %q: must consist of lower case alphanumeric characters, '.', '_' or '-' and be 2 to 255 characters long", org)
+	}
+	if err := i.checkKubeClient(); err != nil {
+		return err
+	}
+
+	namespace := i.imageControllerNamespace()
+	secret, err := i.kubeClient().CoreV1().Secrets(namespace).Get(ctx, imageControllerQuaySecret, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get secret %s/%s: %+v", namespace, imageControllerQuaySecret, err)
+	}
+	if string(secret.Data[imageControllerQuayOrgKey]) == org {
+		klog.Infof("image-controller already uses quay organization %s", org)
+		i.DefaultImageQuayOrg = org
+		return nil
+	}
+
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[imageControllerQuayOrgKey] = []byte(org)
+	if _, err := i.kubeClient().CoreV1().Secrets(namespace).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update secret %s/%s: %+v", namespace, imageControllerQuaySecret, err)
+	}
+	i.DefaultImageQuayOrg = org
+	klog.Infof("set quay organization of image-controller to %s", org)
+
+	return i.restartDeployment(ctx, namespace, imageControllerDeployment)
+}
@@ -0,0 +1,59 @@
+package installation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func imageControllerObjects() (*corev1.Secret, *appsv1.Deployment) {
+	return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: imageControllerQuaySecret, Namespace: "image-controller"},
+			Data:       map[string][]byte{"quaytoken": []byte("token"), imageControllerQuayOrgKey: []byte("redhat-appstudio-qe")},
+		},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: imageControllerDeployment, Namespace: "image-controller"}}
+}
+
+func TestSetImageControllerQuayOrg(t *testing.T) {
+	clientset := fake.NewSimpleClientset(imageControllerObjects())
+	i := &InstallAppStudio{clientset: clientset}
+
+	assert.NoError(t, i.SetImageControllerQuayOrg(context.Background(), "my-org"))
+	assert.Equal(t, "my-org", i.DefaultImageQuayOrg)
+
+	secret, err := clientset.CoreV1().Secrets("image-controller").Get(context.Background(), imageControllerQuaySecret, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"quaytoken": []byte("token"), imageControllerQuayOrgKey: []byte("my-org")}, secret.Data)
+
+	deployment, err := clientset.AppsV1().Deployments("image-controller").Get(context.Background(), imageControllerDeployment, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, deployment.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"])
+}
+
+func TestSetImageControllerQuayOrgUnchanged(t *testing.T) {
+	clientset := fake.NewSimpleClientset(imageControllerObjects())
+	i := &InstallAppStudio{clientset: clientset}
+
+	assert.NoError(t, i.SetImageControllerQuayOrg(context.Background(), "redhat-appstudio-qe"))
+	for _, action := range clientset.Actions() {
+		assert.Equal(t, "get", action.GetVerb())
+	}
+}
+
+func TestSetImageControllerQuayOrgValidation(t *testing.T) {
+	clientset := fake.NewSimpleClientset(imageControllerObjects())
+	i := &InstallAppStudio{clientset: clientset}
+
+	for _, org := range []string{"", "a", "My-Org", "-org", "org/name"} {
+		assert.ErrorContains(t, i.SetImageControllerQuayOrg(context.Background(), org), "invalid quay organization", org)
+	}
+	assert.Empty(t, clientset.Actions())
+
+	i.ImageControllerNamespace = "other"
+	assert.ErrorContains(t, i.SetImageControllerQuayOrg(context.Background(), "my-org"), "failed to get secret other/quaytoken")
+}
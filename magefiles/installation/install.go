@@ -2,10 +2,21 @@ package installation
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"math/rand"
+	"net/url"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"text/template"
 	"time"
 
 	"strings"
@@ -14,6 +25,8 @@ import (
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
 	configv1client "github.com/openshift/client-go/config/clientset/versioned"
 
 	appclientset "github.com/argoproj/argo-cd/v2/pkg/client/clientset/versioned"
@@ -22,12 +35,17 @@ import (
 	"github.com/konflux-ci/e2e-tests/pkg/utils"
 	corev1 "k8s.io/api/core/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
 
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
 	sigsConfig "sigs.k8s.io/controller-runtime/pkg/client/config"
 )
 
@@ -40,10 +58,40 @@ const (
 	DEFAULT_E2E_QUAY_ORG             = "redhat-appstudio-qe"
 
 	enableSchedulingOnMasterNodes = "true"
+
+	defaultRestartReadinessTimeout = 5 * time.Minute
+
+	defaultHTTPTimeout = 30 * time.Second
+
+	defaultGitAuthorName  = "Konflux e2e installer"
+	defaultGitAuthorEmail = "e2e-installer@konflux-ci.dev"
+
+	upstreamInfraDeploymentsURL = "https://github.com/redhat-appstudio/infra-deployments.git"
+
+	defaultImageControllerNamespace = "image-controller"
+
+	defaultCloneRetries = 3
+	cloneRetryBaseDelay = 10 * time.Second
+	cloneRetryMaxDelay  = 2 * time.Minute
 )
 
+// Selects all optional components in Components
+const ComponentsAll = "all"
+
 var (
-	previewInstallArgs = []string{"preview", "--keycloak", "--toolchain"}
+	previewInstallArgs = []string{"preview"}
+
+	// Optional components of the preview install and the bootstrap flags installing them, in the order the flags are passed
+	bootstrapComponents = []struct{ name, flag string }{
+		{name: "keycloak", flag: "--keycloak"},
+		{name: "toolchain", flag: "--toolchain"},
+	}
+
+	// Overlays of infra-deployments allowed when AllowedOverlays is not set
+	defaultAllowedOverlays = []string{"development", "staging"}
+
+	// Builds the config of the target cluster. Replaced in unit tests
+	getRestConfig = sigsConfig.GetConfig
 )
 
 type patchStringValue struct {
@@ -59,6 +107,16 @@ type InstallAppStudio struct {
 	// TmpDirectory to store temporary files like git repos or some metadata
 	TmpDirectory string
 
+	// Free disk space required in the filesystem of TmpDirectory before the installation starts, set from the
+	// MIN_FREE_DISK_SPACE quantity, e.g. 2Gi. Zero, the default, disables the check, which is only supported on unix
+	MinFreeDiskBytes int64
+
+	// Minimal number of Ready nodes and their total allocatable CPU and memory checked before the installation,
+	// e.g. for perf installs. Zero values disable the respective checks
+	MinClusterNodes  int
+	MinClusterCPU    resource.Quantity
+	MinClusterMemory resource.Quantity
+
 	// Directory where to clone https://github.com/redhat-appstudio/infra-deployments repo
 	InfraDeploymentsCloneDir string
 
@@ -68,15 +126,106 @@ type InstallAppStudio struct {
 	// Github organization from where will be cloned
 	InfraDeploymentsOrganizationName string
 
+	// Optional commit of infra-deployments to checkout after the clone instead of the tip of InfraDeploymentsBranch
+	InfraDeploymentsCommit string
+
+	// Branch the GitOps of the bootstrap tracks, passed to the bootstrap script in the MY_GIT_BRANCH env.
+	// Defaults to InfraDeploymentsBranch, set it when the fork's branch differs from the cloned one
+	GitOpsTrackBranch string
+
+	// Optional components installed along with the preview stack, e.g. "keycloak" or "toolchain".
+	// All of them are installed when empty or containing "all"
+	Components []string
+
+	// Kustomize overlay of infra-deployments to install, passed to the bootstrap script in the INFRA_DEPLOYMENTS_OVERLAY env.
+	// If empty, the bootstrap script picks the overlay
+	Overlay string
+
+	// Overlays which can be installed. Defaults to the development and staging overlays
+	AllowedOverlays []string
+
+	// If true, the installation fails when InfraDeploymentsCloneDir already exists instead of reusing or removing it
+	FailIfCloneExists bool
+
+	// Branches of infra-deployments tried in order when InfraDeploymentsBranch doesn't exist.
+	// Set from the comma-separated INFRA_DEPLOYMENTS_BRANCH_FALLBACKS env
+	BranchFallbacks []string
+
+	// Mirrors of infra-deployments tried in order when cloning from GitHub fails. The fork remotes still point to the configured forks
+	MirrorURLs []string
+
+	// Optional .tar.gz of infra-deployments extracted into InfraDeploymentsCloneDir instead of cloning, for offline installations.
+	// The fork remotes are not configured and AfterCloneHook is not run for it
+	InfraDeploymentsTarball string
+
+	// Optional hook called with the infra-deployments clone once it is checked out and its remotes are configured,
+	// before the bootstrap. It can e.g. cherry-pick a patch. An error aborts the installation
+	AfterCloneHook func(repo *git.Repository) error
+
+	// Identity set in the config of the infra-deployments clone for the commits made after the clone,
+	// e.g. by the rebase on upstream main or by AfterCloneHook. Defaults to an identity of the e2e installer
+	GitAuthorName  string
+	GitAuthorEmail string
+
+	// Depth of the infra-deployments clone, ignored when InfraDeploymentsCommit is set. With a depth, only InfraDeploymentsBranch
+	// is cloned; all branches with full history are cloned by default
+	CloneDepth int
+
+	// How many times a failed clone is retried
+	CloneRetries int
+
+	// If true, the delay between clone retries is randomized to avoid many CI runs retrying at the same time
+	CloneBackoffJitter bool
+
+	// Env holding the GitHub token used for cloning and passed to the bootstrap script. Defaults to GITHUB_TOKEN
+	GitHubTokenEnvVar string
+
+	// If true, infra-deployments is cloned with an installation access token of the GitHub App
+	UseGitHubAppAuth bool
+
+	// Id and private key (PEM, optionally base64-encoded) of the GitHub App used for cloning
+	GitHubAppID         string
+	GitHubAppPrivateKey string
+
+	// Timeout of the HTTP requests to the GitHub API, the quay registry and the health endpoints. Defaults to 30s
+	HTTPTimeout time.Duration
+
+	// Status code of a healthy endpoint polled by WaitForHTTPHealthy. Defaults to 200
+	HealthyHTTPStatus int
+
 	// Desired fork name for testing
 	LocalForkName string
 
 	// Github organization to use for testing purposes in preview mode
 	LocalGithubForkOrganization string
 
+	// If true, infra-deployments is installed straight from the cloned repository and no fork remotes are added
+	NoFork bool
+
+	// If true, the fork remotes fetch from upstream infra-deployments and only push to the forks (git's remote.<name>.pushurl)
+	ForkFetchFromUpstream bool
+
+	// If true, the forks have to share history with the cloned infra-deployments, so an unrelated repository
+	// configured as a fork is rejected before the bootstrap
+	VerifyForkRelated bool
+
+	// Fork remotes (name -> URL) to add to the cloned repository. If empty, LocalForkName remote
+	// pointing to the infra-deployments fork in LocalGithubForkOrganization is added
+	ForkRemotes map[string]string
+
 	// Namespace where build applications will be placed
 	E2EApplicationsNamespace string
 
+	// Optional pull secret WaitForE2ENamespaceReady waits to be linked to the default service account of E2EApplicationsNamespace
+	E2ENamespacePullSecret string
+
+	// Optional ResourceQuota and LimitRange applied to E2EApplicationsNamespace, bounding the resource usage of e.g. perf runs
+	E2ENamespaceResourceQuota *corev1.ResourceQuotaSpec
+	E2ENamespaceLimitRange    *corev1.LimitRangeSpec
+
+	// Optional manifest with ResourceQuota and LimitRange objects applied to E2EApplicationsNamespace, in addition to the fields above
+	E2ENamespaceQuotaManifest string
+
 	// base64-encoded content of a docker/config.json file which contains a valid login credentials for quay.io
 	QuayToken string
 
@@ -89,259 +238,1759 @@ type InstallAppStudio struct {
 	// Default expiration for image tags
 	DefaultImageTagExpiration string
 
+	// Namespace where image-controller is deployed
+	ImageControllerNamespace string
+
+	// Domain of the cluster's application routes, e.g. apps.my-cluster.example.com. Exported to the bootstrap script
+	// in APPS_DOMAIN and used for the SPI OAuth redirect proxy URL when OAUTH_REDIRECT_PROXY_URL is not set
+	AppsDomain string
+
+	// Namespace and name of the route of the SPI OAuth service
+	SPIOAuthRouteNamespace string
+	SPIOAuthRouteName      string
+
 	// If set to "true", e2e-tests installer will mark master/control plane nodes as schedulable
 	EnableSchedulingOnMasterNodes string
+
+	// Source of the credentials stored in the e2e quay secret. By default the QUAY_TOKEN env is used
+	SecretSource SecretSource
+
+	// Optional hook which can modify the docker/config.json of the e2e quay secret before it is written, e.g. to add
+	// a credsStore or auths of other registries. Its output has to be a valid docker/config.json with credentials
+	DockerConfigTransform func(data []byte) ([]byte, error)
+
+	// Optional callback notified about every completed installation phase
+	PhaseCallback PhaseCallback
+
+	// Timeouts of the installation phases by phase name, e.g. from the PHASE_TIMEOUTS env "clone=15m,bootstrap=90m".
+	// Phases which are not listed, or have a zero timeout, are not limited
+	PhaseTimeouts map[string]time.Duration
+
+	// User to impersonate when talking to the cluster, e.g. to test RBAC-limited installs
+	ImpersonateUser string
+
+	// Service account to impersonate when talking to the cluster, in the "<namespace>/<name>" format
+	ImpersonateServiceAccount string
+
+	// Path of a PEM bundle with the CA certificates of the API server, replacing the CA of the kubeconfig
+	KubeCABundlePath string
+
+	// If true, the certificate of the API server is not verified. Meant only for test clusters with self-signed certificates
+	KubeInsecureSkipTLSVerify bool
+
+	// If true, the installation fails early on clusters which are not OpenShift, since the bootstrap relies on routes and oc
+	RequireOpenShift bool
+
+	// Number of commits the cloned branch can be behind upstream main before CheckForkFreshness warns about it
+	ForkFreshnessThreshold int
+
+	// Format of the installer logs: "text" (default) or "json"
+	LogFormat string
+
+	// klog verbosity applied during the installation, e.g. 4 for the logs of the API requests. Not changed when zero
+	LogVerbosity int
+
+	// Optional file the installer's logs are written to in addition to stderr. It is rotated when it grows over
+	// LogFileMaxBytes (100 MiB if zero), keeping LogFileMaxBackups rotated files
+	LogFilePath       string
+	LogFileMaxBytes   int64
+	LogFileMaxBackups int
+
+	// Runs the bootstrap script. By default the script is executed as a local process
+	CommandRunner CommandRunner
+
+	// Optional file the output of the bootstrap script is written to
+	BootstrapLogFile string
+
+	// How many times the bootstrap script is run again when it fails, e.g. because of a transient operator rollout
+	// issue. At most 5 retries are allowed
+	RetryBootstrapOnFailure int
+
+	// If true, a bootstrap script without the execute permission (e.g. after a permission-stripping copy) is made executable
+	FixBootstrapPermissions bool
+
+	// Optional channel receiving the output of the bootstrap script line by line, see Command.Lines
+	BootstrapOutput chan<- string
+
+	// Optional shell the bootstrap script is run with, e.g. bash, instead of executing the script directly
+	BootstrapShell string
+
+	// If true, the arguments of the bootstrap script (e.g. --keycloak) are checked against the content of the script
+	// before the bootstrap is run
+	CheckBootstrapFlags bool
+
+	// If true, the bootstrap script doesn't inherit the installer's environment, it gets only the installation envs
+	// and PATH, HOME and KUBECONFIG
+	CleanEnv bool
+
+	// If true, the e2e quay secret is not created, e.g. because the pull secret is managed externally
+	SkipQuaySecret bool
+
+	// Host of the registry the e2e quay secret has to contain credentials for, e.g. of a private quay deployment. Defaults to quay.io
+	RegistryHost string
+
+	// Data key of the e2e quay secret the docker config is stored under. Defaults to .dockerconfigjson
+	QuaySecretDataKey string
+
+	// Labels of the e2e quay secret, e.g. for controllers discovering pull secrets by label. Other labels of the secret are kept
+	SecretLabels map[string]string
+
+	// Annotations of the e2e quay secret, e.g. a source id for rotation tooling. They are set on each write together with
+	// the time of the write in the e2e-tests.konflux-ci.dev/last-rotated annotation. Other annotations of the secret are kept
+	SecretAnnotations map[string]string
+
+	// Optional file recording the phases completed by the installation. When an interrupted installation of the same
+	// infra-deployments commit is re-run, the recorded phases are skipped. The clone phase always runs to resolve the commit,
+	// which is InfraDeploymentsCommit or, when the commit is not pinned, the commit of upstream main the clone is rebased on
+	CheckpointFile string
+
+	// Total number of retries of failed operations (clone, git remotes, transient API errors) allowed during
+	// an installation. Once it's spent, operations fail instead of retrying. Zero means no limit
+	RetryBudget int
+
+	// Number of deployments VerifyOnly checks in parallel. The deployments are checked one by one by default
+	VerifyConcurrency int
+
+	// Number of CustomResourceDefinitions WaitForCRDsEstablished fetches in parallel on every poll. All of them are
+	// listed with a single request by default
+	CRDWaitConcurrency int
+
+	// Namespace and name of the ConfigMap the installed infra-deployments commit is recorded on after a successful installation.
+	// Defaults to the namespace of the e2e quay secret; set another namespace for a record which outlives that namespace
+	InstalledRefNamespace string
+	InstalledRefConfigMap string
+
+	// If true, QUAY_TOKEN is kept only in memory and passed just to the bootstrap script, instead of exporting it
+	// into the installer's environment where all child processes can read it
+	KeepQuayTokenOutOfEnv bool
+
+	// If true, the quay credentials are verified against the registry before the installation starts
+	VerifyQuayLoginBeforeInstall bool
+
+	// Image pulled by VerifyPullSecretWithProbe, e.g. from an internal mirror on air-gapped clusters. Defaults to a tiny public image
+	PullSecretProbeImage string
+
+	// If true, changes of the cluster configuration (e.g. configmap patches) are only printed, not applied
+	DryRun bool
+
+	// Paths to manifest files or directories which are applied to the cluster after bootstrap
+	ExtraManifests []string
+
+	// How long to wait for a restarted deployment to become ready. If zero, the readiness is not awaited
+	RestartReadinessTimeout time.Duration
+
+	// Interval between two checks of the wait helpers, e.g. WaitForDeploymentReady. Defaults to 5s
+	PollInterval time.Duration
+
+	// If true, a unique run id is appended to InfraDeploymentsCloneDir, so parallel installations sharing TmpDirectory don't collide
+	IsolateCloneDir bool
+
+	// Optional suffix appended to the names of the e2e quay secret, E2EApplicationsNamespace and the installed ref ConfigMap,
+	// so parallel installations on one cluster don't collide. The suites reading constants.QuayRepositorySecretName
+	// have to use the name with the suffix, InstallResult.InstanceSuffix
+	InstanceSuffix string
+
+	// If true, a random InstanceSuffix is generated when it is empty
+	GenerateInstanceSuffix bool
+
+	// If true, Uninstall deletes the namespace of the e2e quay secret and E2EApplicationsNamespace even when this
+	// instance didn't write into them, e.g. from a cleanup job. The namespaces can be shared with other jobs
+	UninstallDeletesNamespaces bool
+
+	// ctx is the base context set by WithContext, used by the methods without a context parameter
+	ctx context.Context
+
+	// clientset overrides the clientset taken from KubernetesClient. Used in unit tests
+	clientset kubernetes.Interface
+	// crClient overrides the controller-runtime client taken from KubernetesClient. Used in unit tests
+	crClient crclient.Client
+	// openshiftConfigClient overrides the client for config.openshift.io API group. Used in unit tests
+	openshiftConfigClient configv1client.Interface
+	// registryURL overrides the URL of the quay registry. Used in unit tests
+	registryURL string
+	// cloneURL overrides the URL infra-deployments is cloned from. Used in unit tests
+	cloneURL string
+	// upstreamRemoteURL overrides the URL of the upstream remote. Used in unit tests
+	upstreamRemoteURL string
+
+	// id of the run the clone directory was isolated with
+	runID string
+
+	githubAppTokens *githubAppTokenSource
+
+	mu       sync.Mutex
+	progress float64
+	result   InstallResult
+	// runs of each phase across installations, exported by WriteMetrics
+	phaseCounts map[string]*phaseCounts
+	// retries of the current installation taken from RetryBudget
+	retriesSpent int
+	// source of randomness for the clone backoff jitter
+	rand *rand.Rand
 }
 
 func NewAppStudioInstallController() (*InstallAppStudio, error) {
 	cwd, _ := os.Getwd()
-	k8sClient, err := kubeCl.NewAdminKubernetesClient()
-
-	if err != nil {
-		return nil, err
-	}
 
-	return &InstallAppStudio{
-		KubernetesClient:                 k8sClient,
+	i := &InstallAppStudio{
 		TmpDirectory:                     DEFAULT_TMP_DIR,
 		InfraDeploymentsCloneDir:         fmt.Sprintf("%s/%s/infra-deployments", cwd, DEFAULT_TMP_DIR),
 		InfraDeploymentsBranch:           utils.GetEnv("INFRA_DEPLOYMENTS_BRANCH", DEFAULT_INFRA_DEPLOYMENTS_BRANCH),
 		InfraDeploymentsOrganizationName: utils.GetEnv("INFRA_DEPLOYMENTS_ORG", DEFAULT_INFRA_DEPLOYMENTS_GH_ORG),
-		LocalForkName:                    DEFAULT_LOCAL_FORK_NAME,
+		InfraDeploymentsCommit:           utils.GetEnv("INFRA_DEPLOYMENTS_COMMIT", ""),
+		GitOpsTrackBranch:                utils.GetEnv("GITOPS_TRACK_BRANCH", ""),
+		GitAuthorName:                    utils.GetEnv("GIT_AUTHOR_NAME", defaultGitAuthorName),
+		GitAuthorEmail:                   utils.GetEnv("GIT_AUTHOR_EMAIL", defaultGitAuthorEmail),
+		BranchFallbacks:                  splitList(utils.GetEnv("INFRA_DEPLOYMENTS_BRANCH_FALLBACKS", "")),
+		MirrorURLs:                       splitList(utils.GetEnv("INFRA_DEPLOYMENTS_MIRROR_URLS", "")),
+		InfraDeploymentsTarball:          utils.GetEnv("INFRA_DEPLOYMENTS_TARBALL", ""),
+		Overlay:                          utils.GetEnv("INFRA_DEPLOYMENTS_OVERLAY", ""),
+		Components:                       splitList(utils.GetEnv("INSTALL_COMPONENTS", ComponentsAll)),
+		CloneRetries:                     defaultCloneRetries,
+		CloneBackoffJitter:               true,
+		GitHubTokenEnvVar:                utils.GetEnv("GITHUB_TOKEN_ENV_VAR", defaultGitHubTokenEnvVar),
+		UseGitHubAppAuth:                 utils.GetEnv("USE_GITHUB_APP_AUTH", "false") == "true",
+		GitHubAppID:                      utils.GetEnv("E2E_PAC_GITHUB_APP_ID", ""),
+		GitHubAppPrivateKey:              utils.GetEnv("E2E_PAC_GITHUB_APP_PRIVATE_KEY", ""),
+		LocalForkName:                    utils.GetEnv("MY_GIT_FORK_REMOTE", DEFAULT_LOCAL_FORK_NAME),
 		LocalGithubForkOrganization:      utils.GetEnv("MY_GITHUB_ORG", DEFAULT_LOCAL_FORK_ORGANIZATION),
+		NoFork:                           utils.GetEnv("NO_FORK", "false") == "true",
+		ForkFetchFromUpstream:            utils.GetEnv("FORK_FETCH_FROM_UPSTREAM", "false") == "true",
+		VerifyForkRelated:                utils.GetEnv("VERIFY_FORK_RELATED", "false") == "true",
+		E2ENamespaceQuotaManifest:        utils.GetEnv("E2E_NAMESPACE_QUOTA_MANIFEST", ""),
 		QuayToken:                        utils.GetEnv("QUAY_TOKEN", ""),
 		DefaultImageQuayOrg:              utils.GetEnv("DEFAULT_QUAY_ORG", DEFAULT_E2E_QUAY_ORG),
 		DefaultImageQuayOrgOAuth2Token:   utils.GetEnv("DEFAULT_QUAY_ORG_TOKEN", ""),
 		DefaultImageTagExpiration:        utils.GetEnv(constants.IMAGE_TAG_EXPIRATION_ENV, constants.DefaultImageTagExpiration),
+		ImageControllerNamespace:         utils.GetEnv("IMAGE_CONTROLLER_NAMESPACE", defaultImageControllerNamespace),
 		EnableSchedulingOnMasterNodes:    utils.GetEnv(constants.ENABLE_SCHEDULING_ON_MASTER_NODES_ENV, enableSchedulingOnMasterNodes),
-	}, nil
+		AppsDomain:                       utils.GetEnv("APPS_DOMAIN", ""),
+		SPIOAuthRouteNamespace:           utils.GetEnv("SPI_OAUTH_ROUTE_NAMESPACE", spiNamespace),
+		SPIOAuthRouteName:                utils.GetEnv("SPI_OAUTH_ROUTE_NAME", defaultSPIOAuthRouteName),
+		SecretSource:                     EnvSecretSource{},
+		ImpersonateUser:                  utils.GetEnv("IMPERSONATE_USER", ""),
+		ImpersonateServiceAccount:        utils.GetEnv("IMPERSONATE_SERVICE_ACCOUNT", ""),
+		KubeCABundlePath:                 utils.GetEnv("KUBE_CA_BUNDLE_PATH", ""),
+		KubeInsecureSkipTLSVerify:        utils.GetEnv("KUBE_INSECURE_SKIP_TLS_VERIFY", "false") == "true",
+		RequireOpenShift:                 utils.GetEnv("REQUIRE_OPENSHIFT", "false") == "true",
+		LogFormat:                        utils.GetEnv("INSTALLER_LOG_FORMAT", LogFormatText),
+		LogFilePath:                      utils.GetEnv("INSTALLER_LOG_FILE", ""),
+		LogFileMaxBackups:                defaultLogFileMaxBackups,
+		CommandRunner:                    ExecCommandRunner{},
+		BootstrapLogFile:                 utils.GetEnv("BOOTSTRAP_LOG_FILE", ""),
+		BootstrapShell:                   utils.GetEnv("BOOTSTRAP_SHELL", ""),
+		FixBootstrapPermissions:          utils.GetEnv("FIX_BOOTSTRAP_PERMISSIONS", "false") == "true",
+		CheckBootstrapFlags:              utils.GetEnv("CHECK_BOOTSTRAP_FLAGS", "false") == "true",
+		SkipQuaySecret:                   utils.GetEnv("SKIP_QUAY_SECRET", "false") == "true",
+		RegistryHost:                     utils.GetEnv("QUAY_REGISTRY_HOST", defaultQuayRegistry),
+		QuaySecretDataKey:                utils.GetEnv("QUAY_SECRET_DATA_KEY", corev1.DockerConfigJsonKey),
+		InstalledRefNamespace:            utils.GetEnv("INSTALLED_REF_NAMESPACE", defaultInstalledRefNamespace),
+		InstalledRefConfigMap:            utils.GetEnv("INSTALLED_REF_CONFIGMAP", defaultInstalledRefConfigMap),
+		KeepQuayTokenOutOfEnv:            utils.GetEnv("KEEP_QUAY_TOKEN_OUT_OF_ENV", "false") == "true",
+		VerifyQuayLoginBeforeInstall:     utils.GetEnv("VERIFY_QUAY_LOGIN", "false") == "true",
+		PullSecretProbeImage:             utils.GetEnv("PULL_SECRET_PROBE_IMAGE", defaultPullSecretProbeImage),
+		RestartReadinessTimeout:          defaultRestartReadinessTimeout,
+		HTTPTimeout:                      defaultHTTPTimeout,
+		PollInterval:                     defaultPollInterval,
+		CheckpointFile:                   utils.GetEnv("INSTALL_CHECKPOINT_FILE", ""),
+		IsolateCloneDir:                  utils.GetEnv("ISOLATE_CLONE_DIR", "false") == "true",
+		InstanceSuffix:                   utils.GetEnv("INSTANCE_SUFFIX", ""),
+		GenerateInstanceSuffix:           utils.GetEnv("GENERATE_INSTANCE_SUFFIX", "false") == "true",
+		FailIfCloneExists:                utils.GetEnv("FAIL_IF_CLONE_EXISTS", "false") == "true",
+		UninstallDeletesNamespaces:       utils.GetEnv("UNINSTALL_DELETES_NAMESPACES", "false") == "true",
+	}
+	phaseTimeouts, err := parsePhaseTimeouts(utils.GetEnv("PHASE_TIMEOUTS", ""))
+	if err != nil {
+		return nil, err
+	}
+	i.PhaseTimeouts = phaseTimeouts
+	if i.MinFreeDiskBytes, err = parseDiskSpace(utils.GetEnv("MIN_FREE_DISK_SPACE", "")); err != nil {
+		return nil, err
+	}
+	if profile := utils.GetEnv("INSTALLER_PROFILE", ""); profile != "" {
+		if err := i.ApplyProfile(profile); err != nil {
+			return nil, err
+		}
+	}
+
+	kubeconfig, err := i.restConfig()
+	if err != nil {
+		return nil, err
+	}
+	i.KubernetesClient, err = kubeCl.NewKubernetesClientFromConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+// WithContext sets the base context of the installation: the methods without a context parameter, like
+// InstallAppStudioPreviewMode, run with it, so cancelling it aborts their in-flight operations
+func (i *InstallAppStudio) WithContext(ctx context.Context) *InstallAppStudio {
+	i.ctx = ctx
+	return i
+}
+
+// baseContext returns the base context set by WithContext, context.Background() if none is set
+func (i *InstallAppStudio) baseContext() context.Context {
+	if i.ctx == nil {
+		return context.Background()
+	}
+	return i.ctx
 }
 
 // Start the appstudio installation in preview mode.
 func (i *InstallAppStudio) InstallAppStudioPreviewMode() error {
-	if err := i.cloneInfraDeployments(); err != nil {
-		return fmt.Errorf("failed to clone infra-deployments repository: %+v", err)
+	ctx := i.baseContext()
+	restoreLogging, err := i.configureLogging(os.Stderr)
+	if err != nil {
+		return err
 	}
-	i.setInstallationEnvironments()
+	defer restoreLogging()
 
-	if i.EnableSchedulingOnMasterNodes == "true" {
-		if err := i.MarkMasterNodesAsSchedulable(); err != nil {
+	if err := i.Validate(); err != nil {
+		return err
+	}
+	i.isolateCloneDir()
+	i.setInstanceSuffix()
+	if err := i.CheckDiskSpace(); err != nil {
+		return err
+	}
+	if i.MinClusterNodes > 0 || !i.MinClusterCPU.IsZero() || !i.MinClusterMemory.IsZero() {
+		if err := i.PreflightClusterCapacity(ctx, i.MinClusterNodes, i.MinClusterCPU, i.MinClusterMemory); err != nil {
 			return err
 		}
 	}
 
-	if err := utils.ExecuteCommandInASpecificDirectory("hack/bootstrap-cluster.sh", previewInstallArgs, i.InfraDeploymentsCloneDir); err != nil {
+	if err := i.LogClusterVersion(ctx); err != nil {
+		klog.Warningf("failed to determine version of the cluster: %+v", err)
+	}
+
+	if err := i.EnsureOpenShift(ctx); err != nil {
 		return err
 	}
 
-	return i.createE2EQuaySecret()
+	if i.VerifyQuayLoginBeforeInstall && !i.SkipQuaySecret {
+		if err := i.VerifyQuayLogin(ctx); err != nil {
+			return fmt.Errorf("failed to verify quay credentials: %+v", err)
+		}
+	}
+
+	return i.runPhases(ctx, []installPhase{
+		{name: PhaseClone, weight: 20, run: func(ctx context.Context) error {
+			if err := i.cloneInfraDeployments(ctx); err != nil {
+				return fmt.Errorf("failed to clone infra-deployments repository: %+v", err)
+			}
+			commitSHA, err := i.InstalledCommitSHA()
+			if err != nil && i.InfraDeploymentsTarball == "" {
+				return err
+			} else if err != nil {
+				// A tarball usually doesn't contain the git metadata, the pinned commit is the best known ref
+				commitSHA = i.InfraDeploymentsCommit
+				klog.Warningf("commit of infra-deployments tarball %s is not known, using InfraDeploymentsCommit %q: %+v", i.InfraDeploymentsTarball, commitSHA, err)
+			}
+			klog.Infof("installing infra-deployments commit %s", commitSHA)
+			var upstreamSHA string
+			if i.InfraDeploymentsCommit == "" && i.InfraDeploymentsTarball == "" {
+				if upstreamSHA, err = i.upstreamCommitSHA(); err != nil {
+					klog.Warningf("commit of upstream main is not known, a checkpoint can't be resumed: %+v", err)
+				}
+			}
+
+			i.mu.Lock()
+			defer i.mu.Unlock()
+			i.result.CommitSHA = commitSHA
+			i.result.UpstreamCommitSHA = upstreamSHA
+			return nil
+		}},
+		// The later phases, e.g. the quay secret from the QUAY_TOKEN env, still need the envs exported by the bootstrap
+		{name: PhaseBootstrap, weight: 70, run: i.bootstrap, skipped: i.setInstallationEnvironments},
+		{name: PhaseSPIConfig, weight: 2, run: i.configureSPIOAuth},
+		{name: PhaseExtraManifests, weight: 5, run: i.applyExtraManifests},
+		{name: PhaseQuaySecret, weight: 10, run: i.ensureE2EQuaySecret},
+		{name: PhaseNamespaceQuota, weight: 1, run: i.applyE2ENamespaceQuota},
+		{name: PhaseRecordRef, weight: 1, run: i.recordInstalledRef},
+	})
 }
 
-// MarkMasterNodesAsSchedulable uses configv1client for updating scheduler/cluster with "spec.mastersSchedulable:true"
-func (i *InstallAppStudio) MarkMasterNodesAsSchedulable() error {
-	klog.Infof("Configuring master/control plane nodes as schedulable")
+// Bootstrap script of infra-deployments, relative to the root of the clone
+const bootstrapScript = "hack/bootstrap-cluster.sh"
 
-	kubeconfig, err := sigsConfig.GetConfig()
-	if err != nil {
-		return fmt.Errorf("error when getting config: %+v", err)
+// Upper limit of RetryBootstrapOnFailure, so a broken configuration doesn't keep re-running the long bootstrap
+const maxBootstrapRetries = 5
+
+// Delay before the bootstrap script is run again after a failure
+var bootstrapRetryDelay = 30 * time.Second
+
+// bootstrap runs the bootstrap script of infra-deployments
+func (i *InstallAppStudio) bootstrap(ctx context.Context) error {
+	i.setInstallationEnvironments()
+
+	if i.EnableSchedulingOnMasterNodes == "true" {
+		if err := i.markMasterNodesAsSchedulable(ctx); err != nil {
+			return err
+		}
 	}
 
-	configv1client, err := configv1client.NewForConfig(kubeconfig)
-	if err != nil {
-		return fmt.Errorf("error when creating configv1client: %+v", err)
+	if err := i.checkBootstrapExecutable(); err != nil {
+		return err
 	}
-	_, err = configv1client.ConfigV1().Schedulers().Patch(context.Background(), "cluster", types.MergePatchType, []byte("{\"spec\":{\"mastersSchedulable\":true}}"), metav1.PatchOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to mark master nodes as schedulable: %+v", err)
+	if i.CheckBootstrapFlags {
+		if err := i.checkBootstrapFlags(); err != nil {
+			return err
+		}
 	}
-	return nil
-}
 
-func (i *InstallAppStudio) setInstallationEnvironments() {
-	os.Setenv("MY_GITHUB_ORG", i.LocalGithubForkOrganization)
-	os.Setenv("MY_GITHUB_TOKEN", utils.GetEnv("GITHUB_TOKEN", ""))
-	os.Setenv("MY_GIT_FORK_REMOTE", i.LocalForkName)
-	os.Setenv("TEST_BRANCH_ID", util.GenerateRandomString(4))
-	os.Setenv("QUAY_TOKEN", i.QuayToken)
-	os.Setenv("IMAGE_CONTROLLER_QUAY_ORG", i.DefaultImageQuayOrg)
-	os.Setenv("IMAGE_CONTROLLER_QUAY_TOKEN", i.DefaultImageQuayOrgOAuth2Token)
-	os.Setenv("BUILD_SERVICE_IMAGE_TAG_EXPIRATION", i.DefaultImageTagExpiration)
-	os.Setenv("PAC_GITHUB_APP_ID", utils.GetEnv("E2E_PAC_GITHUB_APP_ID", ""))                   // #nosec G104
-	os.Setenv("PAC_GITHUB_APP_PRIVATE_KEY", utils.GetEnv("E2E_PAC_GITHUB_APP_PRIVATE_KEY", "")) // #nosec G104
-	os.Setenv(constants.ENABLE_SCHEDULING_ON_MASTER_NODES_ENV, i.EnableSchedulingOnMasterNodes)
-}
-
-func (i *InstallAppStudio) cloneInfraDeployments() error {
-	dirInfo, err := os.Stat(i.InfraDeploymentsCloneDir)
-
-	if !os.IsNotExist(err) && dirInfo.IsDir() {
-		klog.Warningf("folder %s already exists... removing", i.InfraDeploymentsCloneDir)
-
-		err := os.RemoveAll(i.InfraDeploymentsCloneDir)
-		if err != nil {
-			return fmt.Errorf("error removing %s folder", i.InfraDeploymentsCloneDir)
+	command := Command{Name: bootstrapScript, Args: i.bootstrapArgs(), Dir: i.InfraDeploymentsCloneDir, LogFile: i.BootstrapLogFile, Lines: i.BootstrapOutput}
+	if i.BootstrapShell != "" {
+		command.Name, command.Args = i.BootstrapShell, append([]string{bootstrapScript}, command.Args...)
+	}
+	if i.KeepQuayTokenOutOfEnv || i.Overlay != "" || i.CleanEnv {
+		command.Env = map[string]string{}
+	}
+	if i.CleanEnv {
+		// The installation envs are exported into the installer's environment, which the script doesn't inherit now
+		command.CleanEnv = true
+		for name := range i.Result().Environment {
+			if value, ok := os.LookupEnv(name); ok {
+				command.Env[name] = value
+			}
 		}
 	}
+	if i.KeepQuayTokenOutOfEnv {
+		command.Env["QUAY_TOKEN"] = i.QuayToken
+	}
+	if i.Overlay != "" {
+		command.Env["INFRA_DEPLOYMENTS_OVERLAY"] = i.Overlay
+	}
+	return i.runBootstrap(ctx, command)
+}
 
-	url := fmt.Sprintf("https://github.com/%s/infra-deployments", i.InfraDeploymentsOrganizationName)
-	refName := fmt.Sprintf("refs/heads/%s", i.InfraDeploymentsBranch)
-	klog.Infof("cloning '%s' with git ref '%s'", url, refName)
+// runBootstrap runs the bootstrap script, re-running it up to RetryBootstrapOnFailure times when it fails
+func (i *InstallAppStudio) runBootstrap(ctx context.Context, command Command) error {
+	retries := min(max(i.RetryBootstrapOnFailure, 0), maxBootstrapRetries)
+	if retries == 0 {
+		return i.commandRunner().Run(ctx, command)
+	}
 
-	remoteName := "fork"
-	if i.InfraDeploymentsOrganizationName == "redhat-appstudio" {
-		remoteName = "upstream"
+	// The runner closes the output channel once the script completes, so every attempt gets its own
+	// channel forwarded to the one of the caller, which is closed after the last attempt
+	lines := command.Lines
+	if lines != nil {
+		defer close(lines)
 	}
-	repo, _ := git.PlainClone(i.InfraDeploymentsCloneDir, false, &git.CloneOptions{
-		URL:           url,
-		ReferenceName: plumbing.ReferenceName(refName),
-		Progress:      os.Stdout,
-		RemoteName:    remoteName,
-	})
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			if budgetErr := i.spendRetry(); budgetErr != nil {
+				return fmt.Errorf("%w; last error: %+v", budgetErr, err)
+			}
+			klog.Warningf("bootstrap failed, running it again (attempt %d of %d): %+v", attempt+1, retries+1, err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(bootstrapRetryDelay):
+			}
+		}
 
-	if i.InfraDeploymentsOrganizationName != "redhat-appstudio" {
-		if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "upstream", URLs: []string{"https://github.com/redhat-appstudio/infra-deployments.git"}}); err != nil {
+		var forwarded chan struct{}
+		if lines != nil {
+			attemptLines := make(chan string, cap(lines))
+			forwarded = forwardLines(attemptLines, lines)
+			command.Lines = attemptLines
+		}
+		err = i.commandRunner().Run(ctx, command)
+		if forwarded != nil {
+			<-forwarded
+		}
+		if err == nil || ctx.Err() != nil {
 			return err
 		}
 	}
 
-	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: i.LocalForkName, URLs: []string{fmt.Sprintf("https://github.com/%s/infra-deployments.git", i.LocalGithubForkOrganization)}}); err != nil {
-		return err
+	return fmt.Errorf("bootstrap failed after %d attempts: %w", retries+1, err)
+}
+
+// forwardLines sends the lines received from in to out without blocking, until in is closed
+func forwardLines(in <-chan string, out chan<- string) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for line := range in {
+			select {
+			case out <- line:
+			default:
+			}
+		}
+	}()
+	return done
+}
+
+// checkBootstrapExecutable verifies that the bootstrap script exists in the clone and, unless it's run with BootstrapShell,
+// that it's executable. With FixBootstrapPermissions a script which is not executable is made executable.
+func (i *InstallAppStudio) checkBootstrapExecutable() error {
+	script := filepath.Join(i.InfraDeploymentsCloneDir, bootstrapScript)
+	info, err := os.Stat(script)
+	if err != nil {
+		return fmt.Errorf("bootstrap script %s not found, check the infra-deployments clone: %+v", script, err)
 	}
-	if err := utils.ExecuteCommandInASpecificDirectory("git", []string{"pull", "--rebase", "upstream", "main"}, i.InfraDeploymentsCloneDir); err != nil {
-		return err
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("bootstrap script %s is not a regular file", script)
+	}
+	if i.BootstrapShell != "" || info.Mode().Perm()&0100 != 0 {
+		return nil
 	}
 
+	if !i.FixBootstrapPermissions {
+		return fmt.Errorf("bootstrap script %s is not executable (mode %s); run 'chmod +x' on it or set FixBootstrapPermissions", script, info.Mode().Perm())
+	}
+	klog.Warningf("bootstrap script %s is not executable (mode %s), making it executable", script, info.Mode().Perm())
+	// #nosec G302 -- the script has to be executable
+	if err := os.Chmod(script, info.Mode().Perm()|0111); err != nil {
+		return fmt.Errorf("failed to make bootstrap script %s executable: %+v", script, err)
+	}
 	return nil
 }
 
-func (i *InstallAppStudio) CheckOperatorsReady() (err error) {
-	apiConfig, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
-	if err != nil {
-		klog.Fatal(err)
+// bootstrapArgs returns the arguments of the bootstrap script installing the selected Components
+func (i *InstallAppStudio) bootstrapArgs() []string {
+	args := append([]string{}, previewInstallArgs...)
+	all := len(i.Components) == 0 || slices.Contains(i.Components, ComponentsAll)
+	for _, component := range bootstrapComponents {
+		if all || slices.Contains(i.Components, component.name) {
+			args = append(args, component.flag)
+		}
 	}
-	config, err := clientcmd.NewDefaultClientConfig(*apiConfig, &clientcmd.ConfigOverrides{}).ClientConfig()
+	return args
+}
+
+// checkBootstrapFlags verifies that every argument of bootstrapArgs is mentioned in the bootstrap script, so a script
+// which dropped e.g. --toolchain fails before the long bootstrap. The script is only read: running it, even with
+// --help, could start a bootstrap with a script not knowing --help.
+func (i *InstallAppStudio) checkBootstrapFlags() error {
+	script, err := os.ReadFile(filepath.Join(i.InfraDeploymentsCloneDir, bootstrapScript))
 	if err != nil {
-		klog.Fatal(err)
+		return fmt.Errorf("failed to read bootstrap script: %+v", err)
 	}
-	appClientset := appclientset.NewForConfigOrDie(config)
 
-	patchPayload := []patchStringValue{{
-		Op:    "replace",
-		Path:  "/metadata/annotations/argocd.argoproj.io~1refresh",
-		Value: "hard",
-	}}
-	patchPayloadBytes, err := json.Marshal(patchPayload)
-	if err != nil {
-		klog.Fatal(err)
+	var unsupported []string
+	for _, arg := range i.bootstrapArgs() {
+		// e.g. --keycloak is not supported by a script only knowing --keycloak-operator
+		if !regexp.MustCompile(`(^|[^\w-])` + regexp.QuoteMeta(arg) + `($|[^\w-])`).Match(script) {
+			unsupported = append(unsupported, arg)
+		}
 	}
-	_, err = appClientset.ArgoprojV1alpha1().Applications("openshift-gitops").Patch(context.Background(), "all-application-sets", types.JSONPatchType, patchPayloadBytes, metav1.PatchOptions{})
-	if err != nil {
-		klog.Fatal(err)
+	if len(unsupported) > 0 {
+		return fmt.Errorf("bootstrap script %s doesn't support %s; update the installer or select other Components", bootstrapScript, strings.Join(unsupported, ", "))
 	}
 
-	for {
-		var count = 0
-		appsListFor, err := appClientset.ArgoprojV1alpha1().Applications("openshift-gitops").List(context.Background(), metav1.ListOptions{})
-		for _, app := range appsListFor.Items {
-			fmt.Printf("Check application: %s\n", app.Name)
-			application, err := appClientset.ArgoprojV1alpha1().Applications("openshift-gitops").Get(context.Background(), app.Name, metav1.GetOptions{})
-			if err != nil {
-				klog.Fatal(err)
-			}
+	return nil
+}
 
-			if !(application.Status.Sync.Status == "Synced" && application.Status.Health.Status == "Healthy") {
-				klog.Infof("Application %s not ready", app.Name)
-				count++
-			} else if strings.Contains(application.String(), ("context deadline exceeded")) {
-				fmt.Printf("Refreshing Application %s\n", app.Name)
-				patchPayload := []patchStringValue{{
-					Op:    "replace",
-					Path:  "/metadata/annotations/argocd.argoproj.io~1refresh",
-					Value: "soft",
-				}}
+// Validate checks that the configuration contains everything needed for the installation
+func (i *InstallAppStudio) Validate() error {
+	_, envSecretSource := i.SecretSource.(EnvSecretSource)
+	if !i.SkipQuaySecret && (i.SecretSource == nil || envSecretSource) && i.QuayToken == "" {
+		return fmt.Errorf("quay token is required to create the e2e quay secret; set the QUAY_TOKEN env or skip the secret creation with SKIP_QUAY_SECRET=true")
+	}
 
-				patchPayloadBytes, err := json.Marshal(patchPayload)
-				if err != nil {
-					klog.Fatal(err)
-				}
-				for _, app := range appsListFor.Items {
-					_, err = i.KubernetesClient.KubeInterface().AppsV1().Deployments("openshift-gitops").Patch(context.Background(), app.Name, types.JSONPatchType, patchPayloadBytes, metav1.PatchOptions{})
-					if err != nil {
-						klog.Fatal(err)
-					}
-				}
-			}
+	for _, component := range i.Components {
+		known := component == ComponentsAll
+		for _, c := range bootstrapComponents {
+			known = known || c.name == component
 		}
-		if err != nil {
-			klog.Fatal(err)
+		if !known {
+			return fmt.Errorf("unknown component %q", component)
 		}
+	}
 
-		if count == 0 {
-			klog.Info("All Application are ready\n")
-			break
+	if i.RetryBootstrapOnFailure < 0 || i.RetryBootstrapOnFailure > maxBootstrapRetries {
+		return fmt.Errorf("RetryBootstrapOnFailure must be between 0 and %d, got %d", maxBootstrapRetries, i.RetryBootstrapOnFailure)
+	}
+
+	if i.Overlay != "" {
+		allowedOverlays := i.AllowedOverlays
+		if len(allowedOverlays) == 0 {
+			allowedOverlays = defaultAllowedOverlays
+		}
+		if !slices.Contains(allowedOverlays, i.Overlay) {
+			return fmt.Errorf("overlay %q is not allowed; allowed overlays: %s", i.Overlay, strings.Join(allowedOverlays, ", "))
 		}
-		time.Sleep(10 * time.Second)
 	}
-	return err
-}
 
-// Create secret in e2e-secrets which can be copied to testing namespaces
-func (i *InstallAppStudio) createE2EQuaySecret() error {
-	quayToken := os.Getenv("QUAY_TOKEN")
-	if quayToken == "" {
-		return fmt.Errorf("failed to obtain quay token from 'QUAY_TOKEN' env; make sure the env exists")
+	if i.AppsDomain != "" {
+		if errs := validation.IsDNS1123Subdomain(i.AppsDomain); len(errs) > 0 {
+			return fmt.Errorf("invalid apps domain %q: %s", i.AppsDomain, strings.Join(errs, ", "))
+		}
 	}
 
-	decodedToken, err := base64.StdEncoding.DecodeString(quayToken)
-	if err != nil {
-		return fmt.Errorf("failed to decode quay token. Make sure that QUAY_TOKEN env contain a base64 token")
+	if _, err := i.oauthRedirectProxyURL(); err != nil {
+		return err
 	}
 
-	namespace := constants.QuayRepositorySecretNamespace
-	_, err = i.KubernetesClient.KubeInterface().CoreV1().Namespaces().Get(context.Background(), namespace, metav1.GetOptions{})
-	if err != nil {
-		if k8sErrors.IsNotFound(err) {
-			_, err := i.KubernetesClient.KubeInterface().CoreV1().Namespaces().Create(context.Background(), &corev1.Namespace{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: namespace,
-				},
-			}, metav1.CreateOptions{})
-			if err != nil {
-				return fmt.Errorf("error when creating namespace %s : %v", namespace, err)
-			}
-		} else {
-			return fmt.Errorf("error when getting namespace %s : %v", namespace, err)
+	if _, err := i.pullSecretProbeImage(); err != nil {
+		return err
+	}
+
+	// image-controller is configured only when the token for the default quay organization is provided
+	if i.DefaultImageQuayOrgOAuth2Token != "" {
+		if errs := validation.IsDNS1123Label(i.imageControllerNamespace()); len(errs) > 0 {
+			return fmt.Errorf("invalid image-controller namespace %q: %s", i.ImageControllerNamespace, strings.Join(errs, ", "))
 		}
 	}
 
-	secretName := constants.QuayRepositorySecretName
-	secret, err := i.KubernetesClient.KubeInterface().CoreV1().Secrets(namespace).Get(context.Background(), secretName, metav1.GetOptions{})
+	return nil
+}
 
-	if err != nil {
-		if k8sErrors.IsNotFound(err) {
-			_, err := i.KubernetesClient.KubeInterface().CoreV1().Secrets(namespace).Create(context.Background(), &corev1.Secret{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      secretName,
-					Namespace: namespace,
-				},
-				Type: corev1.SecretTypeDockerConfigJson,
-				Data: map[string][]byte{
-					corev1.DockerConfigJsonKey: decodedToken,
-				},
-			}, metav1.CreateOptions{})
+// imageControllerNamespace returns the namespace of image-controller, falling back to the default one
+func (i *InstallAppStudio) imageControllerNamespace() string {
+	if i.ImageControllerNamespace == "" {
+		return defaultImageControllerNamespace
+	}
+	return i.ImageControllerNamespace
+}
 
-			if err != nil {
-				return fmt.Errorf("error when creating secret %s : %v", secretName, err)
-			}
-		} else {
-			secret.Data = map[string][]byte{
-				corev1.DockerConfigJsonKey: decodedToken,
+// MarkMasterNodesAsSchedulable uses configv1client for updating scheduler/cluster with "spec.mastersSchedulable:true"
+func (i *InstallAppStudio) MarkMasterNodesAsSchedulable() error {
+	return i.markMasterNodesAsSchedulable(i.baseContext())
+}
+
+func (i *InstallAppStudio) markMasterNodesAsSchedulable(ctx context.Context) error {
+	klog.Infof("Configuring master/control plane nodes as schedulable")
+
+	configClient, err := i.configClient()
+	if err != nil {
+		return err
+	}
+	_, err = configClient.ConfigV1().Schedulers().Patch(ctx, "cluster", types.MergePatchType, []byte("{\"spec\":{\"mastersSchedulable\":true}}"), metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to mark master nodes as schedulable: %+v", err)
+	}
+	return nil
+}
+
+// LogClusterVersion logs the OpenShift version of the cluster or, on non-OpenShift clusters, the Kubernetes version
+func (i *InstallAppStudio) LogClusterVersion(ctx context.Context) error {
+	version, err := i.clusterVersion(ctx)
+	if err != nil {
+		return err
+	}
+	klog.InfoS("installing into cluster", "version", version)
+
+	return nil
+}
+
+func (i *InstallAppStudio) clusterVersion(ctx context.Context) (string, error) {
+	configClient, err := i.configClient()
+	if err != nil {
+		return "", err
+	}
+	clusterVersion, err := configClient.ConfigV1().ClusterVersions().Get(ctx, "version", metav1.GetOptions{})
+	if err == nil && clusterVersion.Status.Desired.Version != "" {
+		return fmt.Sprintf("OpenShift %s", clusterVersion.Status.Desired.Version), nil
+	}
+	klog.V(4).Infof("failed to get OpenShift cluster version, falling back to Kubernetes version: %v", err)
+
+	if err := i.checkKubeClient(); err != nil {
+		return "", err
+	}
+	serverVersion, err := i.kubeClient().Discovery().ServerVersion()
+	if err != nil {
+		return "", fmt.Errorf("failed to get cluster version: %+v", err)
+	}
+	return fmt.Sprintf("Kubernetes %s", serverVersion.GitVersion), nil
+}
+
+// API group served only by OpenShift clusters
+const openshiftConfigGroup = "config.openshift.io"
+
+// EnsureOpenShift returns an error if RequireOpenShift is set and the cluster doesn't serve the config.openshift.io API group
+func (i *InstallAppStudio) EnsureOpenShift(ctx context.Context) error {
+	if !i.RequireOpenShift {
+		return nil
+	}
+	if err := i.checkKubeClient(); err != nil {
+		return err
+	}
+
+	groups, err := i.kubeClient().Discovery().ServerGroups()
+	if err != nil {
+		return fmt.Errorf("failed to discover API groups of the cluster: %+v", err)
+	}
+	for _, group := range groups.Groups {
+		if group.Name == openshiftConfigGroup {
+			return nil
+		}
+	}
+	return fmt.Errorf("the cluster is not OpenShift (API group %s is not served), but the installation requires OpenShift; unset RequireOpenShift to install anyway", openshiftConfigGroup)
+}
+
+func (i *InstallAppStudio) setInstallationEnvironments() {
+	if i.NoFork {
+		// The bootstrap script works with the cloned repository instead of a personal fork
+		i.setInstallationEnv("MY_GITHUB_ORG", i.InfraDeploymentsOrganizationName)
+		i.setInstallationEnv("MY_GIT_FORK_REMOTE", i.cloneRemoteName())
+	} else {
+		i.setInstallationEnv("MY_GITHUB_ORG", i.LocalGithubForkOrganization)
+		i.setInstallationEnv("MY_GIT_FORK_REMOTE", i.LocalForkName)
+	}
+	i.setInstallationEnv("MY_GIT_BRANCH", i.gitOpsTrackBranch())
+	i.setInstallationEnv("MY_GITHUB_TOKEN", i.githubToken())
+	i.setInstallationEnv("TEST_BRANCH_ID", util.GenerateRandomString(4))
+	// With KeepQuayTokenOutOfEnv the token is not exported to other child processes, the bootstrap script gets it in
+	// its own environment. The environment of the installer is left as it is
+	if !i.KeepQuayTokenOutOfEnv {
+		i.setInstallationEnv("QUAY_TOKEN", i.QuayToken)
+	}
+	i.setInstallationEnv("IMAGE_CONTROLLER_QUAY_ORG", i.DefaultImageQuayOrg)
+	i.setInstallationEnv("IMAGE_CONTROLLER_QUAY_TOKEN", i.DefaultImageQuayOrgOAuth2Token)
+	i.setInstallationEnv("BUILD_SERVICE_IMAGE_TAG_EXPIRATION", i.DefaultImageTagExpiration)
+	i.setInstallationEnv("PAC_GITHUB_APP_ID", utils.GetEnv("E2E_PAC_GITHUB_APP_ID", ""))
+	i.setInstallationEnv("PAC_GITHUB_APP_PRIVATE_KEY", utils.GetEnv("E2E_PAC_GITHUB_APP_PRIVATE_KEY", ""))
+	i.setInstallationEnv(constants.ENABLE_SCHEDULING_ON_MASTER_NODES_ENV, i.EnableSchedulingOnMasterNodes)
+	if i.AppsDomain != "" {
+		i.setInstallationEnv("APPS_DOMAIN", i.AppsDomain)
+	}
+	if proxyURL, err := i.oauthRedirectProxyURL(); err != nil {
+		klog.Warningf("not setting OAUTH_REDIRECT_PROXY_URL: %+v", err)
+	} else if proxyURL != "" {
+		i.setInstallationEnv("OAUTH_REDIRECT_PROXY_URL", proxyURL)
+	}
+	klog.V(1).InfoS("exported installation environment", "environment", i.Result().Environment)
+}
+
+// gitOpsTrackBranch returns the branch tracked by the GitOps of the bootstrap, InfraDeploymentsBranch if GitOpsTrackBranch is not set
+func (i *InstallAppStudio) gitOpsTrackBranch() string {
+	if i.GitOpsTrackBranch != "" {
+		return i.GitOpsTrackBranch
+	}
+	return i.InfraDeploymentsBranch
+}
+
+// Installation envs holding credentials, their values are redacted in InstallResult.Environment
+var secretInstallationEnvs = []string{"MY_GITHUB_TOKEN", "QUAY_TOKEN", "IMAGE_CONTROLLER_QUAY_TOKEN", "PAC_GITHUB_APP_PRIVATE_KEY"}
+
+const redactedEnvValue = "<redacted>"
+
+// setInstallationEnv exports the env for the bootstrap script and records it in the result of the installation
+func (i *InstallAppStudio) setInstallationEnv(name, value string) {
+	os.Setenv(name, value)
+	if value != "" && slices.Contains(secretInstallationEnvs, name) {
+		value = redactedEnvValue
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.result.Environment == nil {
+		i.result.Environment = map[string]string{}
+	}
+	i.result.Environment[name] = value
+}
+
+// oauthRedirectProxyURL returns the OAUTH_REDIRECT_PROXY_URL env or, when it is not set, the URL of the SPI OAuth route
+// in AppsDomain. An empty string is returned if neither is set. The env can be a template referring to the apps domain
+// of the cluster and the namespace of the SPI OAuth route, e.g. https://spi-oauth-{{.Namespace}}.{{.AppsDomain}}
+func (i *InstallAppStudio) oauthRedirectProxyURL() (string, error) {
+	namespace, name := i.spiOAuthRoute()
+	proxyURL := os.Getenv("OAUTH_REDIRECT_PROXY_URL")
+	if proxyURL == "" {
+		if i.AppsDomain == "" {
+			return "", nil
+		}
+		return fmt.Sprintf("https://%s-%s.%s", name, namespace, i.AppsDomain), nil
+	}
+
+	tmpl, err := template.New("OAUTH_REDIRECT_PROXY_URL").Parse(proxyURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse OAUTH_REDIRECT_PROXY_URL template %q: %+v", proxyURL, err)
+	}
+	if strings.Contains(proxyURL, ".AppsDomain") && i.AppsDomain == "" {
+		return "", fmt.Errorf("OAUTH_REDIRECT_PROXY_URL %q refers to the apps domain, but it is not set", proxyURL)
+	}
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, struct{ AppsDomain, Namespace string }{i.AppsDomain, namespace}); err != nil {
+		return "", fmt.Errorf("failed to render OAUTH_REDIRECT_PROXY_URL template %q: %+v", proxyURL, err)
+	}
+
+	parsed, err := url.Parse(rendered.String())
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("OAUTH_REDIRECT_PROXY_URL %q is not a valid http(s) URL", rendered.String())
+	}
+	return rendered.String(), nil
+}
+
+// spiOAuthRoute returns the namespace and name of the route of the SPI OAuth service
+func (i *InstallAppStudio) spiOAuthRoute() (string, string) {
+	namespace, name := i.SPIOAuthRouteNamespace, i.SPIOAuthRouteName
+	if namespace == "" {
+		namespace = spiNamespace
+	}
+	if name == "" {
+		name = defaultSPIOAuthRouteName
+	}
+	return namespace, name
+}
+
+func (i *InstallAppStudio) cloneInfraDeployments(ctx context.Context) error {
+	if i.InfraDeploymentsTarball != "" {
+		if i.FailIfCloneExists {
+			if _, err := os.Stat(i.InfraDeploymentsCloneDir); err == nil {
+				return fmt.Errorf("clone directory %s already exists; remove it or unset FailIfCloneExists", i.InfraDeploymentsCloneDir)
+			}
+		}
+		return extractTarball(i.InfraDeploymentsTarball, i.InfraDeploymentsCloneDir)
+	}
+
+	url := fmt.Sprintf("https://github.com/%s/infra-deployments", i.InfraDeploymentsOrganizationName)
+	if i.cloneURL != "" {
+		url = i.cloneURL
+	}
+	if i.FailIfCloneExists {
+		// Resuming the clone would also force a checkout, so any existing directory is rejected
+		if _, err := os.Stat(i.InfraDeploymentsCloneDir); err == nil {
+			return fmt.Errorf("clone directory %s already exists; remove it or unset FailIfCloneExists", i.InfraDeploymentsCloneDir)
+		}
+	}
+
+	// The credentials are resolved only once the clone is going to happen, since they may mint a GitHub App token
+	var auth transport.AuthMethod
+	appAuth, err := i.cloneAuth(ctx)
+	if err != nil {
+		return err
+	}
+	if appAuth != nil {
+		auth = appAuth
+	}
+
+	repo, err := i.cloneFrom(ctx, url, auth)
+	for _, mirror := range i.MirrorURLs {
+		if err == nil {
+			break
+		}
+		klog.Warningf("failed to clone infra-deployments, trying mirror %s: %+v", mirror, err)
+		// The credentials are meant for GitHub, they are not sent to the mirrors
+		repo, err = i.cloneFrom(ctx, mirror, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	if i.InfraDeploymentsCommit != "" {
+		if err := checkoutCommit(repo, i.InfraDeploymentsCommit); err != nil {
+			return err
+		}
+	}
+
+	if i.VerifyForkRelated && !i.NoFork {
+		if err := i.verifyForkRelated(ctx); err != nil {
+			return err
+		}
+	}
+	if err := i.configureRemotes(ctx, repo); err != nil {
+		return err
+	}
+	if err := i.configureCommitter(repo); err != nil {
+		return err
+	}
+	if i.InfraDeploymentsCommit != "" {
+		klog.Infof("infra-deployments is pinned to commit %s, not rebasing it on upstream main", i.InfraDeploymentsCommit)
+	} else if err := i.rebaseOnUpstream(ctx, repo); err != nil {
+		return err
+	}
+
+	if i.AfterCloneHook != nil {
+		if err := i.AfterCloneHook(repo); err != nil {
+			return fmt.Errorf("after clone hook failed: %+v", err)
+		}
+	}
+
+	return nil
+}
+
+// splitList splits a comma-separated list, ignoring empty items
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// resolveBranch returns the first of the branches which exists in the remote repository
+func resolveBranch(ctx context.Context, url string, auth transport.AuthMethod, branches []string) (string, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{Name: "origin", URLs: []string{url}})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", fmt.Errorf("failed to list references of %s: %+v", url, err)
+	}
+	existing := make(map[plumbing.ReferenceName]bool, len(refs))
+	for _, ref := range refs {
+		existing[ref.Name()] = true
+	}
+
+	for n, branch := range branches {
+		if existing[plumbing.NewBranchReferenceName(branch)] {
+			if n > 0 {
+				klog.Warningf("branch %s doesn't exist in %s, using fallback branch %s", branches[0], url, branch)
+			}
+			return branch, nil
+		}
+	}
+
+	return "", fmt.Errorf("none of the branches %s exist in %s", strings.Join(branches, ", "), url)
+}
+
+// cloneFrom clones infra-deployments from the URL, using the first of the branches which exists there
+func (i *InstallAppStudio) cloneFrom(ctx context.Context, url string, auth transport.AuthMethod) (*git.Repository, error) {
+	branch := i.InfraDeploymentsBranch
+	if len(i.BranchFallbacks) > 0 {
+		var err error
+		if branch, err = resolveBranch(ctx, url, auth, append([]string{i.InfraDeploymentsBranch}, i.BranchFallbacks...)); err != nil {
+			return nil, err
+		}
+	}
+	refName := plumbing.NewBranchReferenceName(branch)
+	klog.Infof("cloning '%s' with git ref '%s'", url, refName)
+
+	options := i.cloneOptions(url, refName)
+	options.Auth = auth
+	repo, err := i.cloneWithRetry(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("cloned infra-deployments from %s", url)
+
+	return repo, nil
+}
+
+// rebaseOnUpstream rebases the cloned branch on upstream main. The history of a shallow clone of a fork usually
+// ends before the merge base with upstream main, so the full history of the fork is fetched for the rebase first
+func (i *InstallAppStudio) rebaseOnUpstream(ctx context.Context, repo *git.Repository) error {
+	shallow, err := repo.Storer.Shallow()
+	if err != nil {
+		return fmt.Errorf("failed to read the shallow commits of %s: %+v", i.InfraDeploymentsCloneDir, err)
+	}
+	if remote := i.cloneRemoteName(); len(shallow) > 0 && remote != "upstream" {
+		klog.Infof("fetching the full history of the shallow clone from %s to rebase it on upstream main", remote)
+		if err := i.commandRunner().Run(ctx, Command{Name: "git", Args: []string{"fetch", "--unshallow", remote}, Dir: i.InfraDeploymentsCloneDir}); err != nil {
+			return fmt.Errorf("failed to fetch the full history of infra-deployments: %+v", err)
+		}
+	}
+
+	if err := i.commandRunner().Run(ctx, Command{Name: "git", Args: []string{"pull", "--rebase", "upstream", "main"}, Dir: i.InfraDeploymentsCloneDir}); err != nil {
+		return fmt.Errorf("failed to rebase infra-deployments on upstream main: %+v", err)
+	}
+	return nil
+}
+
+// cloneOptions returns the options for cloning infra-deployments. All branches are cloned with full history by default,
+// a shallow single branch clone is used only with CloneDepth and when no commit is pinned, since the pinned commit can
+// be anywhere in the history.
+func (i *InstallAppStudio) cloneOptions(url string, refName plumbing.ReferenceName) *git.CloneOptions {
+	options := &git.CloneOptions{
+		URL:           url,
+		ReferenceName: refName,
+		Progress:      os.Stdout,
+		RemoteName:    i.cloneRemoteName(),
+		SingleBranch:  i.CloneDepth > 0,
+		Depth:         i.CloneDepth,
+	}
+
+	if i.InfraDeploymentsCommit != "" {
+		if i.CloneDepth > 0 {
+			klog.Infof("ignoring clone depth %d to be able to checkout commit %s", i.CloneDepth, i.InfraDeploymentsCommit)
+		}
+		options.SingleBranch = false
+		options.Depth = 0
+	}
+
+	return options
+}
+
+// checkoutCommit checks out the given commit (in detached HEAD)
+func checkoutCommit(repo *git.Repository, commit string) error {
+	hash, err := repo.ResolveRevision(plumbing.Revision(commit))
+	if err != nil {
+		return fmt.Errorf("failed to find commit %s: %+v", commit, err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if err := worktree.Checkout(&git.CheckoutOptions{Hash: *hash, Force: true}); err != nil {
+		return fmt.Errorf("failed to checkout commit %s: %+v", commit, err)
+	}
+	klog.Infof("checked out commit %s", hash)
+
+	return nil
+}
+
+// isolateCloneDir appends a unique run id to InfraDeploymentsCloneDir when IsolateCloneDir is set.
+// TEST_BRANCH_ID is used as the run id if it exists.
+func (i *InstallAppStudio) isolateCloneDir() {
+	if !i.IsolateCloneDir || i.runID != "" {
+		return
+	}
+
+	i.runID = utils.GetEnv("TEST_BRANCH_ID", strings.ToLower(util.GenerateRandomString(8)))
+	i.InfraDeploymentsCloneDir = fmt.Sprintf("%s-%s", i.InfraDeploymentsCloneDir, i.runID)
+	klog.Infof("using isolated clone directory %s", i.InfraDeploymentsCloneDir)
+}
+
+// cloneRemoteName returns the name of the remote the infra-deployments repository is cloned from
+func (i *InstallAppStudio) cloneRemoteName() string {
+	if i.InfraDeploymentsOrganizationName == "redhat-appstudio" {
+		return "upstream"
+	}
+	return "fork"
+}
+
+// CheckForkFreshness reports how many commits of upstream main are missing in the cloned branch of infra-deployments.
+// A warning is logged when the branch is behind more than ForkFreshnessThreshold commits.
+func (i *InstallAppStudio) CheckForkFreshness(ctx context.Context) (int, error) {
+	fetch := exec.CommandContext(ctx, "git", "fetch", "upstream", "main") // #nosec G204
+	fetch.Dir = i.InfraDeploymentsCloneDir
+	if out, err := fetch.CombinedOutput(); err != nil {
+		return 0, fmt.Errorf("failed to fetch upstream main: %+v: %s", err, out)
+	}
+
+	branch := fmt.Sprintf("%s/%s", i.cloneRemoteName(), i.InfraDeploymentsBranch)
+	revList := exec.CommandContext(ctx, "git", "rev-list", "--count", fmt.Sprintf("%s..upstream/main", branch)) // #nosec G204
+	revList.Dir = i.InfraDeploymentsCloneDir
+	out, err := revList.Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to compare %s with upstream/main: %+v", branch, err)
+	}
+
+	behindBy, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return 0, fmt.Errorf("unexpected output of git rev-list '%s': %+v", out, err)
+	}
+	if behindBy > i.ForkFreshnessThreshold {
+		klog.Warningf("branch %s is %d commits behind upstream/main", branch, behindBy)
+	}
+
+	return behindBy, nil
+}
+
+// upstreamURL returns the URL of upstream infra-deployments
+func (i *InstallAppStudio) upstreamURL() string {
+	if i.upstreamRemoteURL != "" {
+		return i.upstreamRemoteURL
+	}
+	return upstreamInfraDeploymentsURL
+}
+
+// configureRemotes adds the upstream remote (when cloning from a fork) and the fork remotes to the cloned repository
+func (i *InstallAppStudio) configureRemotes(ctx context.Context, repo *git.Repository) error {
+	if i.InfraDeploymentsOrganizationName != "redhat-appstudio" {
+		if err := i.ensureRemote(ctx, repo, "upstream", i.upstreamURL()); err != nil {
+			return err
+		}
+	}
+
+	if i.NoFork {
+		return nil
+	}
+
+	forkRemotes, names := i.forkRemotes()
+	for _, name := range names {
+		fetchURL, pushURLs := forkRemotes[name], []string(nil)
+		if i.ForkFetchFromUpstream {
+			fetchURL, pushURLs = i.upstreamURL(), []string{forkRemotes[name]}
+		}
+		if err := i.ensureRemote(ctx, repo, name, fetchURL); err != nil {
+			return fmt.Errorf("failed to configure remote %s: %+v", name, err)
+		}
+		if err := setRemotePushURLs(repo, name, pushURLs); err != nil {
+			return fmt.Errorf("failed to configure remote %s: %+v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// configureCommitter sets the user of the clone's config to GitAuthorName and GitAuthorEmail, so that both go-git
+// and the git CLI can create commits in the clone
+func (i *InstallAppStudio) configureCommitter(repo *git.Repository) error {
+	name, email := i.GitAuthorName, i.GitAuthorEmail
+	if name == "" {
+		name = defaultGitAuthorName
+	}
+	if email == "" {
+		email = defaultGitAuthorEmail
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("failed to read config of the infra-deployments clone: %+v", err)
+	}
+	cfg.User.Name, cfg.User.Email = name, email
+	if err := repo.SetConfig(cfg); err != nil {
+		return fmt.Errorf("failed to set committer identity of the infra-deployments clone: %+v", err)
+	}
+
+	return nil
+}
+
+// forkRemotes returns the URLs of the fork remotes by remote name, and the sorted remote names
+func (i *InstallAppStudio) forkRemotes() (map[string]string, []string) {
+	forkRemotes := i.ForkRemotes
+	if len(forkRemotes) == 0 {
+		forkRemotes = map[string]string{i.LocalForkName: fmt.Sprintf("https://github.com/%s/infra-deployments.git", i.LocalGithubForkOrganization)}
+	}
+	names := make([]string, 0, len(forkRemotes))
+	for name := range forkRemotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return forkRemotes, names
+}
+
+// setRemotePushURLs sets the push URLs of the remote, the remote pushes to its fetch URL when there are none.
+// go-git doesn't model push URLs, they are kept in the raw git config of the remote
+func setRemotePushURLs(repo *git.Repository, name string, urls []string) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("failed to read git config: %+v", err)
+	}
+	remote := cfg.Raw.Section("remote").Subsection(name)
+	if slices.Equal(remote.Options.GetAll("pushurl"), urls) {
+		return nil
+	}
+	if len(urls) == 0 {
+		remote.RemoveOption("pushurl")
+	} else {
+		remote.SetOption("pushurl", urls...)
+	}
+	if err := repo.SetConfig(cfg); err != nil {
+		return fmt.Errorf("failed to write git config: %+v", err)
+	}
+	return nil
+}
+
+// cloneWithRetry clones infra-deployments, retrying failed attempts with exponential backoff
+func (i *InstallAppStudio) cloneWithRetry(ctx context.Context, options *git.CloneOptions) (*git.Repository, error) {
+	var err error
+	for attempt := 0; attempt <= i.CloneRetries; attempt++ {
+		if attempt > 0 {
+			if budgetErr := i.spendRetry(); budgetErr != nil {
+				return nil, fmt.Errorf("%w; last error: %+v", budgetErr, err)
 			}
-			_, err = i.KubernetesClient.KubeInterface().CoreV1().Secrets(namespace).Update(context.Background(), secret, metav1.UpdateOptions{})
+			backoff := i.cloneBackoff(attempt)
+			klog.Infof("got an error: %+v - will retry in %v", err, backoff)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+
+		var repo *git.Repository
+		if repo, err = cloneOrResume(i.InfraDeploymentsCloneDir, options); err == nil {
+			return repo, nil
+		}
+	}
+
+	return nil, err
+}
+
+// cloneBackoff returns the delay before the given retry attempt. With CloneBackoffJitter the delay is randomized
+// over the whole interval (full jitter), so parallel runs don't retry at the same time.
+func (i *InstallAppStudio) cloneBackoff(attempt int) time.Duration {
+	backoff := cloneRetryBaseDelay << (attempt - 1)
+	if backoff > cloneRetryMaxDelay || backoff <= 0 {
+		backoff = cloneRetryMaxDelay
+	}
+	if !i.CloneBackoffJitter {
+		return backoff
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.rand == nil {
+		i.rand = rand.New(rand.NewSource(time.Now().UnixNano())) // #nosec G404
+	}
+	return time.Duration(i.rand.Int63n(int64(backoff) + 1))
+}
+
+// cloneOrResume clones the repository into the given directory. When the directory already contains
+// a clone of the same repository (e.g. from an interrupted run), it tries to complete it with a fetch + checkout
+// and only falls back to removing the directory and cloning again if that fails.
+func cloneOrResume(dir string, options *git.CloneOptions) (*git.Repository, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		repo, err := resumeClone(dir, options)
+		if err == nil {
+			klog.Infof("resumed existing clone in %s", dir)
+			return repo, nil
+		}
+		klog.Warningf("failed to resume existing clone in %s: %+v", dir, err)
+	}
+
+	dirInfo, err := os.Stat(dir)
+	if !os.IsNotExist(err) && dirInfo.IsDir() {
+		klog.Warningf("folder %s already exists... removing", dir)
+
+		err := os.RemoveAll(dir)
+		if err != nil {
+			return nil, fmt.Errorf("error removing %s folder", dir)
+		}
+	}
+
+	repo, err := git.PlainClone(dir, false, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone %s: %+v", options.URL, err)
+	}
+
+	return repo, nil
+}
+
+// resumeClone fetches the missing objects of an existing clone and checks out the requested branch
+func resumeClone(dir string, options *git.CloneOptions) (*git.Repository, error) {
+	remoteName, refName := options.RemoteName, options.ReferenceName
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := repo.Remote(remoteName)
+	if err != nil {
+		return nil, err
+	}
+	if urls := remote.Config().URLs; len(urls) == 0 || urls[0] != options.URL {
+		return nil, fmt.Errorf("remote %s points to %v instead of %s", remoteName, urls, options.URL)
+	}
+
+	if err := repo.Fetch(&git.FetchOptions{RemoteName: remoteName, Depth: options.Depth, Auth: options.Auth, Progress: options.Progress}); err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil, fmt.Errorf("failed to fetch from %s: %+v", remoteName, err)
+	}
+
+	remoteRef, err := repo.Reference(plumbing.NewRemoteReferenceName(remoteName, refName.Short()), true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find %s in remote %s: %+v", refName, remoteName, err)
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(refName, remoteRef.Hash())); err != nil {
+		return nil, err
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	if err := worktree.Checkout(&git.CheckoutOptions{Branch: refName, Force: true}); err != nil {
+		return nil, fmt.Errorf("failed to checkout %s: %+v", refName, err)
+	}
+
+	return repo, nil
+}
+
+// How many times creating a git remote is attempted and how long to wait between the attempts
+var (
+	createRemoteAttempts   = 3
+	createRemoteRetryDelay = time.Second
+)
+
+// remoteRepository is the subset of git.Repository used for configuring remotes
+type remoteRepository interface {
+	Remote(name string) (*git.Remote, error)
+	DeleteRemote(name string) error
+	CreateRemote(c *config.RemoteConfig) (*git.Remote, error)
+}
+
+// ensureRemote makes sure the repository has the remote with the given URL. Creating the remote is retried
+// on failures; when the remote appears in the meantime it is reconciled to the URL
+func (i *InstallAppStudio) ensureRemote(ctx context.Context, repo remoteRepository, name, url string) error {
+	var err error
+	for attempt := 1; attempt <= createRemoteAttempts; attempt++ {
+		if attempt > 1 {
+			if budgetErr := i.spendRetry(); budgetErr != nil {
+				return fmt.Errorf("failed to create remote %s with URL %s: %w; last error: %+v", name, url, budgetErr, err)
+			}
+			klog.Warningf("failed to create remote %s, will retry: %+v", name, err)
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("failed to create remote %s with URL %s: %w; last error: %+v", name, url, ctx.Err(), err)
+			case <-time.After(createRemoteRetryDelay):
+			}
+		}
+
+		var remote *git.Remote
+		remote, err = repo.Remote(name)
+		if err == nil {
+			if urls := remote.Config().URLs; len(urls) == 1 && urls[0] == url {
+				return nil
+			}
+			if err = repo.DeleteRemote(name); err != nil {
+				continue
+			}
+		} else if !errors.Is(err, git.ErrRemoteNotFound) {
+			continue
+		}
+
+		if _, err = repo.CreateRemote(&config.RemoteConfig{Name: name, URLs: []string{url}}); err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed to create remote %s with URL %s after %d attempts: %+v", name, url, createRemoteAttempts, err)
+}
+
+func (i *InstallAppStudio) CheckOperatorsReady() error {
+	if err := i.checkKubeClient(); err != nil {
+		return err
+	}
+	ctx := i.baseContext()
+	apiConfig, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
+	if err != nil {
+		return fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	config, err := clientcmd.NewDefaultClientConfig(*apiConfig, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return fmt.Errorf("failed to create client config: %w", err)
+	}
+	appClientset, err := appclientset.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create argocd client: %w", err)
+	}
+
+	patchPayload := []patchStringValue{{
+		Op:    "replace",
+		Path:  "/metadata/annotations/argocd.argoproj.io~1refresh",
+		Value: "hard",
+	}}
+	patchPayloadBytes, err := json.Marshal(patchPayload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal refresh patch: %w", err)
+	}
+	_, err = appClientset.ArgoprojV1alpha1().Applications("openshift-gitops").Patch(ctx, "all-application-sets", types.JSONPatchType, patchPayloadBytes, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to refresh application all-application-sets: %w", err)
+	}
+
+	for {
+		var count = 0
+		appsListFor, err := appClientset.ArgoprojV1alpha1().Applications("openshift-gitops").List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to list applications: %w", err)
+		}
+		for _, app := range appsListFor.Items {
+			fmt.Printf("Check application: %s\n", app.Name)
+			application, err := appClientset.ArgoprojV1alpha1().Applications("openshift-gitops").Get(ctx, app.Name, metav1.GetOptions{})
 			if err != nil {
-				return fmt.Errorf("error when updating secret '%s' namespace: %v", secretName, err)
+				return fmt.Errorf("failed to get application %s: %w", app.Name, err)
+			}
+
+			if !(application.Status.Sync.Status == "Synced" && application.Status.Health.Status == "Healthy") {
+				klog.Infof("Application %s not ready", app.Name)
+				count++
+			} else if strings.Contains(application.String(), ("context deadline exceeded")) {
+				fmt.Printf("Refreshing Application %s\n", app.Name)
+				patchPayload := []patchStringValue{{
+					Op:    "replace",
+					Path:  "/metadata/annotations/argocd.argoproj.io~1refresh",
+					Value: "soft",
+				}}
+
+				patchPayloadBytes, err := json.Marshal(patchPayload)
+				if err != nil {
+					return fmt.Errorf("failed to marshal refresh patch: %w", err)
+				}
+				for _, app := range appsListFor.Items {
+					_, err = i.kubeClient().AppsV1().Deployments("openshift-gitops").Patch(ctx, app.Name, types.JSONPatchType, patchPayloadBytes, metav1.PatchOptions{})
+					if err != nil {
+						return fmt.Errorf("failed to refresh application %s: %w", app.Name, err)
+					}
+				}
 			}
 		}
+
+		if count == 0 {
+			klog.Info("All Application are ready\n")
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Second):
+		}
+	}
+}
+
+// PatchConfigMapAndRestart merges data into the given configmap and triggers a rollout restart of the deployment
+// which consumes it, so the new configuration is picked up.
+func (i *InstallAppStudio) PatchConfigMapAndRestart(ctx context.Context, namespace, configMap, deployment string, data map[string]string) error {
+	if err := i.checkKubeClient(); err != nil {
+		return err
+	}
+	current, err := i.kubeClient().CoreV1().ConfigMaps(namespace).Get(ctx, configMap, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get configmap %s/%s: %+v", namespace, configMap, err)
+	}
+	if mapContains(current.Data, data) {
+		klog.Infof("configmap %s/%s is already configured", namespace, configMap)
+		return nil
+	}
+	if i.DryRun {
+		klog.Infof("dry run: configmap %s/%s would be changed and deployment %s restarted:\n%s", namespace, configMap, deployment, strings.Join(configMapDataDiff(current.Data, data), "\n"))
+		return nil
+	}
+
+	configMapPatch, err := json.Marshal(map[string]interface{}{"data": data})
+	if err != nil {
+		return fmt.Errorf("failed to marshal patch for configmap %s/%s: %+v", namespace, configMap, err)
+	}
+	// The API server may still be settling after the bootstrap, a missing configmap fails right away though
+	retriable := func(err error) bool { return isTransientAPIError(err) || k8sErrors.IsConflict(err) }
+	err = i.retryOnAPIErrors(ctx, transientErrorRetryTimeout, retriable, func(ctx context.Context) error {
+		_, err := i.kubeClient().CoreV1().ConfigMaps(namespace).Patch(ctx, configMap, types.MergePatchType, configMapPatch, metav1.PatchOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to patch configmap %s/%s: %+v", namespace, configMap, err)
+	}
+
+	return i.restartDeployment(ctx, namespace, deployment)
+}
+
+// mapContains returns true if all desired keys are present in the current map (e.g. configmap data) with the desired values
+func mapContains(current, desired map[string]string) bool {
+	for key, value := range desired {
+		if currentValue, ok := current[key]; !ok || currentValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// configMapDataDiff describes the keys which would be added ("+") or changed ("~") by applying the desired data
+func configMapDataDiff(current, desired map[string]string) []string {
+	keys := make([]string, 0, len(desired))
+	for key := range desired {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var diff []string
+	for _, key := range keys {
+		currentValue, ok := current[key]
+		switch {
+		case !ok:
+			diff = append(diff, fmt.Sprintf("+ %s: %s", key, desired[key]))
+		case currentValue != desired[key]:
+			diff = append(diff, fmt.Sprintf("~ %s: %s -> %s", key, currentValue, desired[key]))
+		}
+	}
+	return diff
+}
+
+// restartDeployment does the same as 'kubectl rollout restart': it bumps an annotation in the pod template
+func (i *InstallAppStudio) restartDeployment(ctx context.Context, namespace, deployment string) error {
+	restartPatch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{"kubectl.kubernetes.io/restartedAt":"%s"}}}}}`, time.Now().Format(time.RFC3339))
+	if _, err := i.kubeClient().AppsV1().Deployments(namespace).Patch(ctx, deployment, types.MergePatchType, []byte(restartPatch), metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("failed to restart deployment %s/%s: %+v", namespace, deployment, err)
+	}
+	klog.Infof("restarted deployment %s/%s", namespace, deployment)
+
+	if i.RestartReadinessTimeout == 0 {
+		return nil
+	}
+	return i.WaitForDeploymentReady(ctx, namespace, deployment, i.RestartReadinessTimeout)
+}
+
+// restConfig returns the config of the cluster from the default kubeconfig, with the impersonation settings applied
+func (i *InstallAppStudio) restConfig() (*rest.Config, error) {
+	if i.ImpersonateUser != "" && i.ImpersonateServiceAccount != "" {
+		return nil, fmt.Errorf("only one of ImpersonateUser and ImpersonateServiceAccount can be set")
+	}
+
+	kubeconfig, err := getRestConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if i.ImpersonateUser != "" {
+		kubeconfig.Impersonate = rest.ImpersonationConfig{UserName: i.ImpersonateUser}
+	}
+	if i.ImpersonateServiceAccount != "" {
+		namespace, name, found := strings.Cut(i.ImpersonateServiceAccount, "/")
+		if !found || namespace == "" || name == "" {
+			return nil, fmt.Errorf("service account to impersonate '%s' is not in the '<namespace>/<name>' format", i.ImpersonateServiceAccount)
+		}
+		kubeconfig.Impersonate = rest.ImpersonationConfig{UserName: fmt.Sprintf("system:serviceaccount:%s:%s", namespace, name)}
+	}
+	if kubeconfig.Impersonate.UserName != "" {
+		klog.Infof("impersonating '%s' during the installation", kubeconfig.Impersonate.UserName)
+	}
+
+	if i.KubeCABundlePath != "" && i.KubeInsecureSkipTLSVerify {
+		return nil, fmt.Errorf("only one of KubeCABundlePath and KubeInsecureSkipTLSVerify can be set")
+	}
+	if i.KubeCABundlePath != "" {
+		caBundle, err := os.ReadFile(filepath.Clean(i.KubeCABundlePath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle %s: %+v", i.KubeCABundlePath, err)
+		}
+		kubeconfig.TLSClientConfig.CAFile = ""
+		kubeconfig.TLSClientConfig.CAData = caBundle
+	}
+	if i.KubeInsecureSkipTLSVerify {
+		klog.Warningf("!!! TLS verification of the API server %s is DISABLED, the connection is not secure !!!", kubeconfig.Host)
+		// client-go refuses insecure configs with a CA
+		kubeconfig.TLSClientConfig.Insecure = true
+		kubeconfig.TLSClientConfig.CAFile = ""
+		kubeconfig.TLSClientConfig.CAData = nil
+	}
+
+	return kubeconfig, nil
+}
+
+// Returned by the methods which need a cluster connection when InstallAppStudio was not created by NewAppStudioInstallController
+var errKubernetesClientNotInitialized = errors.New("kubernetes client not initialized")
+
+// checkKubeClient returns an error when there is no client for kubeClient
+func (i *InstallAppStudio) checkKubeClient() error {
+	if i.clientset == nil && i.KubernetesClient == nil {
+		return errKubernetesClientNotInitialized
+	}
+	return nil
+}
+
+// checkKubeRest returns an error when there is no client for kubeRest
+func (i *InstallAppStudio) checkKubeRest() error {
+	if i.crClient == nil && i.KubernetesClient == nil {
+		return errKubernetesClientNotInitialized
+	}
+	return nil
+}
+
+func (i *InstallAppStudio) kubeClient() kubernetes.Interface {
+	if i.clientset != nil {
+		return i.clientset
+	}
+	return i.KubernetesClient.KubeInterface()
+}
+
+// configClient returns a client for the config.openshift.io API group
+func (i *InstallAppStudio) configClient() (configv1client.Interface, error) {
+	if i.openshiftConfigClient != nil {
+		return i.openshiftConfigClient, nil
+	}
+
+	kubeconfig, err := i.restConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error when getting config: %+v", err)
+	}
+	configClient, err := configv1client.NewForConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("error when creating configv1client: %+v", err)
+	}
+	return configClient, nil
+}
+
+func (i *InstallAppStudio) kubeRest() crclient.Client {
+	if i.crClient != nil {
+		return i.crClient
+	}
+	return i.KubernetesClient.KubeRest()
+}
+
+// ensureNamespace creates the namespace if it doesn't exist and makes sure it has the labels and annotations.
+// Other labels and annotations of an existing namespace are kept. A terminating namespace is recreated once it's deleted.
+func (i *InstallAppStudio) ensureNamespace(ctx context.Context, name string, labels, annotations map[string]string) error {
+	if err := i.checkKubeClient(); err != nil {
+		return err
+	}
+
+	var ns *corev1.Namespace
+	err := i.retryOnTransientAPIErrors(ctx, transientErrorRetryTimeout, func(ctx context.Context) error {
+		var err error
+		ns, err = i.kubeClient().CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	// Nothing can be created in a namespace being deleted, e.g. by a previous uninstall, so wait until it's gone
+	if err == nil && ns.Status.Phase == corev1.NamespaceTerminating {
+		klog.Warningf("namespace %s is terminating, waiting for its deletion", name)
+		if err := i.WaitForNamespaceTerminated(ctx, name, namespaceTerminationTimeout); err != nil {
+			return fmt.Errorf("namespace %s is stuck in the Terminating phase, check its finalizers and remaining resources: %+v", name, err)
+		}
+		err = k8sErrors.NewNotFound(corev1.Resource("namespaces"), name)
+	}
+	if err != nil {
+		if !k8sErrors.IsNotFound(err) {
+			return fmt.Errorf("error when getting namespace %s : %v", name, err)
+		}
+		_, err := i.kubeClient().CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Labels:      labels,
+				Annotations: annotations,
+			},
+		}, metav1.CreateOptions{})
+		if err == nil {
+			return nil
+		}
+		if k8sErrors.IsForbidden(err) {
+			return fmt.Errorf("error when creating namespace %s : %v; %s", name, err, forbiddenGuidance(err))
+		}
+		if !k8sErrors.IsAlreadyExists(err) {
+			return fmt.Errorf("error when creating namespace %s : %v", name, err)
+		}
+		// Created in the meantime by someone else, its metadata is reconciled below
+		if ns, err = i.kubeClient().CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{}); err != nil {
+			return fmt.Errorf("error when getting namespace %s : %v", name, err)
+		}
+	}
+
+	if mapContains(ns.Labels, labels) && mapContains(ns.Annotations, annotations) {
+		return nil
+	}
+	if ns.Labels == nil && len(labels) > 0 {
+		ns.Labels = map[string]string{}
+	}
+	for key, value := range labels {
+		ns.Labels[key] = value
+	}
+	if ns.Annotations == nil && len(annotations) > 0 {
+		ns.Annotations = map[string]string{}
+	}
+	for key, value := range annotations {
+		ns.Annotations[key] = value
+	}
+	if _, err := i.kubeClient().CoreV1().Namespaces().Update(ctx, ns, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("error when updating metadata of namespace %s : %v", name, err)
+	}
+	klog.Infof("updated metadata of namespace %s", name)
+
+	return nil
+}
+
+var (
+	exceededQuotaRegexp   = regexp.MustCompile(`exceeded quota: ([^,\s]+)`)
+	deniedByWebhookRegexp = regexp.MustCompile(`admission webhook "([^"]+)" denied the request`)
+)
+
+// forbiddenGuidance describes what to check when the API server rejected a request as forbidden:
+// the exceeded quota, the denying admission webhook or the permissions of the installer
+func forbiddenGuidance(err error) string {
+	if match := exceededQuotaRegexp.FindStringSubmatch(err.Error()); match != nil {
+		return fmt.Sprintf("the quota %s is exceeded, raise it or delete unused resources (for OpenShift cluster quotas see 'oc get clusterresourcequota %s')", match[1], match[1])
+	}
+	if match := deniedByWebhookRegexp.FindStringSubmatch(err.Error()); match != nil {
+		return fmt.Sprintf("the request was denied by the admission webhook %s, check its policy and the validating/mutating webhook configurations of the cluster", match[1])
+	}
+	return "the installer is not allowed to do it, check the RBAC permissions of the user or service account it runs as"
+}
+
+// quaySecretLayout returns the data key and type of the e2e quay secret. A dockerconfigjson secret requires
+// the standard key, so a secret with a custom key is created as opaque.
+func (i *InstallAppStudio) quaySecretLayout() (string, corev1.SecretType) {
+	if i.QuaySecretDataKey == "" || i.QuaySecretDataKey == corev1.DockerConfigJsonKey {
+		return corev1.DockerConfigJsonKey, corev1.SecretTypeDockerConfigJson
+	}
+	return i.QuaySecretDataKey, corev1.SecretTypeOpaque
+}
+
+func (i *InstallAppStudio) ensureE2EQuaySecret(ctx context.Context) error {
+	if i.SkipQuaySecret {
+		klog.Infof("skipping creation of the e2e quay secret")
+		return nil
+	}
+	return i.createE2EQuaySecret(ctx)
+}
+
+// Create secret in e2e-secrets which can be copied to testing namespaces
+func (i *InstallAppStudio) createE2EQuaySecret(ctx context.Context) error {
+	if err := i.checkKubeClient(); err != nil {
+		return err
+	}
+	dockerConfig, err := i.secretSource().QuayDockerConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := dockerConfigSecretData(dockerConfig); err != nil {
+		return err
+	}
+	if i.DockerConfigTransform != nil {
+		if dockerConfig, err = i.DockerConfigTransform(dockerConfig); err != nil {
+			return fmt.Errorf("failed to transform docker config of the e2e quay secret: %+v", err)
+		}
+		if _, err := dockerConfigSecretData(dockerConfig); err != nil {
+			return fmt.Errorf("transformed docker config of the e2e quay secret is invalid: %+v", err)
+		}
+	}
+	if len(dockerConfig) > maxSecretDataBytes {
+		return fmt.Errorf("docker config of the e2e quay secret is %d bytes, more than the %d bytes a Kubernetes secret can hold; remove the auths of unneeded registries from the quay token", len(dockerConfig), maxSecretDataBytes)
+	}
+	if err := i.checkRegistryCredentials(dockerConfig); err != nil {
+		return err
+	}
+	dataKey, secretType := i.quaySecretLayout()
+	secretData := map[string][]byte{dataKey: dockerConfig}
+
+	namespace := constants.QuayRepositorySecretNamespace
+	if err := i.ensureNamespace(ctx, namespace, nil, nil); err != nil {
+		return err
+	}
+	i.touchNamespace(namespace)
+
+	secretName := i.quaySecretName()
+	secret, err := i.kubeClient().CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return fmt.Errorf("error when getting secret %s : %v", secretName, err)
+	}
+	exists := err == nil
+
+	// Type of a secret is immutable, so a secret with a different type has to be recreated
+	if exists && secret.Type != secretType {
+		klog.Infof("secret %s has type %s instead of %s, recreating it", secretName, secret.Type, secretType)
+		if err := i.deleteSecretAndWait(ctx, namespace, secretName, transientErrorRetryTimeout); err != nil {
+			return err
+		}
+		exists = false
+	}
+
+	annotations := maps.Clone(i.SecretAnnotations)
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[lastRotatedAnnotation] = secretRotationTime().UTC().Format(time.RFC3339)
+
+	if !exists {
+		_, err := i.kubeClient().CoreV1().Secrets(namespace).Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        secretName,
+				Namespace:   namespace,
+				Labels:      i.SecretLabels,
+				Annotations: annotations,
+			},
+			Type: secretType,
+			Data: secretData,
+		}, metav1.CreateOptions{})
+
+		if err != nil {
+			return fmt.Errorf("error when creating secret %s : %v", secretName, err)
+		}
+		return nil
+	}
+
+	secret.Data = secretData
+	if secret.Labels == nil && len(i.SecretLabels) > 0 {
+		secret.Labels = map[string]string{}
+	}
+	for key, value := range i.SecretLabels {
+		secret.Labels[key] = value
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	maps.Copy(secret.Annotations, annotations)
+	_, err = i.kubeClient().CoreV1().Secrets(namespace).Update(ctx, secret, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("error when updating secret '%s' namespace: %v", secretName, err)
 	}
 
 	return nil
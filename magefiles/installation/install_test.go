@@ -0,0 +1,1299 @@
+package installation
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/konflux-ci/e2e-tests/pkg/constants"
+	configv1 "github.com/openshift/api/config/v1"
+	configfake "github.com/openshift/client-go/config/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestPatchConfigMapAndRestart(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "test"},
+			Data:       map[string]string{"EXISTING": "value"},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: "test"},
+		},
+	)
+	i := &InstallAppStudio{clientset: clientset}
+
+	err := i.PatchConfigMapAndRestart(context.Background(), "test", "config", "service", map[string]string{"NEW": "new-value"})
+	assert.NoError(t, err)
+
+	cm, err := clientset.CoreV1().ConfigMaps("test").Get(context.Background(), "config", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"EXISTING": "value", "NEW": "new-value"}, cm.Data)
+
+	deployment, err := clientset.AppsV1().Deployments("test").Get(context.Background(), "service", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, deployment.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"])
+}
+
+func TestPatchConfigMapAndRestartRetriesTransientErrors(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "test"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: "test"}},
+	)
+	patches := 0
+	clientset.PrependReactor("patch", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patches++
+		if patches == 1 {
+			return true, nil, k8sErrors.NewServerTimeout(corev1.Resource("configmaps"), "patch", 1)
+		}
+		return false, nil, nil
+	})
+	i := &InstallAppStudio{clientset: clientset}
+
+	assert.NoError(t, i.PatchConfigMapAndRestart(context.Background(), "test", "config", "service", map[string]string{"NEW": "new-value"}))
+	assert.Equal(t, 2, patches)
+	cm, err := clientset.CoreV1().ConfigMaps("test").Get(context.Background(), "config", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"NEW": "new-value"}, cm.Data)
+}
+
+func TestPatchConfigMapAndRestartFailsFastOnNotFound(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "test"}})
+	patches := 0
+	clientset.PrependReactor("patch", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patches++
+		return true, nil, k8sErrors.NewNotFound(corev1.Resource("configmaps"), "config")
+	})
+	i := &InstallAppStudio{clientset: clientset}
+
+	err := i.PatchConfigMapAndRestart(context.Background(), "test", "config", "service", map[string]string{"NEW": "new-value"})
+	assert.ErrorContains(t, err, "failed to patch configmap test/config")
+	assert.Equal(t, 1, patches)
+}
+
+func TestPatchConfigMapAndRestartSkipsUnchangedConfig(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "test"},
+			Data:       map[string]string{"EXISTING": "value", "NEW": "new-value"},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: "test"},
+		},
+	)
+	i := &InstallAppStudio{clientset: clientset}
+
+	err := i.PatchConfigMapAndRestart(context.Background(), "test", "config", "service", map[string]string{"NEW": "new-value"})
+	assert.NoError(t, err)
+	for _, action := range clientset.Actions() {
+		assert.NotEqual(t, "patch", action.GetVerb(), "unexpected patch of %s", action.GetResource().Resource)
+	}
+}
+
+func TestPatchConfigMapAndRestartDryRun(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "test"},
+		Data:       map[string]string{"CHANGED": "old", "KEPT": "value"},
+	})
+	i := &InstallAppStudio{clientset: clientset, DryRun: true}
+
+	err := i.PatchConfigMapAndRestart(context.Background(), "test", "config", "service", map[string]string{"NEW": "new-value", "CHANGED": "new", "KEPT": "value"})
+	assert.NoError(t, err)
+	for _, action := range clientset.Actions() {
+		assert.Equal(t, "get", action.GetVerb())
+	}
+}
+
+func TestConfigMapDataDiff(t *testing.T) {
+	diff := configMapDataDiff(map[string]string{"CHANGED": "old", "KEPT": "value"}, map[string]string{"NEW": "new-value", "CHANGED": "new", "KEPT": "value"})
+	assert.Equal(t, []string{"~ CHANGED: old -> new", "+ NEW: new-value"}, diff)
+}
+
+func TestPatchConfigMapAndRestartMissingConfigMap(t *testing.T) {
+	i := &InstallAppStudio{clientset: fake.NewSimpleClientset()}
+
+	err := i.PatchConfigMapAndRestart(context.Background(), "test", "config", "service", map[string]string{"NEW": "new-value"})
+	assert.ErrorContains(t, err, "failed to get configmap test/config")
+}
+
+// newFixtureRepo creates a local git repository with a single commit on the main branch
+func newFixtureRepo(t *testing.T) (string, *git.Repository) {
+	dir := t.TempDir()
+	repo, err := git.PlainInitWithOptions(dir, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.NewBranchReferenceName("main")},
+	})
+	assert.NoError(t, err)
+	commitFile(t, repo, dir, "README.md", "infra-deployments")
+
+	return dir, repo
+}
+
+func commitFile(t *testing.T, repo *git.Repository, dir, name, content string) plumbing.Hash {
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+	_, err = worktree.Add(name)
+	assert.NoError(t, err)
+	hash, err := worktree.Commit("update "+name, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	assert.NoError(t, err)
+
+	return hash
+}
+
+func TestCloneOrResumeCompletesExistingClone(t *testing.T) {
+	sourceDir, source := newFixtureRepo(t)
+	cloneDir := filepath.Join(t.TempDir(), "infra-deployments")
+
+	_, err := cloneOrResume(cloneDir, &git.CloneOptions{URL: sourceDir, ReferenceName: plumbing.NewBranchReferenceName("main"), RemoteName: "upstream"})
+	assert.NoError(t, err)
+	// Leave a marker which would be lost by a fresh clone
+	assert.NoError(t, os.WriteFile(filepath.Join(cloneDir, ".git", "marker"), nil, 0600))
+
+	latest := commitFile(t, source, sourceDir, "new-file", "content")
+	repo, err := cloneOrResume(cloneDir, &git.CloneOptions{URL: sourceDir, ReferenceName: plumbing.NewBranchReferenceName("main"), RemoteName: "upstream"})
+	assert.NoError(t, err)
+
+	head, err := repo.Head()
+	assert.NoError(t, err)
+	assert.Equal(t, latest, head.Hash())
+	assert.FileExists(t, filepath.Join(cloneDir, "new-file"))
+	assert.FileExists(t, filepath.Join(cloneDir, ".git", "marker"))
+}
+
+func TestCloneOrResumeFallsBackToFreshClone(t *testing.T) {
+	sourceDir, source := newFixtureRepo(t)
+	cloneDir := filepath.Join(t.TempDir(), "infra-deployments")
+	// A corrupted clone: the .git directory exists but does not contain a repository
+	assert.NoError(t, os.MkdirAll(filepath.Join(cloneDir, ".git"), 0700))
+
+	repo, err := cloneOrResume(cloneDir, &git.CloneOptions{URL: sourceDir, ReferenceName: plumbing.NewBranchReferenceName("main"), RemoteName: "upstream"})
+	assert.NoError(t, err)
+
+	head, err := repo.Head()
+	assert.NoError(t, err)
+	sourceHead, err := source.Head()
+	assert.NoError(t, err)
+	assert.Equal(t, sourceHead.Hash(), head.Hash())
+}
+
+func fakeRestConfig(t *testing.T) {
+	original := getRestConfig
+	getRestConfig = func() (*rest.Config, error) {
+		return &rest.Config{Host: "https://api.example.com:6443"}, nil
+	}
+	t.Cleanup(func() { getRestConfig = original })
+}
+
+func TestNewAppStudioInstallControllerForkName(t *testing.T) {
+	fakeRestConfig(t)
+
+	t.Setenv("MY_GIT_FORK_REMOTE", "")
+	i, err := NewAppStudioInstallController()
+	assert.NoError(t, err)
+	assert.Equal(t, DEFAULT_LOCAL_FORK_NAME, i.LocalForkName)
+
+	t.Setenv("MY_GIT_FORK_REMOTE", "my-fork")
+	i, err = NewAppStudioInstallController()
+	assert.NoError(t, err)
+	assert.Equal(t, "my-fork", i.LocalForkName)
+}
+
+func TestRestConfigTLS(t *testing.T) {
+	fakeRestConfig(t)
+	caBundle := filepath.Join(t.TempDir(), "ca.crt")
+	assert.NoError(t, os.WriteFile(caBundle, []byte("-----BEGIN CERTIFICATE-----"), 0600))
+
+	config, err := (&InstallAppStudio{}).restConfig()
+	assert.NoError(t, err)
+	assert.False(t, config.TLSClientConfig.Insecure)
+	assert.Empty(t, config.TLSClientConfig.CAData)
+
+	config, err = (&InstallAppStudio{KubeCABundlePath: caBundle}).restConfig()
+	assert.NoError(t, err)
+	assert.False(t, config.TLSClientConfig.Insecure)
+	assert.Equal(t, "-----BEGIN CERTIFICATE-----", string(config.TLSClientConfig.CAData))
+
+	config, err = (&InstallAppStudio{KubeInsecureSkipTLSVerify: true}).restConfig()
+	assert.NoError(t, err)
+	assert.True(t, config.TLSClientConfig.Insecure)
+
+	_, err = (&InstallAppStudio{KubeCABundlePath: filepath.Join(t.TempDir(), "missing.crt")}).restConfig()
+	assert.ErrorContains(t, err, "failed to read CA bundle")
+	_, err = (&InstallAppStudio{KubeCABundlePath: caBundle, KubeInsecureSkipTLSVerify: true}).restConfig()
+	assert.ErrorContains(t, err, "only one of KubeCABundlePath and KubeInsecureSkipTLSVerify can be set")
+}
+
+func TestRestConfigImpersonation(t *testing.T) {
+	fakeRestConfig(t)
+
+	config, err := (&InstallAppStudio{}).restConfig()
+	assert.NoError(t, err)
+	assert.Empty(t, config.Impersonate.UserName)
+
+	config, err = (&InstallAppStudio{ImpersonateUser: "developer"}).restConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "developer", config.Impersonate.UserName)
+
+	config, err = (&InstallAppStudio{ImpersonateServiceAccount: "konflux/installer"}).restConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "system:serviceaccount:konflux:installer", config.Impersonate.UserName)
+
+	_, err = (&InstallAppStudio{ImpersonateServiceAccount: "installer"}).restConfig()
+	assert.ErrorContains(t, err, "is not in the '<namespace>/<name>' format")
+
+	_, err = (&InstallAppStudio{ImpersonateUser: "developer", ImpersonateServiceAccount: "konflux/installer"}).restConfig()
+	assert.ErrorContains(t, err, "only one of")
+}
+
+func TestCheckForkFreshness(t *testing.T) {
+	upstreamDir, upstream := newFixtureRepo(t)
+	forkDir := t.TempDir()
+	_, err := git.PlainClone(forkDir, false, &git.CloneOptions{URL: upstreamDir})
+	assert.NoError(t, err)
+	for _, name := range []string{"first", "second", "third"} {
+		commitFile(t, upstream, upstreamDir, name, name)
+	}
+
+	i := &InstallAppStudio{
+		InfraDeploymentsCloneDir:         filepath.Join(t.TempDir(), "infra-deployments"),
+		InfraDeploymentsBranch:           "main",
+		InfraDeploymentsOrganizationName: "my-org",
+		ForkFreshnessThreshold:           1,
+	}
+	repo, err := cloneOrResume(i.InfraDeploymentsCloneDir, i.cloneOptions(forkDir, plumbing.NewBranchReferenceName("main")))
+	assert.NoError(t, err)
+	assert.NoError(t, (&InstallAppStudio{}).ensureRemote(context.Background(), repo, "upstream", upstreamDir))
+
+	behindBy, err := i.CheckForkFreshness(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, behindBy)
+}
+
+func TestIsolateCloneDir(t *testing.T) {
+	t.Setenv("TEST_BRANCH_ID", "")
+	first := &InstallAppStudio{InfraDeploymentsCloneDir: "/tmp/infra-deployments", IsolateCloneDir: true}
+	second := &InstallAppStudio{InfraDeploymentsCloneDir: "/tmp/infra-deployments", IsolateCloneDir: true}
+
+	first.isolateCloneDir()
+	second.isolateCloneDir()
+	assert.NotEqual(t, first.InfraDeploymentsCloneDir, second.InfraDeploymentsCloneDir)
+	assert.Contains(t, first.InfraDeploymentsCloneDir, "/tmp/infra-deployments-")
+
+	// The directory is isolated only once per run
+	isolated := first.InfraDeploymentsCloneDir
+	first.isolateCloneDir()
+	assert.Equal(t, isolated, first.InfraDeploymentsCloneDir)
+
+	notIsolated := &InstallAppStudio{InfraDeploymentsCloneDir: "/tmp/infra-deployments"}
+	notIsolated.isolateCloneDir()
+	assert.Equal(t, "/tmp/infra-deployments", notIsolated.InfraDeploymentsCloneDir)
+}
+
+func TestLogClusterVersion(t *testing.T) {
+	var out bytes.Buffer
+	i := &InstallAppStudio{
+		LogFormat: LogFormatJSON,
+		clientset: fake.NewSimpleClientset(),
+		openshiftConfigClient: configfake.NewSimpleClientset(&configv1.ClusterVersion{
+			ObjectMeta: metav1.ObjectMeta{Name: "version"},
+			Status:     configv1.ClusterVersionStatus{Desired: configv1.Release{Version: "4.15.3"}},
+		}),
+	}
+	restore, err := i.configureLogging(&out)
+	assert.NoError(t, err)
+	defer restore()
+
+	assert.NoError(t, i.LogClusterVersion(context.Background()))
+	assert.Contains(t, out.String(), `"version":"OpenShift 4.15.3"`)
+}
+
+func TestEnsureOpenShift(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.Resources = []*metav1.APIResourceList{{GroupVersion: "apps/v1"}, {GroupVersion: "config.openshift.io/v1"}}
+	assert.NoError(t, (&InstallAppStudio{clientset: clientset, RequireOpenShift: true}).EnsureOpenShift(context.Background()))
+}
+
+func TestEnsureOpenShiftOnKubernetes(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.Resources = []*metav1.APIResourceList{{GroupVersion: "apps/v1"}}
+
+	err := (&InstallAppStudio{clientset: clientset, RequireOpenShift: true}).EnsureOpenShift(context.Background())
+	assert.ErrorContains(t, err, "the cluster is not OpenShift (API group config.openshift.io is not served)")
+	assert.NoError(t, (&InstallAppStudio{clientset: clientset}).EnsureOpenShift(context.Background()))
+}
+
+func TestClusterVersionFallsBackToKubernetesVersion(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.29.4"}
+	i := &InstallAppStudio{clientset: clientset, openshiftConfigClient: configfake.NewSimpleClientset()}
+
+	clusterVersion, err := i.clusterVersion(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "Kubernetes v1.29.4", clusterVersion)
+}
+
+func remoteURLs(t *testing.T, repo *git.Repository, name string) []string {
+	remote, err := repo.Remote(name)
+	assert.NoError(t, err)
+	if remote == nil {
+		return nil
+	}
+	return remote.Config().URLs
+}
+
+func TestConfigureRemotesWithMultipleForks(t *testing.T) {
+	_, repo := newFixtureRepo(t)
+	i := &InstallAppStudio{
+		InfraDeploymentsOrganizationName: "redhat-appstudio",
+		ForkRemotes: map[string]string{
+			"personal": "https://github.com/developer/infra-deployments.git",
+			"team":     "https://github.com/team/infra-deployments.git",
+		},
+	}
+
+	assert.NoError(t, i.configureRemotes(context.Background(), repo))
+	assert.Equal(t, []string{"https://github.com/developer/infra-deployments.git"}, remoteURLs(t, repo, "personal"))
+	assert.Equal(t, []string{"https://github.com/team/infra-deployments.git"}, remoteURLs(t, repo, "team"))
+	_, err := repo.Remote("upstream")
+	assert.ErrorIs(t, err, git.ErrRemoteNotFound)
+}
+
+func TestConfigureRemotesDefaultFork(t *testing.T) {
+	_, repo := newFixtureRepo(t)
+	i := &InstallAppStudio{
+		InfraDeploymentsOrganizationName: "my-org",
+		LocalForkName:                    DEFAULT_LOCAL_FORK_NAME,
+		LocalGithubForkOrganization:      DEFAULT_LOCAL_FORK_ORGANIZATION,
+	}
+
+	assert.NoError(t, i.configureRemotes(context.Background(), repo))
+	assert.Equal(t, []string{"https://github.com/redhat-appstudio-qe/infra-deployments.git"}, remoteURLs(t, repo, DEFAULT_LOCAL_FORK_NAME))
+	assert.Equal(t, []string{"https://github.com/redhat-appstudio/infra-deployments.git"}, remoteURLs(t, repo, "upstream"))
+}
+
+func remotePushURLs(t *testing.T, repo *git.Repository, name string) []string {
+	cfg, err := repo.Config()
+	assert.NoError(t, err)
+	return cfg.Raw.Section("remote").Subsection(name).Options.GetAll("pushurl")
+}
+
+func TestConfigureRemotesFetchFromUpstream(t *testing.T) {
+	_, repo := newFixtureRepo(t)
+	i := &InstallAppStudio{
+		InfraDeploymentsOrganizationName: "redhat-appstudio",
+		ForkRemotes:                      map[string]string{"personal": "https://github.com/developer/infra-deployments.git"},
+		ForkFetchFromUpstream:            true,
+	}
+
+	assert.NoError(t, i.configureRemotes(context.Background(), repo))
+	assert.Equal(t, []string{upstreamInfraDeploymentsURL}, remoteURLs(t, repo, "personal"))
+	assert.Equal(t, []string{"https://github.com/developer/infra-deployments.git"}, remotePushURLs(t, repo, "personal"))
+
+	// The push URL is removed when the remote fetches from the fork again
+	i.ForkFetchFromUpstream = false
+	assert.NoError(t, i.configureRemotes(context.Background(), repo))
+	assert.Equal(t, []string{"https://github.com/developer/infra-deployments.git"}, remoteURLs(t, repo, "personal"))
+	assert.Empty(t, remotePushURLs(t, repo, "personal"))
+}
+
+func TestConfigureRemotesNoFork(t *testing.T) {
+	_, repo := newFixtureRepo(t)
+	i := &InstallAppStudio{
+		InfraDeploymentsOrganizationName: "redhat-appstudio",
+		LocalForkName:                    DEFAULT_LOCAL_FORK_NAME,
+		LocalGithubForkOrganization:      DEFAULT_LOCAL_FORK_ORGANIZATION,
+		ForkRemotes:                      map[string]string{"personal": "https://github.com/developer/infra-deployments.git"},
+		NoFork:                           true,
+	}
+
+	assert.NoError(t, i.configureRemotes(context.Background(), repo))
+	remotes, err := repo.Remotes()
+	assert.NoError(t, err)
+	assert.Empty(t, remotes)
+
+	isolateInstallationEnvironments(t)
+	i.setInstallationEnvironments()
+	assert.Equal(t, "redhat-appstudio", os.Getenv("MY_GITHUB_ORG"))
+	assert.Equal(t, "upstream", os.Getenv("MY_GIT_FORK_REMOTE"))
+
+	i.NoFork = false
+	i.setInstallationEnvironments()
+	assert.Equal(t, DEFAULT_LOCAL_FORK_ORGANIZATION, os.Getenv("MY_GITHUB_ORG"))
+	assert.Equal(t, DEFAULT_LOCAL_FORK_NAME, os.Getenv("MY_GIT_FORK_REMOTE"))
+}
+
+func TestCloneOptionsDependOnCommitPin(t *testing.T) {
+	// All branches with full history by default
+	options := (&InstallAppStudio{}).cloneOptions("https://github.com/redhat-appstudio/infra-deployments", plumbing.NewBranchReferenceName("main"))
+	assert.False(t, options.SingleBranch)
+	assert.Zero(t, options.Depth)
+
+	i := &InstallAppStudio{CloneDepth: 1}
+	options = i.cloneOptions("https://github.com/redhat-appstudio/infra-deployments", plumbing.NewBranchReferenceName("main"))
+	assert.True(t, options.SingleBranch)
+	assert.Equal(t, 1, options.Depth)
+
+	i.InfraDeploymentsCommit = "abc123"
+	options = i.cloneOptions("https://github.com/redhat-appstudio/infra-deployments", plumbing.NewBranchReferenceName("main"))
+	assert.False(t, options.SingleBranch)
+	assert.Zero(t, options.Depth)
+}
+
+func TestCheckoutPinnedCommit(t *testing.T) {
+	sourceDir, source := newFixtureRepo(t)
+	sourceHead, err := source.Head()
+	assert.NoError(t, err)
+	commitFile(t, source, sourceDir, "new-file", "content")
+
+	i := &InstallAppStudio{InfraDeploymentsCommit: sourceHead.Hash().String()}
+	repo, err := cloneOrResume(filepath.Join(t.TempDir(), "infra-deployments"), i.cloneOptions(sourceDir, plumbing.NewBranchReferenceName("main")))
+	assert.NoError(t, err)
+	assert.NoError(t, checkoutCommit(repo, i.InfraDeploymentsCommit))
+
+	head, err := repo.Head()
+	assert.NoError(t, err)
+	assert.Equal(t, sourceHead.Hash(), head.Hash())
+}
+
+func TestCloneBackoff(t *testing.T) {
+	i := &InstallAppStudio{}
+	assert.Equal(t, cloneRetryBaseDelay, i.cloneBackoff(1))
+	assert.Equal(t, 2*cloneRetryBaseDelay, i.cloneBackoff(2))
+	assert.Equal(t, cloneRetryMaxDelay, i.cloneBackoff(10))
+	assert.Equal(t, cloneRetryMaxDelay, i.cloneBackoff(100))
+}
+
+func TestCloneBackoffJitter(t *testing.T) {
+	i := &InstallAppStudio{CloneBackoffJitter: true, rand: rand.New(rand.NewSource(1))}
+	seen := map[time.Duration]bool{}
+	for attempt := 1; attempt <= 5; attempt++ {
+		for n := 0; n < 20; n++ {
+			backoff := i.cloneBackoff(attempt)
+			assert.GreaterOrEqual(t, backoff, time.Duration(0))
+			assert.LessOrEqual(t, backoff, (&InstallAppStudio{}).cloneBackoff(attempt))
+			seen[backoff] = true
+		}
+	}
+	assert.Greater(t, len(seen), 90, "backoffs are not randomized")
+
+	// The same seed gives the same backoffs
+	first := (&InstallAppStudio{CloneBackoffJitter: true, rand: rand.New(rand.NewSource(7))}).cloneBackoff(3)
+	second := (&InstallAppStudio{CloneBackoffJitter: true, rand: rand.New(rand.NewSource(7))}).cloneBackoff(3)
+	assert.Equal(t, first, second)
+}
+
+func TestCloneWithRetryRespectsCancellation(t *testing.T) {
+	i := &InstallAppStudio{InfraDeploymentsCloneDir: filepath.Join(t.TempDir(), "infra-deployments"), CloneRetries: 3}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := i.cloneWithRetry(ctx, &git.CloneOptions{URL: filepath.Join(t.TempDir(), "missing")})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), cloneRetryBaseDelay)
+}
+
+// recordingRunner records the commands instead of running them
+type recordingRunner struct {
+	commands []Command
+}
+
+func (r *recordingRunner) Run(ctx context.Context, command Command) error {
+	r.commands = append(r.commands, command)
+	return nil
+}
+
+// flakyRunner fails the first runs of the command. Like ExecCommandRunner, it writes an output line into Command.Lines
+// and closes the channel
+type flakyRunner struct {
+	failures int
+	runs     int
+}
+
+func (r *flakyRunner) Run(ctx context.Context, command Command) error {
+	r.runs++
+	if command.Lines != nil {
+		command.Lines <- fmt.Sprintf("run %d", r.runs)
+		close(command.Lines)
+	}
+	if r.runs <= r.failures {
+		return fmt.Errorf("exit status 1")
+	}
+	return nil
+}
+
+// isolateInstallationEnvironments restores the envs set by setInstallationEnvironments after the test
+func isolateInstallationEnvironments(t *testing.T) {
+	for _, name := range []string{"MY_GITHUB_ORG", "MY_GITHUB_TOKEN", "MY_GIT_FORK_REMOTE", "MY_GIT_BRANCH", "TEST_BRANCH_ID", "IMAGE_CONTROLLER_QUAY_ORG",
+		"IMAGE_CONTROLLER_QUAY_TOKEN", "BUILD_SERVICE_IMAGE_TAG_EXPIRATION", "PAC_GITHUB_APP_ID", "PAC_GITHUB_APP_PRIVATE_KEY", "QUAY_TOKEN",
+		constants.ENABLE_SCHEDULING_ON_MASTER_NODES_ENV, "APPS_DOMAIN", "OAUTH_REDIRECT_PROXY_URL"} {
+		t.Setenv(name, "")
+	}
+}
+
+// bootstrapCloneDir returns an infra-deployments clone directory containing a bootstrap script with the given mode
+func bootstrapCloneDir(t *testing.T, mode os.FileMode) string {
+	dir := t.TempDir()
+	script := filepath.Join(dir, bootstrapScript)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(script), 0755))
+	assert.NoError(t, os.WriteFile(script, []byte("#!/bin/bash\n"), mode))
+	return dir
+}
+
+func TestCheckBootstrapExecutable(t *testing.T) {
+	assert.NoError(t, (&InstallAppStudio{InfraDeploymentsCloneDir: bootstrapCloneDir(t, 0755)}).checkBootstrapExecutable())
+
+	i := &InstallAppStudio{InfraDeploymentsCloneDir: bootstrapCloneDir(t, 0644)}
+	assert.ErrorContains(t, i.checkBootstrapExecutable(), "is not executable (mode -rw-r--r--)")
+	i.BootstrapShell = "bash"
+	assert.NoError(t, i.checkBootstrapExecutable(), "a script run by a shell doesn't have to be executable")
+
+	i = &InstallAppStudio{InfraDeploymentsCloneDir: bootstrapCloneDir(t, 0644), FixBootstrapPermissions: true}
+	assert.NoError(t, i.checkBootstrapExecutable())
+	info, err := os.Stat(filepath.Join(i.InfraDeploymentsCloneDir, bootstrapScript))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	i = &InstallAppStudio{InfraDeploymentsCloneDir: t.TempDir(), FixBootstrapPermissions: true, CommandRunner: &recordingRunner{}}
+	assert.ErrorContains(t, i.checkBootstrapExecutable(), "bootstrap script "+filepath.Join(i.InfraDeploymentsCloneDir, bootstrapScript)+" not found")
+	isolateInstallationEnvironments(t)
+	assert.ErrorContains(t, i.bootstrap(context.Background()), "not found")
+	assert.Empty(t, i.CommandRunner.(*recordingRunner).commands)
+}
+
+// bootstrapScriptWithFlags returns an infra-deployments clone directory with a bootstrap script parsing the given flags
+func bootstrapScriptWithFlags(t *testing.T, flags ...string) string {
+	dir := bootstrapCloneDir(t, 0755)
+	script := "#!/bin/bash\nwhile [[ $# -gt 0 ]]; do\n  case $1 in\n    preview) ;;\n"
+	for _, flag := range flags {
+		script += fmt.Sprintf("    %s) shift ;;\n", flag)
+	}
+	script += "  esac\n  shift\ndone\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, bootstrapScript), []byte(script), 0755))
+	return dir
+}
+
+func TestCheckBootstrapFlags(t *testing.T) {
+	isolateInstallationEnvironments(t)
+	runner := &recordingRunner{}
+	i := &InstallAppStudio{CheckBootstrapFlags: true, CommandRunner: runner, InfraDeploymentsCloneDir: bootstrapScriptWithFlags(t, "--keycloak", "--toolchain")}
+
+	assert.NoError(t, i.bootstrap(context.Background()))
+	// The script is only run for the bootstrap itself
+	assert.Len(t, runner.commands, 1)
+	assert.Equal(t, []string{"preview", "--keycloak", "--toolchain"}, runner.commands[0].Args)
+}
+
+func TestCheckBootstrapFlagsUnsupported(t *testing.T) {
+	isolateInstallationEnvironments(t)
+	runner := &recordingRunner{}
+	i := &InstallAppStudio{CheckBootstrapFlags: true, CommandRunner: runner, InfraDeploymentsCloneDir: bootstrapScriptWithFlags(t, "--keycloak-operator")}
+
+	assert.ErrorContains(t, i.bootstrap(context.Background()), "bootstrap script "+bootstrapScript+" doesn't support --keycloak, --toolchain")
+	assert.Empty(t, runner.commands)
+
+	// Only the flags of the selected components are required
+	i.Components = []string{"keycloak"}
+	i.InfraDeploymentsCloneDir = bootstrapScriptWithFlags(t, "--keycloak-operator", "--keycloak")
+	assert.NoError(t, i.checkBootstrapFlags())
+	assert.Empty(t, runner.commands)
+}
+
+func TestCheckBootstrapFlagsMissingScript(t *testing.T) {
+	i := &InstallAppStudio{InfraDeploymentsCloneDir: t.TempDir()}
+	assert.ErrorContains(t, i.checkBootstrapFlags(), "failed to read bootstrap script")
+}
+
+func TestBootstrapKeepsQuayTokenOutOfEnv(t *testing.T) {
+	isolateInstallationEnvironments(t)
+	runner := &recordingRunner{}
+	quayToken := base64.StdEncoding.EncodeToString([]byte(testDockerConfig))
+	i := &InstallAppStudio{QuayToken: quayToken, KeepQuayTokenOutOfEnv: true, CommandRunner: runner, InfraDeploymentsCloneDir: bootstrapCloneDir(t, 0755)}
+
+	assert.NoError(t, i.bootstrap(context.Background()))
+	assert.Empty(t, os.Getenv("QUAY_TOKEN"), "QUAY_TOKEN is exported")
+	assert.Len(t, runner.commands, 1)
+	assert.Equal(t, map[string]string{"QUAY_TOKEN": quayToken}, runner.commands[0].Env)
+
+	// The e2e quay secret is created from the in-memory token
+	data, err := i.secretSource().QuayDockerConfig(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, testDockerConfig, string(data))
+
+	// A QUAY_TOKEN env of the installer's environment is not touched, e.g. for the mage targets run after the installation
+	t.Setenv("QUAY_TOKEN", "token-of-the-caller")
+	assert.NoError(t, i.bootstrap(context.Background()))
+	assert.Equal(t, "token-of-the-caller", os.Getenv("QUAY_TOKEN"))
+	assert.Equal(t, map[string]string{"QUAY_TOKEN": quayToken}, runner.commands[1].Env)
+
+	i.KeepQuayTokenOutOfEnv = false
+	runner.commands = nil
+	assert.NoError(t, i.bootstrap(context.Background()))
+	assert.Equal(t, quayToken, os.Getenv("QUAY_TOKEN"))
+	assert.Nil(t, runner.commands[0].Env)
+}
+
+func TestBootstrapCleanEnv(t *testing.T) {
+	isolateInstallationEnvironments(t)
+	runner := &recordingRunner{}
+	i := &InstallAppStudio{CleanEnv: true, DefaultImageQuayOrg: "my-org", Overlay: "staging", CommandRunner: runner, InfraDeploymentsCloneDir: bootstrapCloneDir(t, 0755)}
+
+	assert.NoError(t, i.bootstrap(context.Background()))
+	assert.Len(t, runner.commands, 1)
+	assert.True(t, runner.commands[0].CleanEnv)
+	assert.Equal(t, "my-org", runner.commands[0].Env["IMAGE_CONTROLLER_QUAY_ORG"])
+	assert.Equal(t, "staging", runner.commands[0].Env["INFRA_DEPLOYMENTS_OVERLAY"])
+	assert.Contains(t, runner.commands[0].Env, "TEST_BRANCH_ID")
+}
+
+// flakyRemoteRepository fails the first CreateRemote calls. With racingURL set, the remote is created
+// with that URL by "someone else" before the failure, like when another process configures the clone at the same time
+type flakyRemoteRepository struct {
+	*git.Repository
+	failures  int
+	racingURL string
+	creates   int
+}
+
+func (r *flakyRemoteRepository) CreateRemote(c *config.RemoteConfig) (*git.Remote, error) {
+	r.creates++
+	if r.creates > r.failures {
+		return r.Repository.CreateRemote(c)
+	}
+	if r.racingURL != "" {
+		if _, err := r.Repository.CreateRemote(&config.RemoteConfig{Name: c.Name, URLs: []string{r.racingURL}}); err != nil {
+			return nil, err
+		}
+		return nil, git.ErrRemoteExists
+	}
+	return nil, errors.New("could not lock config file")
+}
+
+func TestEnsureRemoteRetriesTransientErrors(t *testing.T) {
+	createRemoteRetryDelay = time.Millisecond
+	_, fixture := newFixtureRepo(t)
+	repo := &flakyRemoteRepository{Repository: fixture, failures: 2}
+
+	assert.NoError(t, (&InstallAppStudio{}).ensureRemote(context.Background(), repo, "upstream", "https://github.com/redhat-appstudio/infra-deployments.git"))
+	assert.Equal(t, 3, repo.creates)
+	remote, err := fixture.Remote("upstream")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://github.com/redhat-appstudio/infra-deployments.git"}, remote.Config().URLs)
+
+	repo = &flakyRemoteRepository{Repository: fixture, failures: createRemoteAttempts}
+	err = (&InstallAppStudio{}).ensureRemote(context.Background(), repo, "fork", "https://github.com/my-org/infra-deployments.git")
+	assert.ErrorContains(t, err, "failed to create remote fork with URL https://github.com/my-org/infra-deployments.git after 3 attempts")
+}
+
+func TestEnsureRemoteStopsRetryingOnCancel(t *testing.T) {
+	createRemoteRetryDelay = time.Hour
+	defer func() { createRemoteRetryDelay = time.Millisecond }()
+	_, fixture := newFixtureRepo(t)
+	repo := &flakyRemoteRepository{Repository: fixture, failures: createRemoteAttempts}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := (&InstallAppStudio{}).ensureRemote(ctx, repo, "upstream", "https://github.com/redhat-appstudio/infra-deployments.git")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, repo.creates)
+}
+
+func TestEnsureRemoteReconcilesExistingRemote(t *testing.T) {
+	createRemoteRetryDelay = time.Millisecond
+	_, fixture := newFixtureRepo(t)
+	repo := &flakyRemoteRepository{Repository: fixture, failures: 1, racingURL: "https://github.com/other/infra-deployments.git"}
+
+	assert.NoError(t, (&InstallAppStudio{}).ensureRemote(context.Background(), repo, "upstream", "https://github.com/redhat-appstudio/infra-deployments.git"))
+	remote, err := fixture.Remote("upstream")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://github.com/redhat-appstudio/infra-deployments.git"}, remote.Config().URLs)
+}
+
+func TestImageControllerNamespace(t *testing.T) {
+	assert.Equal(t, "image-controller", (&InstallAppStudio{}).imageControllerNamespace())
+	assert.Equal(t, "my-image-controller", (&InstallAppStudio{ImageControllerNamespace: "my-image-controller"}).imageControllerNamespace())
+
+	i := &InstallAppStudio{SkipQuaySecret: true, DefaultImageQuayOrgOAuth2Token: "token", ImageControllerNamespace: "Invalid_Namespace"}
+	assert.ErrorContains(t, i.Validate(), `invalid image-controller namespace "Invalid_Namespace"`)
+	i.ImageControllerNamespace = "my-image-controller"
+	assert.NoError(t, i.Validate())
+
+	// The namespace is not validated when image-controller is not configured
+	assert.NoError(t, (&InstallAppStudio{SkipQuaySecret: true, ImageControllerNamespace: "Invalid_Namespace"}).Validate())
+}
+
+func TestRetryBootstrapOnFailure(t *testing.T) {
+	bootstrapRetryDelay = time.Millisecond
+	isolateInstallationEnvironments(t)
+	runner := &flakyRunner{failures: 1}
+	lines := make(chan string, 10)
+	i := &InstallAppStudio{RetryBootstrapOnFailure: 2, CommandRunner: runner, BootstrapOutput: lines, InfraDeploymentsCloneDir: bootstrapCloneDir(t, 0755)}
+
+	assert.NoError(t, i.bootstrap(context.Background()))
+	assert.Equal(t, 2, runner.runs)
+	var received []string
+	for line := range lines {
+		received = append(received, line)
+	}
+	assert.Equal(t, []string{"run 1", "run 2"}, received)
+
+	runner = &flakyRunner{failures: 5}
+	i = &InstallAppStudio{RetryBootstrapOnFailure: 2, CommandRunner: runner, InfraDeploymentsCloneDir: bootstrapCloneDir(t, 0755)}
+	assert.ErrorContains(t, i.bootstrap(context.Background()), "bootstrap failed after 3 attempts: exit status 1")
+	assert.Equal(t, 3, runner.runs)
+}
+
+func TestRetryBootstrapOnFailureRespectsCancellation(t *testing.T) {
+	bootstrapRetryDelay = time.Hour
+	isolateInstallationEnvironments(t)
+	runner := &flakyRunner{failures: 5}
+	i := &InstallAppStudio{RetryBootstrapOnFailure: 5, CommandRunner: runner, InfraDeploymentsCloneDir: bootstrapCloneDir(t, 0755)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, i.bootstrap(ctx), context.DeadlineExceeded)
+	assert.Equal(t, 1, runner.runs)
+
+	assert.ErrorContains(t, (&InstallAppStudio{SkipQuaySecret: true, RetryBootstrapOnFailure: 6}).Validate(), "RetryBootstrapOnFailure must be between 0 and 5")
+}
+
+func TestBootstrapOverlay(t *testing.T) {
+	isolateInstallationEnvironments(t)
+	runner := &recordingRunner{}
+	i := &InstallAppStudio{Overlay: "staging", CommandRunner: runner, InfraDeploymentsCloneDir: bootstrapCloneDir(t, 0755)}
+
+	assert.NoError(t, i.bootstrap(context.Background()))
+	assert.Len(t, runner.commands, 1)
+	assert.Equal(t, map[string]string{"INFRA_DEPLOYMENTS_OVERLAY": "staging"}, runner.commands[0].Env)
+}
+
+func TestBootstrapShell(t *testing.T) {
+	isolateInstallationEnvironments(t)
+	runner := &recordingRunner{}
+	cloneDir := bootstrapCloneDir(t, 0755)
+	i := &InstallAppStudio{Components: []string{"keycloak"}, CommandRunner: runner, InfraDeploymentsCloneDir: cloneDir}
+
+	assert.NoError(t, i.bootstrap(context.Background()))
+	i.BootstrapShell = "bash"
+	assert.NoError(t, i.bootstrap(context.Background()))
+
+	assert.Len(t, runner.commands, 2)
+	assert.Equal(t, "hack/bootstrap-cluster.sh", runner.commands[0].Name)
+	assert.Equal(t, []string{"preview", "--keycloak"}, runner.commands[0].Args)
+	assert.Equal(t, "bash", runner.commands[1].Name)
+	assert.Equal(t, []string{"hack/bootstrap-cluster.sh", "preview", "--keycloak"}, runner.commands[1].Args)
+	assert.Equal(t, cloneDir, runner.commands[1].Dir)
+}
+
+func TestValidateOverlay(t *testing.T) {
+	assert.NoError(t, (&InstallAppStudio{SkipQuaySecret: true}).Validate())
+	assert.NoError(t, (&InstallAppStudio{SkipQuaySecret: true, Overlay: "development"}).Validate())
+	assert.ErrorContains(t, (&InstallAppStudio{SkipQuaySecret: true, Overlay: "production"}).Validate(), `overlay "production" is not allowed`)
+	assert.NoError(t, (&InstallAppStudio{SkipQuaySecret: true, Overlay: "production", AllowedOverlays: []string{"production"}}).Validate())
+	assert.Error(t, (&InstallAppStudio{SkipQuaySecret: true, Overlay: "staging", AllowedOverlays: []string{"production"}}).Validate())
+}
+
+func TestNilKubernetesClient(t *testing.T) {
+	ctx := context.Background()
+	i := &InstallAppStudio{
+		SecretSource:          fakeSecretSource{dockerConfig: []byte(testDockerConfig)},
+		ExtraManifests:        []string{t.TempDir()},
+		openshiftConfigClient: configfake.NewSimpleClientset(),
+	}
+
+	_, snapshotErr := i.SnapshotDeploymentGenerations(ctx, []types.NamespacedName{{Namespace: "test", Name: "service"}})
+	_, versionErr := i.clusterVersion(ctx)
+	_, _, driftErr := i.CheckInstalledRefDrift(ctx, "sha")
+	for name, err := range map[string]error{
+		"createE2EQuaySecret":            i.createE2EQuaySecret(ctx),
+		"CheckOperatorsReady":            i.CheckOperatorsReady(),
+		"PatchConfigMapAndRestart":       i.PatchConfigMapAndRestart(ctx, "test", "config", "service", map[string]string{"KEY": "value"}),
+		"SnapshotDeploymentGenerations":  snapshotErr,
+		"clusterVersion":                 versionErr,
+		"CheckInstalledRefDrift":         driftErr,
+		"WaitForNamespaceTerminated":     i.WaitForNamespaceTerminated(ctx, "test", time.Second),
+		"WaitForNamespaceServiceAccount": i.WaitForNamespaceServiceAccount(ctx, "test", time.Second),
+		"WaitForE2ENamespaceReady":       i.WaitForE2ENamespaceReady(ctx, time.Second),
+		"VerifyPullSecretWithProbe":      i.VerifyPullSecretWithProbe(ctx, "test", "pull-secret", time.Second),
+		"PreflightClusterCapacity":       i.PreflightClusterCapacity(ctx, 1, resource.Quantity{}, resource.Quantity{}),
+		"EnsureOpenShift":                (&InstallAppStudio{RequireOpenShift: true}).EnsureOpenShift(ctx),
+		"Uninstall":                      i.Uninstall(ctx),
+		"WaitForCSVSucceeded":            i.WaitForCSVSucceeded(ctx, "test", []string{"operator"}, time.Second),
+		"WaitForCRDsEstablished":         i.WaitForCRDsEstablished(ctx, []string{"crd"}, time.Second),
+		"WaitForRouteAdmitted":           i.WaitForRouteAdmitted(ctx, "test", "route", time.Second),
+		"applyExtraManifests":            i.applyExtraManifests(ctx),
+		"VerifyOnly":                     i.VerifyOnly(ctx),
+		"SetImageControllerQuayOrg":      i.SetImageControllerQuayOrg(ctx, "my-org"),
+		"RevertSPIConfig":                i.RevertSPIConfig(ctx),
+	} {
+		assert.ErrorIs(t, err, errKubernetesClientNotInitialized, name)
+	}
+}
+
+func TestAfterCloneHook(t *testing.T) {
+	sourceDir, source := newFixtureRepo(t)
+	pinned := commitFile(t, source, sourceDir, "pinned", "content")
+	var patched plumbing.Hash
+	i := &InstallAppStudio{
+		InfraDeploymentsCloneDir:         filepath.Join(t.TempDir(), "infra-deployments"),
+		InfraDeploymentsBranch:           "main",
+		InfraDeploymentsOrganizationName: "redhat-appstudio",
+		InfraDeploymentsCommit:           pinned.String(),
+		NoFork:                           true,
+		cloneURL:                         sourceDir,
+	}
+	i.AfterCloneHook = func(repo *git.Repository) error {
+		patched = commitFile(t, repo, i.InfraDeploymentsCloneDir, "local-patch", "patched")
+		return nil
+	}
+
+	assert.NoError(t, i.cloneInfraDeployments(context.Background()))
+	sha, err := i.InstalledCommitSHA()
+	assert.NoError(t, err)
+	assert.Equal(t, patched.String(), sha)
+	assert.NotEqual(t, pinned.String(), sha)
+
+	i.AfterCloneHook = func(repo *git.Repository) error { return errors.New("patch does not apply") }
+	assert.ErrorContains(t, i.cloneInfraDeployments(context.Background()), "after clone hook failed: patch does not apply")
+}
+
+func TestAppsDomain(t *testing.T) {
+	assert.NoError(t, (&InstallAppStudio{SkipQuaySecret: true, AppsDomain: "apps.my-cluster.example.com"}).Validate())
+	assert.ErrorContains(t, (&InstallAppStudio{SkipQuaySecret: true, AppsDomain: "https://apps.my-cluster.example.com"}).Validate(), "invalid apps domain")
+	assert.ErrorContains(t, (&InstallAppStudio{SkipQuaySecret: true, AppsDomain: "Apps_Domain"}).Validate(), "invalid apps domain")
+
+	isolateInstallationEnvironments(t)
+	i := &InstallAppStudio{AppsDomain: "apps.my-cluster.example.com"}
+	i.setInstallationEnvironments()
+	assert.Equal(t, "apps.my-cluster.example.com", os.Getenv("APPS_DOMAIN"))
+	assert.Equal(t, "https://spi-oauth-route-spi-system.apps.my-cluster.example.com", os.Getenv("OAUTH_REDIRECT_PROXY_URL"))
+
+	// An explicitly set proxy URL is kept
+	t.Setenv("OAUTH_REDIRECT_PROXY_URL", "https://proxy.example.com")
+	i.setInstallationEnvironments()
+	assert.Equal(t, "https://proxy.example.com", os.Getenv("OAUTH_REDIRECT_PROXY_URL"))
+
+	t.Setenv("OAUTH_REDIRECT_PROXY_URL", "")
+	proxyURL, err := (&InstallAppStudio{}).oauthRedirectProxyURL()
+	assert.NoError(t, err)
+	assert.Equal(t, "", proxyURL, "no proxy URL without apps domain")
+}
+
+func TestInstallationEnvironmentIsRecorded(t *testing.T) {
+	isolateInstallationEnvironments(t)
+	t.Setenv("E2E_PAC_GITHUB_APP_PRIVATE_KEY", "private-key")
+	t.Setenv("GITHUB_TOKEN", "github-token")
+	i := &InstallAppStudio{
+		InfraDeploymentsBranch:         "main",
+		LocalGithubForkOrganization:    "my-org",
+		LocalForkName:                  "qe",
+		QuayToken:                      "quay-token",
+		DefaultImageQuayOrg:            "my-quay-org",
+		DefaultImageQuayOrgOAuth2Token: "",
+		AppsDomain:                     "apps.my-cluster.example.com",
+	}
+
+	i.setInstallationEnvironments()
+	environment := i.Result().Environment
+	assert.Equal(t, "quay-token", os.Getenv("QUAY_TOKEN"))
+	assert.Equal(t, map[string]string{
+		"MY_GITHUB_ORG":                                 "my-org",
+		"MY_GIT_FORK_REMOTE":                            "qe",
+		"MY_GIT_BRANCH":                                 "main",
+		"MY_GITHUB_TOKEN":                               redactedEnvValue,
+		"TEST_BRANCH_ID":                                os.Getenv("TEST_BRANCH_ID"),
+		"QUAY_TOKEN":                                    redactedEnvValue,
+		"IMAGE_CONTROLLER_QUAY_ORG":                     "my-quay-org",
+		"IMAGE_CONTROLLER_QUAY_TOKEN":                   "",
+		"BUILD_SERVICE_IMAGE_TAG_EXPIRATION":            "",
+		"PAC_GITHUB_APP_ID":                             "",
+		"PAC_GITHUB_APP_PRIVATE_KEY":                    redactedEnvValue,
+		constants.ENABLE_SCHEDULING_ON_MASTER_NODES_ENV: "",
+		"APPS_DOMAIN":                                   "apps.my-cluster.example.com",
+		"OAUTH_REDIRECT_PROXY_URL":                      "https://spi-oauth-route-spi-system.apps.my-cluster.example.com",
+	}, environment)
+
+	// The result gets a copy of the recorded environment
+	environment["QUAY_TOKEN"] = "quay-token"
+	assert.Equal(t, redactedEnvValue, i.Result().Environment["QUAY_TOKEN"])
+}
+
+func TestOAuthRedirectProxyURLTemplate(t *testing.T) {
+	isolateInstallationEnvironments(t)
+	t.Setenv("OAUTH_REDIRECT_PROXY_URL", "https://oauth-proxy-{{.Namespace}}.{{.AppsDomain}}/callback")
+	i := &InstallAppStudio{SkipQuaySecret: true, AppsDomain: "apps.my-cluster.example.com", SPIOAuthRouteNamespace: "spi"}
+
+	assert.NoError(t, i.Validate())
+	i.setInstallationEnvironments()
+	assert.Equal(t, "https://oauth-proxy-spi.apps.my-cluster.example.com/callback", os.Getenv("OAUTH_REDIRECT_PROXY_URL"))
+
+	for template, expected := range map[string]string{
+		"https://proxy.{{.AppsDomain}}":    "refers to the apps domain, but it is not set",
+		"https://proxy.{{.AppsDomain":      "failed to parse OAUTH_REDIRECT_PROXY_URL template",
+		"https://proxy.{{.Cluster}}":       "failed to render OAUTH_REDIRECT_PROXY_URL template",
+		"{{.Namespace}}.example.com/proxy": `OAUTH_REDIRECT_PROXY_URL "spi-system.example.com/proxy" is not a valid http(s) URL`,
+	} {
+		t.Setenv("OAUTH_REDIRECT_PROXY_URL", template)
+		assert.ErrorContains(t, (&InstallAppStudio{SkipQuaySecret: true}).Validate(), expected, template)
+	}
+}
+
+func TestCloneBranchFallbacks(t *testing.T) {
+	sourceDir, _ := newFixtureRepo(t)
+	i := &InstallAppStudio{
+		InfraDeploymentsCloneDir:         filepath.Join(t.TempDir(), "infra-deployments"),
+		InfraDeploymentsBranch:           "missing",
+		BranchFallbacks:                  []string{"also-missing", "main"},
+		InfraDeploymentsOrganizationName: "redhat-appstudio",
+		// Pinned to avoid rebasing on the real upstream
+		InfraDeploymentsCommit: "main",
+		NoFork:                 true,
+		cloneURL:               sourceDir,
+	}
+
+	assert.NoError(t, i.cloneInfraDeployments(context.Background()))
+	repo, err := git.PlainOpen(i.InfraDeploymentsCloneDir)
+	assert.NoError(t, err)
+	_, err = repo.Reference(plumbing.NewRemoteReferenceName("upstream", "main"), true)
+	assert.NoError(t, err)
+
+	i.BranchFallbacks = []string{"also-missing"}
+	assert.ErrorContains(t, i.cloneInfraDeployments(context.Background()), "none of the branches missing, also-missing exist in "+sourceDir)
+}
+
+func TestGitOpsTrackBranchDiffersFromCloneBranch(t *testing.T) {
+	sourceDir, _ := newFixtureRepo(t)
+	i := &InstallAppStudio{
+		InfraDeploymentsCloneDir:         filepath.Join(t.TempDir(), "infra-deployments"),
+		InfraDeploymentsBranch:           "main",
+		GitOpsTrackBranch:                "e2e-fork",
+		InfraDeploymentsOrganizationName: "redhat-appstudio",
+		InfraDeploymentsCommit:           "main",
+		NoFork:                           true,
+		cloneURL:                         sourceDir,
+	}
+
+	assert.NoError(t, i.cloneInfraDeployments(context.Background()))
+	repo, err := git.PlainOpen(i.InfraDeploymentsCloneDir)
+	assert.NoError(t, err)
+	_, err = repo.Reference(plumbing.NewRemoteReferenceName("upstream", "main"), true)
+	assert.NoError(t, err)
+
+	isolateInstallationEnvironments(t)
+	i.setInstallationEnvironments()
+	assert.Equal(t, "e2e-fork", os.Getenv("MY_GIT_BRANCH"))
+	assert.Equal(t, "e2e-fork", i.Result().Environment["MY_GIT_BRANCH"])
+
+	// Without GitOpsTrackBranch the bootstrap tracks the cloned branch
+	i.GitOpsTrackBranch = ""
+	i.setInstallationEnvironments()
+	assert.Equal(t, "main", os.Getenv("MY_GIT_BRANCH"))
+}
+
+func TestCommitsAfterCloneCarryConfiguredIdentity(t *testing.T) {
+	sourceDir, _ := newFixtureRepo(t)
+	var hookCommit plumbing.Hash
+	i := &InstallAppStudio{
+		InfraDeploymentsCloneDir:         filepath.Join(t.TempDir(), "infra-deployments"),
+		InfraDeploymentsBranch:           "main",
+		InfraDeploymentsOrganizationName: "redhat-appstudio",
+		InfraDeploymentsCommit:           "main",
+		NoFork:                           true,
+		GitAuthorName:                    "CI Bot",
+		GitAuthorEmail:                   "ci-bot@example.com",
+		cloneURL:                         sourceDir,
+		AfterCloneHook: func(repo *git.Repository) error {
+			worktree, err := repo.Worktree()
+			if err != nil {
+				return err
+			}
+			hookCommit, err = worktree.Commit("patch infra-deployments", &git.CommitOptions{AllowEmptyCommits: true})
+			return err
+		},
+	}
+
+	assert.NoError(t, i.cloneInfraDeployments(context.Background()))
+	repo, err := git.PlainOpen(i.InfraDeploymentsCloneDir)
+	assert.NoError(t, err)
+	commit, err := repo.CommitObject(hookCommit)
+	assert.NoError(t, err)
+	assert.Equal(t, "CI Bot", commit.Author.Name)
+	assert.Equal(t, "ci-bot@example.com", commit.Author.Email)
+	assert.Equal(t, "CI Bot", commit.Committer.Name)
+
+	// The git CLI, e.g. rebasing on upstream main, uses the same identity
+	out, err := exec.Command("git", "-C", i.InfraDeploymentsCloneDir, "config", "user.email").Output()
+	assert.NoError(t, err)
+	assert.Equal(t, "ci-bot@example.com", strings.TrimSpace(string(out)))
+}
+
+// blockingRunner signals that the command started and blocks until the context of the command is cancelled
+type blockingRunner struct {
+	started chan struct{}
+}
+
+func (r *blockingRunner) Run(ctx context.Context, command Command) error {
+	close(r.started)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestWithContextCancelsInstallation(t *testing.T) {
+	isolateInstallationEnvironments(t)
+	sourceDir, source := newFixtureRepo(t)
+	assert.NoError(t, os.MkdirAll(filepath.Join(sourceDir, filepath.Dir(bootstrapScript)), 0755))
+	commitFile(t, source, sourceDir, bootstrapScript, "#!/bin/bash\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runner := &blockingRunner{started: make(chan struct{})}
+	i := (&InstallAppStudio{
+		InfraDeploymentsCloneDir:         filepath.Join(t.TempDir(), "infra-deployments"),
+		InfraDeploymentsBranch:           "main",
+		InfraDeploymentsOrganizationName: "redhat-appstudio",
+		InfraDeploymentsCommit:           "main",
+		NoFork:                           true,
+		SkipQuaySecret:                   true,
+		BootstrapShell:                   "bash",
+		CommandRunner:                    runner,
+		clientset:                        fake.NewSimpleClientset(),
+		cloneURL:                         sourceDir,
+	}).WithContext(ctx)
+
+	done := make(chan error)
+	go func() { done <- i.InstallAppStudioPreviewMode() }()
+	<-runner.started
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(10 * time.Second):
+		t.Fatal("the installation was not aborted by the cancelled base context")
+	}
+	phases := i.Result().Phases
+	assert.Equal(t, PhaseBootstrap, phases[len(phases)-1].Name, "no phase runs after the aborted bootstrap")
+}
+
+func TestWithContext(t *testing.T) {
+	i := &InstallAppStudio{}
+	assert.Equal(t, context.Background(), i.baseContext())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.Same(t, i, i.WithContext(ctx))
+	assert.Equal(t, ctx, i.baseContext())
+}
+
+func TestCloneFromMirror(t *testing.T) {
+	mirrorDir, mirror := newFixtureRepo(t)
+	head, err := mirror.Head()
+	assert.NoError(t, err)
+	i := &InstallAppStudio{
+		InfraDeploymentsCloneDir:         filepath.Join(t.TempDir(), "infra-deployments"),
+		InfraDeploymentsBranch:           "main",
+		InfraDeploymentsOrganizationName: "redhat-appstudio",
+		InfraDeploymentsCommit:           head.Hash().String(),
+		LocalForkName:                    "qe",
+		LocalGithubForkOrganization:      "my-org",
+		MirrorURLs:                       []string{filepath.Join(t.TempDir(), "missing-mirror"), mirrorDir},
+		cloneURL:                         filepath.Join(t.TempDir(), "unavailable"),
+	}
+
+	assert.NoError(t, i.cloneInfraDeployments(context.Background()))
+	sha, err := i.InstalledCommitSHA()
+	assert.NoError(t, err)
+	assert.Equal(t, head.Hash().String(), sha)
+	repo, err := git.PlainOpen(i.InfraDeploymentsCloneDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{mirrorDir}, remoteURLs(t, repo, "upstream"))
+	assert.Equal(t, []string{"https://github.com/my-org/infra-deployments.git"}, remoteURLs(t, repo, "qe"))
+
+	i.MirrorURLs = []string{filepath.Join(t.TempDir(), "missing-mirror")}
+	assert.NoError(t, os.RemoveAll(i.InfraDeploymentsCloneDir))
+	assert.ErrorContains(t, i.cloneInfraDeployments(context.Background()), "missing-mirror")
+}
+
+func TestCloneRebasesOnUpstreamWithCommandRunner(t *testing.T) {
+	sourceDir, _ := newFixtureRepo(t)
+	runner := &recordingRunner{}
+	i := &InstallAppStudio{
+		InfraDeploymentsCloneDir:         filepath.Join(t.TempDir(), "infra-deployments"),
+		InfraDeploymentsBranch:           "main",
+		InfraDeploymentsOrganizationName: "redhat-appstudio",
+		NoFork:                           true,
+		CommandRunner:                    runner,
+		cloneURL:                         sourceDir,
+	}
+
+	assert.NoError(t, i.cloneInfraDeployments(context.Background()))
+	assert.Equal(t, []Command{{Name: "git", Args: []string{"pull", "--rebase", "upstream", "main"}, Dir: i.InfraDeploymentsCloneDir}}, runner.commands)
+}
+
+func TestRebaseShallowCloneOfFork(t *testing.T) {
+	upstreamDir, upstream := newFixtureRepo(t)
+	forkDir := t.TempDir()
+	fork, err := git.PlainClone(forkDir, false, &git.CloneOptions{URL: upstreamDir})
+	assert.NoError(t, err)
+	commitFile(t, fork, forkDir, "fork-change", "change of the fork")
+	upstreamHead := commitFile(t, upstream, upstreamDir, "README.md", "updated upstream")
+
+	i := &InstallAppStudio{
+		InfraDeploymentsCloneDir:         filepath.Join(t.TempDir(), "infra-deployments"),
+		InfraDeploymentsBranch:           "main",
+		InfraDeploymentsOrganizationName: "my-org",
+		NoFork:                           true,
+		CloneDepth:                       1,
+		cloneURL:                         "file://" + forkDir,
+		upstreamRemoteURL:                "file://" + upstreamDir,
+	}
+	assert.NoError(t, i.cloneInfraDeployments(context.Background()))
+
+	// The change of the fork is rebased on top of upstream main
+	repo, err := git.PlainOpen(i.InfraDeploymentsCloneDir)
+	assert.NoError(t, err)
+	head, err := repo.Head()
+	assert.NoError(t, err)
+	commit, err := repo.CommitObject(head.Hash())
+	assert.NoError(t, err)
+	assert.Equal(t, "update fork-change", commit.Message)
+	assert.Equal(t, []plumbing.Hash{upstreamHead}, commit.ParentHashes)
+}
+
+func TestSplitList(t *testing.T) {
+	assert.Equal(t, []string{"main", "release"}, splitList(" main, ,release,"))
+	assert.Nil(t, splitList(""))
+}
+
+func TestFailIfCloneExists(t *testing.T) {
+	sourceDir, _ := newFixtureRepo(t)
+	cloneDir := filepath.Join(t.TempDir(), "infra-deployments")
+	assert.NoError(t, os.MkdirAll(cloneDir, 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(cloneDir, "local-work"), []byte("keep me"), 0600))
+	i := &InstallAppStudio{
+		InfraDeploymentsCloneDir:         cloneDir,
+		InfraDeploymentsBranch:           "main",
+		InfraDeploymentsOrganizationName: "redhat-appstudio",
+		InfraDeploymentsCommit:           "main",
+		NoFork:                           true,
+		FailIfCloneExists:                true,
+		cloneURL:                         sourceDir,
+	}
+
+	assert.ErrorContains(t, i.cloneInfraDeployments(context.Background()), "clone directory "+cloneDir+" already exists")
+	assert.FileExists(t, filepath.Join(cloneDir, "local-work"))
+
+	// The existing directory is rejected before a GitHub App token is minted
+	key, encodedKey := newTestGitHubAppKey(t)
+	server, minted := newFakeGitHubAPI(t, key, time.Hour)
+	tokens, err := newGitHubAppTokenSource("12345", encodedKey, "my-org/infra-deployments", i.httpClient())
+	assert.NoError(t, err)
+	tokens.apiURL = server.URL
+	i.UseGitHubAppAuth, i.githubAppTokens = true, tokens
+	assert.ErrorContains(t, i.cloneInfraDeployments(context.Background()), "clone directory "+cloneDir+" already exists")
+	assert.Equal(t, 0, *minted)
+	i.UseGitHubAppAuth, i.githubAppTokens = false, nil
+
+	// By default the directory is replaced by the clone
+	i.FailIfCloneExists = false
+	assert.NoError(t, i.cloneInfraDeployments(context.Background()))
+	assert.NoFileExists(t, filepath.Join(cloneDir, "local-work"))
+}
+
+func TestBootstrapArgs(t *testing.T) {
+	assert.Equal(t, []string{"preview", "--keycloak", "--toolchain"}, (&InstallAppStudio{}).bootstrapArgs())
+	assert.Equal(t, []string{"preview", "--keycloak", "--toolchain"}, (&InstallAppStudio{Components: []string{ComponentsAll}}).bootstrapArgs())
+	assert.Equal(t, []string{"preview", "--toolchain"}, (&InstallAppStudio{Components: []string{"toolchain"}}).bootstrapArgs())
+	assert.Equal(t, []string{"preview", "--keycloak", "--toolchain"}, (&InstallAppStudio{Components: []string{"toolchain", "keycloak"}}).bootstrapArgs())
+
+	assert.NoError(t, (&InstallAppStudio{SkipQuaySecret: true, Components: []string{"keycloak", ComponentsAll}}).Validate())
+	assert.ErrorContains(t, (&InstallAppStudio{SkipQuaySecret: true, Components: []string{"keycloak", "spi"}}).Validate(), `unknown component "spi"`)
+}
+
+func TestEnsureNamespace(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	i := &InstallAppStudio{clientset: clientset}
+
+	// Created with the metadata
+	assert.NoError(t, i.ensureNamespace(ctx, "test", map[string]string{"team": "konflux"}, map[string]string{"owner": "e2e"}))
+	ns, err := clientset.CoreV1().Namespaces().Get(ctx, "test", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "konflux"}, ns.Labels)
+	assert.Equal(t, map[string]string{"owner": "e2e"}, ns.Annotations)
+
+	// Existing metadata is kept and the missing is added
+	assert.NoError(t, i.ensureNamespace(ctx, "test", map[string]string{"tier": "e2e"}, nil))
+	ns, err = clientset.CoreV1().Namespaces().Get(ctx, "test", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "konflux", "tier": "e2e"}, ns.Labels)
+	assert.Equal(t, map[string]string{"owner": "e2e"}, ns.Annotations)
+
+	// Nothing is updated when the namespace is up to date
+	clientset.ClearActions()
+	assert.NoError(t, i.ensureNamespace(ctx, "test", map[string]string{"tier": "e2e"}, map[string]string{"owner": "e2e"}))
+	for _, action := range clientset.Actions() {
+		assert.Equal(t, "get", action.GetVerb())
+	}
+}
+
+func TestEnsureNamespaceCreatedConcurrently(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		// Someone else creates the namespace right before the installer
+		_ = clientset.Tracker().Add(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test", Labels: map[string]string{"team": "other"}}})
+		return true, nil, k8sErrors.NewAlreadyExists(corev1.Resource("namespaces"), "test")
+	})
+	i := &InstallAppStudio{clientset: clientset}
+
+	assert.NoError(t, i.ensureNamespace(context.Background(), "test", map[string]string{"tier": "e2e"}, nil))
+	ns, err := clientset.CoreV1().Namespaces().Get(context.Background(), "test", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "other", "tier": "e2e"}, ns.Labels)
+}
+
+func TestEnsureNamespaceForbidden(t *testing.T) {
+	for reason, expected := range map[string]string{
+		`exceeded quota: namespace-quota, requested: count/namespaces=1, used: count/namespaces=50, limited: count/namespaces=50`: "the quota namespace-quota is exceeded",
+		`admission webhook "namespace.policy.example.com" denied the request: missing owner label`:                                "denied by the admission webhook namespace.policy.example.com",
+		`User "system:serviceaccount:ci:installer" cannot create resource "namespaces"`:                                           "check the RBAC permissions",
+	} {
+		clientset := fake.NewSimpleClientset()
+		clientset.PrependReactor("create", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, k8sErrors.NewForbidden(corev1.Resource("namespaces"), "e2e-secrets", errors.New(reason))
+		})
+		i := &InstallAppStudio{clientset: clientset, SecretSource: fakeSecretSource{dockerConfig: []byte(testDockerConfig)}}
+
+		err := i.createE2EQuaySecret(context.Background())
+		assert.ErrorContains(t, err, "error when creating namespace e2e-secrets")
+		assert.ErrorContains(t, err, reason)
+		assert.ErrorContains(t, err, expected)
+	}
+}
@@ -0,0 +1,42 @@
+package installation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/devfile/library/v2/pkg/util"
+	"github.com/konflux-ci/e2e-tests/pkg/constants"
+	"k8s.io/klog/v2"
+)
+
+// Length of the InstanceSuffix generated when GenerateInstanceSuffix is set
+const generatedInstanceSuffixLength = 6
+
+// setInstanceSuffix generates InstanceSuffix when GenerateInstanceSuffix is set and no suffix is configured
+func (i *InstallAppStudio) setInstanceSuffix() {
+	if i.GenerateInstanceSuffix && i.InstanceSuffix == "" {
+		i.InstanceSuffix = strings.ToLower(util.GenerateRandomString(generatedInstanceSuffixLength))
+		klog.Infof("using instance suffix %s for the created resources", i.InstanceSuffix)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.result.InstanceSuffix = i.InstanceSuffix
+}
+
+// withInstanceSuffix appends InstanceSuffix to the name of a resource created by the installation
+func (i *InstallAppStudio) withInstanceSuffix(name string) string {
+	if i.InstanceSuffix == "" || name == "" {
+		return name
+	}
+	return fmt.Sprintf("%s-%s", name, i.InstanceSuffix)
+}
+
+// quaySecretName returns the name of the e2e quay secret of this installation
+func (i *InstallAppStudio) quaySecretName() string {
+	return i.withInstanceSuffix(constants.QuayRepositorySecretName)
+}
+
+// e2eApplicationsNamespace returns E2EApplicationsNamespace with the InstanceSuffix of this installation
+func (i *InstallAppStudio) e2eApplicationsNamespace() string {
+	return i.withInstanceSuffix(i.E2EApplicationsNamespace)
+}
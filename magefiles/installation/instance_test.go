@@ -0,0 +1,105 @@
+package installation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/konflux-ci/e2e-tests/pkg/constants"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestInstanceSuffixNames(t *testing.T) {
+	unsuffixed := &InstallAppStudio{E2EApplicationsNamespace: "e2e-apps"}
+	first := &InstallAppStudio{E2EApplicationsNamespace: "e2e-apps", InstanceSuffix: "abc"}
+	second := &InstallAppStudio{E2EApplicationsNamespace: "e2e-apps", InstanceSuffix: "xyz"}
+
+	assert.Equal(t, constants.QuayRepositorySecretName, unsuffixed.quaySecretName())
+	assert.Equal(t, "e2e-apps", unsuffixed.e2eApplicationsNamespace())
+	_, name := unsuffixed.installedRefConfigMap()
+	assert.Equal(t, defaultInstalledRefConfigMap, name)
+
+	assert.Equal(t, constants.QuayRepositorySecretName+"-abc", first.quaySecretName())
+	assert.Equal(t, "e2e-apps-abc", first.e2eApplicationsNamespace())
+	_, firstName := first.installedRefConfigMap()
+	assert.Equal(t, defaultInstalledRefConfigMap+"-abc", firstName)
+
+	assert.NotEqual(t, first.quaySecretName(), second.quaySecretName())
+	assert.NotEqual(t, first.e2eApplicationsNamespace(), second.e2eApplicationsNamespace())
+	_, secondName := second.installedRefConfigMap()
+	assert.NotEqual(t, firstName, secondName)
+}
+
+func TestGenerateInstanceSuffix(t *testing.T) {
+	first := &InstallAppStudio{GenerateInstanceSuffix: true}
+	second := &InstallAppStudio{GenerateInstanceSuffix: true}
+	first.setInstanceSuffix()
+	second.setInstanceSuffix()
+
+	assert.Len(t, first.InstanceSuffix, generatedInstanceSuffixLength)
+	assert.Equal(t, first.InstanceSuffix, first.Result().InstanceSuffix)
+	assert.NotEqual(t, first.InstanceSuffix, second.InstanceSuffix)
+
+	// A configured suffix is kept
+	configured := &InstallAppStudio{GenerateInstanceSuffix: true, InstanceSuffix: "abc"}
+	configured.setInstanceSuffix()
+	assert.Equal(t, "abc", configured.InstanceSuffix)
+}
+
+func TestCreateE2EQuaySecretWithInstanceSuffix(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	for _, suffix := range []string{"abc", "xyz"} {
+		i := &InstallAppStudio{
+			clientset:      clientset,
+			SecretSource:   fakeSecretSource{dockerConfig: []byte(testDockerConfig)},
+			InstanceSuffix: suffix,
+		}
+		assert.NoError(t, i.createE2EQuaySecret(context.Background()))
+	}
+
+	secrets, err := clientset.CoreV1().Secrets(constants.QuayRepositorySecretNamespace).List(context.Background(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	var names []string
+	for _, secret := range secrets.Items {
+		names = append(names, secret.Name)
+	}
+	assert.ElementsMatch(t, []string{constants.QuayRepositorySecretName + "-abc", constants.QuayRepositorySecretName + "-xyz"}, names)
+}
+
+func TestUninstallWithInstanceSuffix(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: constants.QuayRepositorySecretNamespace}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "e2e-apps-abc"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "e2e-apps-xyz"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: constants.QuayRepositorySecretName + "-abc", Namespace: constants.QuayRepositorySecretNamespace}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: constants.QuayRepositorySecretName + "-xyz", Namespace: constants.QuayRepositorySecretNamespace}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: defaultInstalledRefConfigMap + "-abc", Namespace: defaultInstalledRefNamespace}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: defaultInstalledRefConfigMap + "-xyz", Namespace: defaultInstalledRefNamespace}},
+	)
+	i := &InstallAppStudio{clientset: clientset, E2EApplicationsNamespace: "e2e-apps", InstanceSuffix: "abc"}
+	i.touchNamespace(constants.QuayRepositorySecretNamespace)
+	i.touchNamespace("e2e-apps-abc")
+
+	assert.NoError(t, i.Uninstall(context.Background()))
+
+	ctx := context.Background()
+	_, err := clientset.CoreV1().Namespaces().Get(ctx, "e2e-apps-abc", metav1.GetOptions{})
+	assert.True(t, k8sErrors.IsNotFound(err))
+	_, err = clientset.CoreV1().Secrets(constants.QuayRepositorySecretNamespace).Get(ctx, constants.QuayRepositorySecretName+"-abc", metav1.GetOptions{})
+	assert.True(t, k8sErrors.IsNotFound(err))
+	_, err = clientset.CoreV1().ConfigMaps(defaultInstalledRefNamespace).Get(ctx, defaultInstalledRefConfigMap+"-abc", metav1.GetOptions{})
+	assert.True(t, k8sErrors.IsNotFound(err))
+
+	// The resources of the other installation and the shared namespace are kept
+	for _, namespace := range []string{constants.QuayRepositorySecretNamespace, "e2e-apps-xyz"} {
+		_, err = clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+		assert.NoError(t, err)
+	}
+	_, err = clientset.CoreV1().Secrets(constants.QuayRepositorySecretNamespace).Get(ctx, constants.QuayRepositorySecretName+"-xyz", metav1.GetOptions{})
+	assert.NoError(t, err)
+	_, err = clientset.CoreV1().ConfigMaps(defaultInstalledRefNamespace).Get(ctx, defaultInstalledRefConfigMap+"-xyz", metav1.GetOptions{})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,201 @@
+package installation
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/go-logr/logr/funcr"
+	"k8s.io/klog/v2"
+)
+
+// Supported formats of the installer logs
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Rotation of LogFilePath when LogFileMaxBytes and LogFileMaxBackups are not set
+const (
+	defaultLogFileMaxBytes   int64 = 100 << 20
+	defaultLogFileMaxBackups       = 3
+)
+
+// configureLogging routes the klog output through a JSON logger writing into w when LogFormat is json,
+// so every log line is a parseable object, and applies LogVerbosity. With LogFilePath the logs are also written
+// to a size-rotated file. The returned function restores the previous configuration.
+func (i *InstallAppStudio) configureLogging(w io.Writer) (func(), error) {
+	if i.LogFormat != "" && i.LogFormat != LogFormatText && i.LogFormat != LogFormatJSON {
+		return nil, fmt.Errorf("unsupported log format '%s', use one of: %s, %s", i.LogFormat, LogFormatText, LogFormatJSON)
+	}
+
+	var restores []func()
+	restore := func() {
+		for index := len(restores) - 1; index >= 0; index-- {
+			restores[index]()
+		}
+	}
+
+	flags := map[string]string{}
+	if i.LogVerbosity > 0 {
+		flags["v"] = strconv.Itoa(i.LogVerbosity)
+	}
+	if i.LogFilePath != "" {
+		logFile, err := openRotatingFile(i.LogFilePath, i.LogFileMaxBytes, i.LogFileMaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		restores = append(restores, func() { logFile.Close() })
+		w = io.MultiWriter(w, logFile)
+		if i.LogFormat != LogFormatJSON {
+			// klog writes into the output set by SetOutput only when it doesn't log to stderr, and writes
+			// each line once instead of into the writer of every lower severity only with one_output
+			flags["logtostderr"], flags["one_output"] = "false", "true"
+			klog.SetOutput(w)
+			restores = append(restores, func() { klog.SetOutput(os.Stderr) })
+		}
+	}
+	if len(flags) > 0 {
+		restoreFlags, err := setKlogFlags(flags)
+		if err != nil {
+			restore()
+			return nil, err
+		}
+		restores = append(restores, restoreFlags)
+	}
+
+	if i.LogFormat == LogFormatJSON {
+		klog.SetLogger(funcr.NewJSON(func(obj string) { fmt.Fprintln(w, obj) }, funcr.Options{LogTimestamp: true, Verbosity: i.LogVerbosity}))
+		restores = append(restores, klog.ClearLogger)
+	}
+
+	return restore, nil
+}
+
+// setKlogFlags sets global klog flags, e.g. the verbosity, without parsing the command line flags.
+// The returned function restores the previous values.
+func setKlogFlags(values map[string]string) (func(), error) {
+	flags := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(flags)
+
+	previous := map[string]string{}
+	restore := func() {
+		for name, value := range previous {
+			if err := flags.Set(name, value); err != nil {
+				klog.Warningf("failed to restore log flag %s=%s: %+v", name, value, err)
+			}
+		}
+	}
+	for name, value := range values {
+		current := flags.Lookup(name)
+		if current == nil {
+			restore()
+			return nil, fmt.Errorf("unknown log flag %s", name)
+		}
+		previousValue := current.Value.String()
+		if err := flags.Set(name, value); err != nil {
+			restore()
+			return nil, fmt.Errorf("failed to set log flag %s=%s: %+v", name, value, err)
+		}
+		previous[name] = previousValue
+	}
+	return restore, nil
+}
+
+// rotatingFile is a log file which is rotated when it would grow over maxBytes. The rotated files are kept
+// as path.1 (the newest) to path.<maxBackups>. It is safe for concurrent use
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxBytes   int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// openRotatingFile opens the log file for appending, zero maxBytes and negative maxBackups select the defaults
+func openRotatingFile(path string, maxBytes int64, maxBackups int) (*rotatingFile, error) {
+	if maxBytes <= 0 {
+		maxBytes = defaultLogFileMaxBytes
+	}
+	if maxBackups < 0 {
+		maxBackups = defaultLogFileMaxBackups
+	}
+	f := &rotatingFile{path: filepath.Clean(path), maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s: %+v", f.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open log file %s: %+v", f.path, err)
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, fmt.Errorf("log file %s is closed", f.path)
+	}
+	if f.size > 0 && f.size+int64(len(p)) > f.maxBytes {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the rotated files by one, dropping the oldest, and starts a new log file
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file %s: %+v", f.path, err)
+	}
+	f.file = nil
+
+	if f.maxBackups == 0 {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate log file %s: %+v", f.path, err)
+		}
+		return f.open()
+	}
+	for index := f.maxBackups - 1; index >= 1; index-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", f.path, index), fmt.Sprintf("%s.%d", f.path, index+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate log file %s: %+v", f.path, err)
+		}
+	}
+	if err := os.Rename(f.path, f.path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate log file %s: %+v", f.path, err)
+	}
+	return f.open()
+}
+
+// Close closes the log file, later writes fail
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,149 @@
+package installation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/klog/v2"
+)
+
+func TestJSONLogFormat(t *testing.T) {
+	var out bytes.Buffer
+	i := &InstallAppStudio{LogFormat: LogFormatJSON}
+	restore, err := i.configureLogging(&out)
+	assert.NoError(t, err)
+	defer restore()
+
+	err = i.runPhases(context.Background(), []installPhase{
+		noopPhase(PhaseClone, 20),
+		{name: PhaseBootstrap, weight: 70, run: func(ctx context.Context) error { return fmt.Errorf("bootstrap failed") }},
+	})
+	assert.Error(t, err)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 4)
+	for _, line := range lines {
+		entry := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry), line)
+		assert.Contains(t, entry, "phase")
+		assert.Contains(t, entry, "msg")
+	}
+
+	failure := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[3]), &failure))
+	assert.Equal(t, PhaseBootstrap, failure["phase"])
+	assert.Equal(t, "bootstrap failed", failure["error"])
+}
+
+func TestUnsupportedLogFormat(t *testing.T) {
+	_, err := (&InstallAppStudio{LogFormat: "xml"}).configureLogging(&bytes.Buffer{})
+	assert.ErrorContains(t, err, "unsupported log format 'xml'")
+}
+
+func TestLogVerbosity(t *testing.T) {
+	assert.False(t, klog.V(4).Enabled())
+
+	restore, err := (&InstallAppStudio{LogVerbosity: 4}).configureLogging(&bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.True(t, klog.V(4).Enabled())
+	assert.False(t, klog.V(5).Enabled())
+
+	restore()
+	assert.False(t, klog.V(4).Enabled())
+}
+
+func TestLogVerbosityJSON(t *testing.T) {
+	var out bytes.Buffer
+	restore, err := (&InstallAppStudio{LogFormat: LogFormatJSON, LogVerbosity: 4}).configureLogging(&out)
+	assert.NoError(t, err)
+	klog.V(4).InfoS("transport request", "url", "https://quay.io/v2/")
+	klog.V(5).InfoS("too verbose")
+	klog.Flush()
+	restore()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 1, out.String())
+	entry := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "transport request", entry["msg"])
+	assert.Equal(t, "https://quay.io/v2/", entry["url"])
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "install.log")
+	f, err := openRotatingFile(path, 20, 2)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	for _, line := range []string{"first line\n", "second line\n", "third line\n", "fourth line\n"} {
+		_, err := f.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+
+	// Every line crosses the threshold, the oldest rotated file is dropped
+	for file, content := range map[string]string{path: "fourth line\n", path + ".1": "third line\n", path + ".2": "second line\n"} {
+		data, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		assert.Equal(t, content, string(data), file)
+	}
+	assert.NoFileExists(t, path+".3")
+}
+
+func TestRotatingFileConcurrentWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "install.log")
+	f, err := openRotatingFile(path, 1000, 100)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 10; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				_, err := fmt.Fprintf(f, "writer %d line %02d\n", w, n)
+				assert.NoError(t, err)
+			}
+		}(w)
+	}
+	wg.Wait()
+	assert.NoError(t, f.Close())
+
+	files, err := filepath.Glob(path + "*")
+	assert.NoError(t, err)
+	assert.Greater(t, len(files), 1)
+	lines := 0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, len(data), 1000)
+		for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			assert.Regexp(t, `^writer \d line \d\d$`, line)
+			lines++
+		}
+	}
+	assert.Equal(t, 1000, lines)
+}
+
+func TestLogFilePath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "install.log")
+	restore, err := (&InstallAppStudio{LogFilePath: path}).configureLogging(&bytes.Buffer{})
+	assert.NoError(t, err)
+	klog.Infof("logged into the file")
+	klog.Errorf("logged error")
+	restore()
+	klog.Infof("not logged into the file")
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "logged into the file")
+	assert.Equal(t, 1, strings.Count(string(data), "logged error"))
+	assert.NotContains(t, string(data), "not logged")
+}
@@ -0,0 +1,111 @@
+package installation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/klog/v2"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Field manager used for server-side apply of the installer's resources
+const fieldManager = "e2e-tests-installer"
+
+// applyExtraManifests server-side applies all manifests listed in ExtraManifests. Directories are searched
+// recursively for .yaml, .yml and .json files. All manifests are applied even if some of them fail.
+func (i *InstallAppStudio) applyExtraManifests(ctx context.Context) error {
+	if len(i.ExtraManifests) == 0 {
+		return nil
+	}
+	if err := i.checkKubeRest(); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, path := range i.ExtraManifests {
+		files, err := manifestFiles(path)
+		if err != nil {
+			klog.Errorf("failed to read manifests from %s: %+v", path, err)
+			errs = append(errs, fmt.Errorf("failed to read manifests from %s: %w", path, err))
+			continue
+		}
+
+		for _, file := range files {
+			if err := i.applyManifestFile(ctx, file); err != nil {
+				klog.Errorf("failed to apply manifest %s: %+v", file, err)
+				errs = append(errs, fmt.Errorf("failed to apply manifest %s: %w", file, err))
+				continue
+			}
+			klog.Infof("applied manifest %s", file)
+		}
+	}
+
+	// All failures are reported at once
+	return errors.Join(errs...)
+}
+
+func manifestFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch filepath.Ext(file) {
+		case ".yaml", ".yml", ".json":
+			if !d.IsDir() {
+				files = append(files, file)
+			}
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+// applyManifestFile server-side applies every object of a (possibly multi-document) manifest file
+func (i *InstallAppStudio) applyManifestFile(ctx context.Context, file string) error {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// The remaining objects of the file are applied even if some of them fail
+	var errs []error
+	decoder := yaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.Join(errs...)
+			}
+			return errors.Join(append(errs, err)...)
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+
+		if err := i.kubeRest().Patch(ctx, obj, crclient.Apply, crclient.ForceOwnership, crclient.FieldOwner(fieldManager)); err != nil {
+			errs = append(errs, fmt.Errorf("failed to apply %s %s: %w", obj.GetKind(), obj.GetName(), err))
+		} else if obj.GetKind() == "Namespace" {
+			i.touchNamespace(obj.GetName())
+		} else {
+			i.touchNamespace(obj.GetNamespace())
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package installation
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+const testConfigMapManifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: extra
+  namespace: default
+data:
+  key: value
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: another
+  namespace: default
+`
+
+// newFakeApplyClient returns a fake controller-runtime client which creates the objects of apply patches,
+// since the fake client doesn't support server-side apply
+func newFakeApplyClient() crclient.Client {
+	return fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, client crclient.WithWatch, obj crclient.Object, patch crclient.Patch, opts ...crclient.PatchOption) error {
+			if patch.Type() == types.ApplyPatchType {
+				return client.Create(ctx, obj)
+			}
+			return client.Patch(ctx, obj, patch, opts...)
+		},
+	}).Build()
+}
+
+func TestApplyExtraManifests(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "configmaps.yaml"), []byte(testConfigMapManifest), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a manifest"), 0600))
+	i := &InstallAppStudio{crClient: newFakeApplyClient(), ExtraManifests: []string{dir}}
+
+	assert.NoError(t, i.applyExtraManifests(context.Background()))
+
+	cm := &corev1.ConfigMap{}
+	assert.NoError(t, i.kubeRest().Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "extra"}, cm))
+	assert.Equal(t, "value", cm.Data["key"])
+	assert.NoError(t, i.kubeRest().Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "another"}, &corev1.ConfigMap{}))
+}
+
+func TestApplyExtraManifestsReportsFailures(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.yaml")
+	assert.NoError(t, os.WriteFile(invalid, []byte("kind: ["), 0600))
+	missing := filepath.Join(dir, "missing.yaml")
+	i := &InstallAppStudio{crClient: newFakeApplyClient(), ExtraManifests: []string{invalid, missing}}
+
+	err := i.applyExtraManifests(context.Background())
+	assert.ErrorContains(t, err, invalid)
+	assert.ErrorContains(t, err, missing)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestApplyExtraManifestsReportsAllFailures(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "configmaps.yaml"), []byte(testConfigMapManifest), 0600))
+	client := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, client crclient.WithWatch, obj crclient.Object, patch crclient.Patch, opts ...crclient.PatchOption) error {
+			return k8sErrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, obj.GetName(), errors.New("not allowed"))
+		},
+	}).Build()
+	missing := filepath.Join(dir, "missing")
+	i := &InstallAppStudio{crClient: client, ExtraManifests: []string{dir, missing}}
+
+	err := i.applyExtraManifests(context.Background())
+	// The failed manifest file, with both of its objects, and the missing path are reported together
+	if joined, ok := err.(interface{ Unwrap() []error }); assert.True(t, ok) {
+		assert.Len(t, joined.Unwrap(), 2)
+	}
+	assert.ErrorContains(t, err, `configmaps "extra" is forbidden`)
+	assert.ErrorContains(t, err, `configmaps "another" is forbidden`)
+	assert.ErrorContains(t, err, "failed to read manifests from "+missing)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
@@ -0,0 +1,52 @@
+package installation
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Prefix of the metrics written by WriteMetrics
+const metricsPrefix = "e2e_installer"
+
+// WriteMetrics writes the durations of the phases of the last installation and the number of succeeded
+// and failed runs of each phase in the Prometheus text exposition format
+func (i *InstallAppStudio) WriteMetrics(w io.Writer) error {
+	i.mu.Lock()
+	phases := append([]PhaseTiming(nil), i.result.Phases...)
+	names := make([]string, 0, len(i.phaseCounts))
+	counts := make(map[string]phaseCounts, len(i.phaseCounts))
+	for name, c := range i.phaseCounts {
+		names = append(names, name)
+		counts[name] = *c
+	}
+	i.mu.Unlock()
+	sort.Strings(names)
+
+	lines := []string{
+		fmt.Sprintf("# HELP %s_phase_duration_seconds Duration of the phases of the last installation.", metricsPrefix),
+		fmt.Sprintf("# TYPE %s_phase_duration_seconds gauge", metricsPrefix),
+	}
+	for _, phase := range phases {
+		lines = append(lines, fmt.Sprintf("%s_phase_duration_seconds{phase=%q} %g", metricsPrefix, phase.Name, phase.Duration.Seconds()))
+	}
+
+	lines = append(lines,
+		fmt.Sprintf("# HELP %s_phase_runs_total Number of runs of the installation phases by result.", metricsPrefix),
+		fmt.Sprintf("# TYPE %s_phase_runs_total counter", metricsPrefix),
+	)
+	for _, name := range names {
+		lines = append(lines,
+			fmt.Sprintf("%s_phase_runs_total{phase=%q,result=\"success\"} %d", metricsPrefix, name, counts[name].succeeded),
+			fmt.Sprintf("%s_phase_runs_total{phase=%q,result=\"failure\"} %d", metricsPrefix, name, counts[name].failed),
+		)
+	}
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return fmt.Errorf("failed to write metrics: %+v", err)
+		}
+	}
+
+	return nil
+}
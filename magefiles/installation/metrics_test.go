@@ -0,0 +1,40 @@
+package installation
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Matches the comment and sample lines of the Prometheus text format
+var metricLine = regexp.MustCompile(`^(# (HELP|TYPE) [a-z0-9_]+ .+|[a-z0-9_]+(\{([a-z]+="[^"]*",?)+\})? [0-9.e+-]+)$`)
+
+func TestWriteMetrics(t *testing.T) {
+	i := &InstallAppStudio{}
+	assert.NoError(t, i.runPhases(context.Background(), []installPhase{noopPhase(PhaseClone, 20), noopPhase(PhaseBootstrap, 70)}))
+	assert.Error(t, i.runPhases(context.Background(), []installPhase{
+		noopPhase(PhaseClone, 20),
+		{name: PhaseBootstrap, weight: 70, run: func(ctx context.Context) error { return fmt.Errorf("bootstrap failed") }},
+	}))
+
+	var out bytes.Buffer
+	assert.NoError(t, i.WriteMetrics(&out))
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		assert.Regexp(t, metricLine, line)
+	}
+
+	metrics := out.String()
+	assert.Contains(t, metrics, "# TYPE e2e_installer_phase_duration_seconds gauge\n")
+	assert.Contains(t, metrics, `e2e_installer_phase_duration_seconds{phase="clone"} `)
+	assert.Contains(t, metrics, `e2e_installer_phase_duration_seconds{phase="bootstrap"} `)
+	assert.Contains(t, metrics, "# TYPE e2e_installer_phase_runs_total counter\n")
+	assert.Contains(t, metrics, `e2e_installer_phase_runs_total{phase="clone",result="success"} 2`)
+	assert.Contains(t, metrics, `e2e_installer_phase_runs_total{phase="clone",result="failure"} 0`)
+	assert.Contains(t, metrics, `e2e_installer_phase_runs_total{phase="bootstrap",result="success"} 1`)
+	assert.Contains(t, metrics, `e2e_installer_phase_runs_total{phase="bootstrap",result="failure"} 1`)
+}
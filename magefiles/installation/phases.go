@@ -0,0 +1,170 @@
+package installation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Phases of the installation in preview mode, in the order they are executed
+const (
+	PhaseClone          = "clone"
+	PhaseBootstrap      = "bootstrap"
+	PhaseSPIConfig      = "spi-config"
+	PhaseExtraManifests = "extra-manifests"
+	PhaseQuaySecret     = "quay-secret"
+	PhaseNamespaceQuota = "namespace-quota"
+	PhaseRecordRef      = "record-ref"
+)
+
+// PhaseCallback is invoked after each completed installation phase with the estimated percentage of the installation done
+type PhaseCallback func(phase string, percent float64)
+
+// PhaseTiming describes an executed installation phase
+type PhaseTiming struct {
+	Name     string
+	Duration time.Duration
+	// Error returned by the phase, nil if it succeeded
+	Err error
+}
+
+// phaseCounts counts the runs of a phase across installations
+type phaseCounts struct {
+	succeeded, failed int
+}
+
+type installPhase struct {
+	name string
+	// relative duration of the phase, used to estimate the progress of the installation
+	weight float64
+	run    func(ctx context.Context) error
+	// skipped, if set, is invoked instead of run when a checkpoint skips the phase, to restore what later phases rely on
+	skipped func()
+}
+
+// runPhases executes the phases in order and stops at the first failing one
+func (i *InstallAppStudio) runPhases(ctx context.Context, phases []installPhase) error {
+	var total, completed float64
+	for _, phase := range phases {
+		total += phase.weight
+	}
+
+	i.setProgress(0)
+	i.mu.Lock()
+	i.result = InstallResult{InstanceSuffix: i.InstanceSuffix}
+	i.retriesSpent = 0
+	i.mu.Unlock()
+	checkpoint := i.loadCheckpoint()
+	for _, phase := range phases {
+		if i.checkpointed(checkpoint, phase.name) {
+			klog.InfoS("skipping installation phase completed by a previous run", "phase", phase.name)
+			if phase.skipped != nil {
+				phase.skipped()
+			}
+			completed += phase.weight
+			i.setProgress(completed / total * 100)
+			continue
+		}
+
+		klog.InfoS("starting installation phase", "phase", phase.name)
+		start := time.Now()
+		phaseCtx, cancel := context.WithCancel(ctx)
+		if timeout := i.phaseTimeout(phase.name); timeout > 0 {
+			phaseCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		err := phase.run(phaseCtx)
+		cancel()
+		i.recordPhase(PhaseTiming{Name: phase.name, Duration: time.Since(start), Err: err})
+		if err != nil {
+			klog.ErrorS(err, "installation phase failed", "phase", phase.name)
+			return err
+		}
+		i.saveCheckpoint(checkpoint, phase.name)
+
+		completed += phase.weight
+		i.setProgress(completed / total * 100)
+		klog.InfoS("installation phase completed", "phase", phase.name, "progress", i.Progress())
+		if i.PhaseCallback != nil {
+			i.PhaseCallback(phase.name, i.Progress())
+		}
+	}
+	i.removeCheckpoint()
+
+	return nil
+}
+
+// phaseTimeout returns how long the phase can run, zero if it's not limited
+func (i *InstallAppStudio) phaseTimeout(phase string) time.Duration {
+	return max(i.PhaseTimeouts[phase], 0)
+}
+
+// parsePhaseTimeouts parses the timeouts of phases in the PHASE_TIMEOUTS format, e.g. "clone=15m,bootstrap=90m"
+func parsePhaseTimeouts(timeouts string) (map[string]time.Duration, error) {
+	if len(splitList(timeouts)) == 0 {
+		return nil, nil
+	}
+	parsed := map[string]time.Duration{}
+	for _, item := range splitList(timeouts) {
+		phase, value, found := strings.Cut(item, "=")
+		timeout, err := time.ParseDuration(strings.TrimSpace(value))
+		if !found || strings.TrimSpace(phase) == "" || err != nil {
+			return nil, fmt.Errorf("invalid phase timeout %q, expected <phase>=<duration>, e.g. bootstrap=90m", item)
+		}
+		parsed[strings.TrimSpace(phase)] = timeout
+	}
+	return parsed, nil
+}
+
+// Progress returns the estimated percentage of the installation completed, based on the last completed phase
+func (i *InstallAppStudio) Progress() float64 {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.progress
+}
+
+func (i *InstallAppStudio) setProgress(progress float64) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.progress = progress
+}
+
+func (i *InstallAppStudio) recordPhase(timing PhaseTiming) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.result.Phases = append(i.result.Phases, timing)
+
+	if i.phaseCounts == nil {
+		i.phaseCounts = map[string]*phaseCounts{}
+	}
+	counts, ok := i.phaseCounts[timing.Name]
+	if !ok {
+		counts = &phaseCounts{}
+		i.phaseCounts[timing.Name] = counts
+	}
+	if timing.Err != nil {
+		counts.failed++
+	} else {
+		counts.succeeded++
+	}
+}
+
+// Returned by retrying operations once the RetryBudget of the installation is spent
+var errRetryBudgetExceeded = errors.New("retry budget of the installation exceeded")
+
+// spendRetry takes one retry from the RetryBudget shared by all operations of the installation
+func (i *InstallAppStudio) spendRetry() error {
+	if i.RetryBudget <= 0 {
+		return nil
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.retriesSpent >= i.RetryBudget {
+		return fmt.Errorf("%w (%d retries)", errRetryBudgetExceeded, i.RetryBudget)
+	}
+	i.retriesSpent++
+	return nil
+}
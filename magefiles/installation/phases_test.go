@@ -0,0 +1,143 @@
+package installation
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func noopPhase(name string, weight float64) installPhase {
+	return installPhase{name: name, weight: weight, run: func(ctx context.Context) error { return nil }}
+}
+
+func TestRunPhasesReportsMonotonicProgress(t *testing.T) {
+	var phases []string
+	var reported []float64
+	i := &InstallAppStudio{PhaseCallback: func(phase string, percent float64) {
+		phases = append(phases, phase)
+		reported = append(reported, percent)
+	}}
+
+	err := i.runPhases(context.Background(), []installPhase{
+		noopPhase(PhaseClone, 20),
+		noopPhase(PhaseBootstrap, 70),
+		noopPhase(PhaseQuaySecret, 10),
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{PhaseClone, PhaseBootstrap, PhaseQuaySecret}, phases)
+	assert.InDeltaSlice(t, []float64{20, 90, 100}, reported, 0.001)
+	assert.IsIncreasing(t, reported)
+	assert.InDelta(t, 100, i.Progress(), 0.001)
+}
+
+func TestRunPhasesStopsOnFailure(t *testing.T) {
+	i := &InstallAppStudio{}
+
+	err := i.runPhases(context.Background(), []installPhase{
+		noopPhase(PhaseClone, 20),
+		{name: PhaseBootstrap, weight: 70, run: func(ctx context.Context) error { return fmt.Errorf("bootstrap failed") }},
+		noopPhase(PhaseQuaySecret, 10),
+	})
+	assert.EqualError(t, err, "bootstrap failed")
+	assert.InDelta(t, 20, i.Progress(), 0.001)
+}
+
+func TestRunPhasesRecordsTimings(t *testing.T) {
+	i := &InstallAppStudio{}
+
+	err := i.runPhases(context.Background(), []installPhase{
+		noopPhase(PhaseClone, 20),
+		{name: PhaseBootstrap, weight: 70, run: func(ctx context.Context) error { return fmt.Errorf("bootstrap failed") }},
+		noopPhase(PhaseQuaySecret, 10),
+	})
+	assert.Error(t, err)
+
+	phases := i.Result().Phases
+	if assert.Len(t, phases, 2) {
+		assert.Equal(t, PhaseClone, phases[0].Name)
+		assert.NoError(t, phases[0].Err)
+		assert.Equal(t, PhaseBootstrap, phases[1].Name)
+		assert.EqualError(t, phases[1].Err, "bootstrap failed")
+	}
+}
+
+func TestRunPhasesAppliesPhaseTimeouts(t *testing.T) {
+	deadlines := map[string]time.Duration{}
+	recordDeadline := func(name string) installPhase {
+		return installPhase{name: name, weight: 1, run: func(ctx context.Context) error {
+			if deadline, ok := ctx.Deadline(); ok {
+				deadlines[name] = time.Until(deadline)
+			}
+			return nil
+		}}
+	}
+	i := &InstallAppStudio{PhaseTimeouts: map[string]time.Duration{PhaseBootstrap: 30 * time.Minute, PhaseQuaySecret: time.Minute, "custom": 0}}
+
+	err := i.runPhases(context.Background(), []installPhase{recordDeadline(PhaseClone), recordDeadline(PhaseBootstrap), recordDeadline(PhaseQuaySecret), recordDeadline("custom")})
+	assert.NoError(t, err)
+	assert.InDelta(t, 30*time.Minute, deadlines[PhaseBootstrap], float64(time.Second))
+	assert.InDelta(t, time.Minute, deadlines[PhaseQuaySecret], float64(time.Second))
+	// The phases without a configured timeout are not limited
+	assert.NotContains(t, deadlines, PhaseClone)
+	assert.NotContains(t, deadlines, "custom")
+}
+
+func TestParsePhaseTimeouts(t *testing.T) {
+	timeouts, err := parsePhaseTimeouts("clone=15m, bootstrap=1h30m")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{PhaseClone: 15 * time.Minute, PhaseBootstrap: 90 * time.Minute}, timeouts)
+
+	timeouts, err = parsePhaseTimeouts("")
+	assert.NoError(t, err)
+	assert.Nil(t, timeouts)
+
+	_, err = parsePhaseTimeouts("bootstrap")
+	assert.EqualError(t, err, `invalid phase timeout "bootstrap", expected <phase>=<duration>, e.g. bootstrap=90m`)
+	_, err = parsePhaseTimeouts("bootstrap=soon")
+	assert.ErrorContains(t, err, `invalid phase timeout "bootstrap=soon"`)
+}
+
+func TestRunPhasesTimesOutPhase(t *testing.T) {
+	i := &InstallAppStudio{PhaseTimeouts: map[string]time.Duration{PhaseQuaySecret: 10 * time.Millisecond}}
+
+	err := i.runPhases(context.Background(), []installPhase{{name: PhaseQuaySecret, weight: 1, run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRetryBudgetIsSharedAcrossOperations(t *testing.T) {
+	createRemoteRetryDelay = time.Millisecond
+	_, fixture := newFixtureRepo(t)
+	clientset := fake.NewSimpleClientset()
+	namespaceGets := 0
+	clientset.PrependReactor("get", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		namespaceGets++
+		return true, nil, k8sErrors.NewServiceUnavailable("api server is starting")
+	})
+	i := &InstallAppStudio{clientset: clientset, RetryBudget: 3}
+
+	// Two failures of the remote creation take two retries from the budget...
+	assert.NoError(t, i.ensureRemote(context.Background(), &flakyRemoteRepository{Repository: fixture, failures: 2}, "upstream", "https://github.com/redhat-appstudio/infra-deployments.git"))
+	// ...so the namespace get is retried only once before the budget runs out
+	err := i.ensureNamespace(context.Background(), "test", nil, nil)
+	assert.ErrorContains(t, err, "retry budget of the installation exceeded (3 retries); last error: api server is starting")
+	assert.Equal(t, 2, namespaceGets)
+
+	err = i.ensureRemote(context.Background(), &flakyRemoteRepository{Repository: fixture, failures: 1}, "fork", "https://github.com/my-org/infra-deployments.git")
+	assert.ErrorIs(t, err, errRetryBudgetExceeded)
+
+	// A new installation gets the whole budget again
+	assert.NoError(t, i.runPhases(context.Background(), []installPhase{{name: PhaseClone, weight: 1, run: func(ctx context.Context) error {
+		return i.ensureRemote(ctx, &flakyRemoteRepository{Repository: fixture, failures: 2}, "fork", "https://github.com/my-org/infra-deployments.git")
+	}}}))
+}
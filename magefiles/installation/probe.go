@@ -0,0 +1,93 @@
+package installation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// Image pulled by the pull secret probe when PullSecretProbeImage is not set
+const defaultPullSecretProbeImage = "registry.access.redhat.com/ubi9/ubi-micro:latest"
+
+// Image references: an optional registry host with port, lower case path components, and an optional tag and digest
+var imageReferenceRegexp = regexp.MustCompile(`^([a-zA-Z0-9.-]+(:[0-9]+)?/)?[a-z0-9]+([._-][a-z0-9]+)*(/[a-z0-9]+([._-][a-z0-9]+)*)*(:[\w][\w.-]{0,127})?(@sha256:[a-f0-9]{64})?$`)
+
+// Reasons of waiting containers whose image can't be pulled
+var imagePullFailureReasons = []string{"ErrImagePull", "ImagePullBackOff", "InvalidImageName"}
+
+// pullSecretProbeImage returns the validated image of the pull secret probe
+func (i *InstallAppStudio) pullSecretProbeImage() (string, error) {
+	image := i.PullSecretProbeImage
+	if image == "" {
+		image = defaultPullSecretProbeImage
+	}
+	if !imageReferenceRegexp.MatchString(image) {
+		return "", fmt.Errorf("invalid pull secret probe image %q: must be an image reference like quay.io/org/image:tag", image)
+	}
+	return image, nil
+}
+
+// VerifyPullSecretWithProbe checks that the pull secret works by running a pod in the namespace which pulls
+// PullSecretProbeImage with it. The probe pod is deleted afterwards.
+func (i *InstallAppStudio) VerifyPullSecretWithProbe(ctx context.Context, namespace, pullSecret string, timeout time.Duration) error {
+	image, err := i.pullSecretProbeImage()
+	if err != nil {
+		return err
+	}
+	if err := i.checkKubeClient(); err != nil {
+		return err
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "pull-secret-probe-", Namespace: namespace},
+		Spec: corev1.PodSpec{
+			RestartPolicy:    corev1.RestartPolicyNever,
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: pullSecret}},
+			Containers:       []corev1.Container{{Name: "probe", Image: image, ImagePullPolicy: corev1.PullAlways}},
+		},
+	}
+	pod, err = i.kubeClient().CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create pull secret probe pod in namespace %s: %+v", namespace, err)
+	}
+	defer func() {
+		if err := i.kubeClient().CoreV1().Pods(namespace).Delete(context.WithoutCancel(ctx), pod.Name, metav1.DeleteOptions{}); err != nil {
+			klog.Warningf("failed to delete pull secret probe pod %s/%s: %+v", namespace, pod.Name, err)
+		}
+	}()
+
+	var pullErr error
+	err = wait.PollUntilContextTimeout(ctx, i.pollInterval(), timeout, true, func(ctx context.Context) (bool, error) {
+		current, err := i.kubeClient().CoreV1().Pods(namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			klog.Warningf("failed to get pull secret probe pod %s/%s: %+v", namespace, pod.Name, err)
+			return false, nil
+		}
+		for _, status := range current.Status.ContainerStatuses {
+			if status.ImageID != "" || status.State.Running != nil || status.State.Terminated != nil {
+				return true, nil
+			}
+			if waiting := status.State.Waiting; waiting != nil && slices.Contains(imagePullFailureReasons, waiting.Reason) {
+				pullErr = fmt.Errorf("failed to pull image %s with secret %s: %s: %s", image, pullSecret, waiting.Reason, waiting.Message)
+				return false, pullErr
+			}
+		}
+		return false, nil
+	})
+	if pullErr != nil {
+		return pullErr
+	}
+	if err != nil {
+		return fmt.Errorf("pull secret probe pod %s/%s didn't pull image %s in %v: %+v", namespace, pod.Name, image, timeout, err)
+	}
+	klog.Infof("pull secret %s/%s can pull image %s", namespace, pullSecret, image)
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package installation
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newProbeClientset returns a fake clientset naming the created probe pods, which reports the given status of their container
+func newProbeClientset(status corev1.ContainerStatus) (*fake.Clientset, *[]*corev1.Pod) {
+	clientset := fake.NewSimpleClientset()
+	var created []*corev1.Pod
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		pod.Name = pod.GenerateName + "test"
+		created = append(created, pod.DeepCopy())
+		return false, nil, nil
+	})
+	clientset.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := created[len(created)-1].DeepCopy()
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{status}
+		return true, pod, nil
+	})
+	return clientset, &created
+}
+
+func TestVerifyPullSecretWithProbe(t *testing.T) {
+	clientset, created := newProbeClientset(corev1.ContainerStatus{Name: "probe", ImageID: "sha256:1234"})
+	i := &InstallAppStudio{clientset: clientset, PullSecretProbeImage: "mirror.internal:5000/tools/busybox:1.36"}
+
+	assert.NoError(t, i.VerifyPullSecretWithProbe(context.Background(), "e2e-apps", "quay-pull", time.Second))
+	assert.Len(t, *created, 1)
+	spec := (*created)[0].Spec
+	assert.Equal(t, "mirror.internal:5000/tools/busybox:1.36", spec.Containers[0].Image)
+	assert.Equal(t, []corev1.LocalObjectReference{{Name: "quay-pull"}}, spec.ImagePullSecrets)
+
+	// The probe pod is deleted
+	deletes := 0
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "delete" {
+			deletes++
+		}
+	}
+	assert.Equal(t, 1, deletes)
+}
+
+func TestVerifyPullSecretWithProbeDefaultImage(t *testing.T) {
+	clientset, created := newProbeClientset(corev1.ContainerStatus{Name: "probe", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}})
+
+	assert.NoError(t, (&InstallAppStudio{clientset: clientset}).VerifyPullSecretWithProbe(context.Background(), "e2e-apps", "quay-pull", time.Second))
+	assert.Equal(t, defaultPullSecretProbeImage, (*created)[0].Spec.Containers[0].Image)
+}
+
+func TestVerifyPullSecretWithProbePullFailure(t *testing.T) {
+	clientset, _ := newProbeClientset(corev1.ContainerStatus{Name: "probe", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ErrImagePull", Message: "unauthorized"}}})
+
+	err := (&InstallAppStudio{clientset: clientset}).VerifyPullSecretWithProbe(context.Background(), "e2e-apps", "quay-pull", time.Second)
+	assert.ErrorContains(t, err, "failed to pull image "+defaultPullSecretProbeImage+" with secret quay-pull: ErrImagePull: unauthorized")
+}
+
+func TestPullSecretProbeImageValidation(t *testing.T) {
+	for _, image := range []string{"busybox", "quay.io/org/image:tag", "localhost:5000/a/b", "quay.io/org/image@sha256:" + strings.Repeat("a", 64)} {
+		_, err := (&InstallAppStudio{PullSecretProbeImage: image}).pullSecretProbeImage()
+		assert.NoError(t, err, image)
+	}
+	for _, image := range []string{"Quay.io/Org/Image", "quay.io/org/image:", "quay.io//image", "image with spaces"} {
+		_, err := (&InstallAppStudio{PullSecretProbeImage: image}).pullSecretProbeImage()
+		assert.ErrorContains(t, err, "invalid pull secret probe image", image)
+	}
+
+	clientset := fake.NewSimpleClientset()
+	err := (&InstallAppStudio{clientset: clientset, PullSecretProbeImage: "not valid"}).VerifyPullSecretWithProbe(context.Background(), "e2e-apps", "quay-pull", time.Second)
+	assert.ErrorContains(t, err, "invalid pull secret probe image")
+	assert.Empty(t, clientset.Actions())
+}
@@ -0,0 +1,86 @@
+package installation
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Profile presets a group of fields of the installation, e.g. for CI or perf runs. Fields backed by an env
+// should be set with presetUnlessEnv, so that the env set by the user wins over the profile
+type Profile func(i *InstallAppStudio)
+
+// Names of the built-in profiles
+const (
+	ProfileCI    = "ci"
+	ProfileLocal = "local"
+	ProfilePerf  = "perf"
+)
+
+var (
+	profilesMu sync.RWMutex
+	profiles   = map[string]Profile{
+		// Shallow and isolated clones, more retries of flaky network operations and machine-readable logs
+		ProfileCI: func(i *InstallAppStudio) {
+			i.CloneDepth = 1
+			i.CloneRetries = 5
+			i.RetryBootstrapOnFailure = 1
+			presetUnlessEnv("ISOLATE_CLONE_DIR", func() { i.IsolateCloneDir = true })
+			presetUnlessEnv("INSTALLER_LOG_FORMAT", func() { i.LogFormat = LogFormatJSON })
+		},
+		// Full history for development of infra-deployments and failing fast
+		ProfileLocal: func(i *InstallAppStudio) {
+			i.CloneDepth = 0
+			i.CloneRetries = 1
+			i.RetryBootstrapOnFailure = 0
+			presetUnlessEnv("INSTALLER_LOG_FORMAT", func() { i.LogFormat = LogFormatText })
+		},
+		// Longer timeouts and more retries for big clusters under load
+		ProfilePerf: func(i *InstallAppStudio) {
+			i.CloneDepth = 1
+			i.RetryBootstrapOnFailure = 2
+			i.HTTPTimeout = time.Minute
+			i.VerifyConcurrency = 8
+			i.CRDWaitConcurrency = 8
+			presetUnlessEnv("PHASE_TIMEOUTS", func() {
+				i.PhaseTimeouts = map[string]time.Duration{PhaseBootstrap: 90 * time.Minute, PhaseClone: 30 * time.Minute}
+			})
+		},
+	}
+)
+
+// RegisterProfile adds a profile which can be applied by ApplyProfile, replacing a profile of the same name
+func RegisterProfile(name string, profile Profile) {
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	profiles[name] = profile
+}
+
+// ApplyProfile presets the fields of the named profile. It's applied by NewAppStudioInstallController for the
+// INSTALLER_PROFILE env; fields set explicitly after it and the envs backing the fields win over the profile.
+func (i *InstallAppStudio) ApplyProfile(name string) error {
+	profilesMu.RLock()
+	profile, ok := profiles[name]
+	names := make([]string, 0, len(profiles))
+	for known := range profiles {
+		names = append(names, known)
+	}
+	profilesMu.RUnlock()
+	if !ok {
+		sort.Strings(names)
+		return fmt.Errorf("unknown installation profile %q, known profiles: %s", name, strings.Join(names, ", "))
+	}
+
+	profile(i)
+	return nil
+}
+
+// presetUnlessEnv applies the preset of a profile unless the env backing the field is set
+func presetUnlessEnv(env string, preset func()) {
+	if _, ok := os.LookupEnv(env); !ok {
+		preset()
+	}
+}
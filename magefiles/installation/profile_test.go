@@ -0,0 +1,71 @@
+package installation
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// unsetEnv unsets the env for the test, so the profiles preset the field backed by it
+func unsetEnv(t *testing.T, env string) {
+	t.Setenv(env, "")
+	assert.NoError(t, os.Unsetenv(env))
+}
+
+func TestApplyBuiltinProfiles(t *testing.T) {
+	unsetEnv(t, "ISOLATE_CLONE_DIR")
+	unsetEnv(t, "INSTALLER_LOG_FORMAT")
+	unsetEnv(t, "PHASE_TIMEOUTS")
+
+	ci := &InstallAppStudio{}
+	assert.NoError(t, ci.ApplyProfile(ProfileCI))
+	assert.Equal(t, &InstallAppStudio{CloneDepth: 1, CloneRetries: 5, RetryBootstrapOnFailure: 1, IsolateCloneDir: true, LogFormat: LogFormatJSON}, ci)
+
+	local := &InstallAppStudio{CloneDepth: 1}
+	assert.NoError(t, local.ApplyProfile(ProfileLocal))
+	assert.Equal(t, &InstallAppStudio{CloneRetries: 1, LogFormat: LogFormatText}, local)
+
+	perf := &InstallAppStudio{}
+	assert.NoError(t, perf.ApplyProfile(ProfilePerf))
+	assert.Equal(t, &InstallAppStudio{
+		CloneDepth:              1,
+		RetryBootstrapOnFailure: 2,
+		HTTPTimeout:             time.Minute,
+		VerifyConcurrency:       8,
+		CRDWaitConcurrency:      8,
+		PhaseTimeouts:           map[string]time.Duration{PhaseBootstrap: 90 * time.Minute, PhaseClone: 30 * time.Minute},
+	}, perf)
+}
+
+func TestApplyProfileOverrides(t *testing.T) {
+	t.Setenv("INSTALLER_LOG_FORMAT", LogFormatText)
+	unsetEnv(t, "ISOLATE_CLONE_DIR")
+
+	i := &InstallAppStudio{LogFormat: LogFormatText}
+	assert.NoError(t, i.ApplyProfile(ProfileCI))
+	assert.Equal(t, LogFormatText, i.LogFormat, "the env wins over the profile")
+	assert.True(t, i.IsolateCloneDir)
+	assert.Equal(t, 1, i.CloneDepth)
+
+	t.Setenv("PHASE_TIMEOUTS", "bootstrap=2h")
+	i = &InstallAppStudio{PhaseTimeouts: map[string]time.Duration{PhaseBootstrap: 2 * time.Hour}}
+	assert.NoError(t, i.ApplyProfile(ProfilePerf))
+	assert.Equal(t, map[string]time.Duration{PhaseBootstrap: 2 * time.Hour}, i.PhaseTimeouts, "the env wins over the profile")
+}
+
+func TestRegisterProfile(t *testing.T) {
+	RegisterProfile("nightly", func(i *InstallAppStudio) { i.InfraDeploymentsBranch = "nightly" })
+	t.Cleanup(func() {
+		profilesMu.Lock()
+		defer profilesMu.Unlock()
+		delete(profiles, "nightly")
+	})
+
+	i := &InstallAppStudio{}
+	assert.NoError(t, i.ApplyProfile("nightly"))
+	assert.Equal(t, "nightly", i.InfraDeploymentsBranch)
+
+	assert.EqualError(t, i.ApplyProfile("unknown"), `unknown installation profile "unknown", known profiles: ci, local, nightly, perf`)
+}
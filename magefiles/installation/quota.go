@@ -0,0 +1,168 @@
+package installation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/klog/v2"
+)
+
+// Names of the ResourceQuota and LimitRange created from E2ENamespaceResourceQuota and E2ENamespaceLimitRange
+const (
+	e2eNamespaceResourceQuota = "e2e-resource-quota"
+	e2eNamespaceLimitRange    = "e2e-limit-range"
+)
+
+// applyE2ENamespaceQuota creates or updates the ResourceQuota and LimitRange of E2EApplicationsNamespace
+// configured by the fields and the manifest
+func (i *InstallAppStudio) applyE2ENamespaceQuota(ctx context.Context) error {
+	if i.E2ENamespaceResourceQuota == nil && i.E2ENamespaceLimitRange == nil && i.E2ENamespaceQuotaManifest == "" {
+		return nil
+	}
+	if i.E2EApplicationsNamespace == "" {
+		return fmt.Errorf("E2EApplicationsNamespace is required for applying the resource quota")
+	}
+	if err := i.checkKubeClient(); err != nil {
+		return err
+	}
+
+	var quotas []corev1.ResourceQuota
+	var limitRanges []corev1.LimitRange
+	if i.E2ENamespaceResourceQuota != nil {
+		quotas = append(quotas, corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: e2eNamespaceResourceQuota}, Spec: *i.E2ENamespaceResourceQuota})
+	}
+	if i.E2ENamespaceLimitRange != nil {
+		limitRanges = append(limitRanges, corev1.LimitRange{ObjectMeta: metav1.ObjectMeta{Name: e2eNamespaceLimitRange}, Spec: *i.E2ENamespaceLimitRange})
+	}
+	if i.E2ENamespaceQuotaManifest != "" {
+		manifestQuotas, manifestLimitRanges, err := readQuotaManifest(i.E2ENamespaceQuotaManifest)
+		if err != nil {
+			return err
+		}
+		quotas, limitRanges = append(quotas, manifestQuotas...), append(limitRanges, manifestLimitRanges...)
+	}
+
+	namespace := i.e2eApplicationsNamespace()
+	if err := i.ensureNamespace(ctx, namespace, nil, nil); err != nil {
+		return err
+	}
+	i.touchNamespace(namespace)
+	for index := range quotas {
+		if err := i.reconcileResourceQuota(ctx, namespace, &quotas[index]); err != nil {
+			return err
+		}
+	}
+	for index := range limitRanges {
+		if err := i.reconcileLimitRange(ctx, namespace, &limitRanges[index]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reconcileResourceQuota creates the ResourceQuota in the namespace or updates the spec of the existing one
+func (i *InstallAppStudio) reconcileResourceQuota(ctx context.Context, namespace string, quota *corev1.ResourceQuota) error {
+	client := i.kubeClient().CoreV1().ResourceQuotas(namespace)
+	current, err := client.Get(ctx, quota.Name, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		quota.Namespace = namespace
+		if _, err := client.Create(ctx, quota, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create resource quota %s/%s: %+v", namespace, quota.Name, err)
+		}
+		klog.Infof("created resource quota %s/%s", namespace, quota.Name)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get resource quota %s/%s: %+v", namespace, quota.Name, err)
+	}
+
+	if equality.Semantic.DeepEqual(current.Spec, quota.Spec) {
+		return nil
+	}
+	current.Spec = quota.Spec
+	if _, err := client.Update(ctx, current, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update resource quota %s/%s: %+v", namespace, quota.Name, err)
+	}
+	klog.Infof("updated resource quota %s/%s", namespace, quota.Name)
+	return nil
+}
+
+// reconcileLimitRange creates the LimitRange in the namespace or updates the spec of the existing one
+func (i *InstallAppStudio) reconcileLimitRange(ctx context.Context, namespace string, limitRange *corev1.LimitRange) error {
+	client := i.kubeClient().CoreV1().LimitRanges(namespace)
+	current, err := client.Get(ctx, limitRange.Name, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		limitRange.Namespace = namespace
+		if _, err := client.Create(ctx, limitRange, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create limit range %s/%s: %+v", namespace, limitRange.Name, err)
+		}
+		klog.Infof("created limit range %s/%s", namespace, limitRange.Name)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get limit range %s/%s: %+v", namespace, limitRange.Name, err)
+	}
+
+	if equality.Semantic.DeepEqual(current.Spec, limitRange.Spec) {
+		return nil
+	}
+	current.Spec = limitRange.Spec
+	if _, err := client.Update(ctx, current, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update limit range %s/%s: %+v", namespace, limitRange.Name, err)
+	}
+	klog.Infof("updated limit range %s/%s", namespace, limitRange.Name)
+	return nil
+}
+
+// readQuotaManifest reads the ResourceQuota and LimitRange objects of a (possibly multi-document) manifest file.
+// Their namespaces are ignored, they are applied to E2EApplicationsNamespace
+func readQuotaManifest(file string) ([]corev1.ResourceQuota, []corev1.LimitRange, error) {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open quota manifest %s: %+v", file, err)
+	}
+	defer f.Close()
+
+	var quotas []corev1.ResourceQuota
+	var limitRanges []corev1.LimitRange
+	decoder := yaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return quotas, limitRanges, nil
+			}
+			return nil, nil, fmt.Errorf("failed to read quota manifest %s: %+v", file, err)
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+
+		switch obj.GetKind() {
+		case "ResourceQuota":
+			quota := corev1.ResourceQuota{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &quota); err != nil {
+				return nil, nil, fmt.Errorf("invalid resource quota %s in %s: %+v", obj.GetName(), file, err)
+			}
+			quotas = append(quotas, quota)
+		case "LimitRange":
+			limitRange := corev1.LimitRange{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &limitRange); err != nil {
+				return nil, nil, fmt.Errorf("invalid limit range %s in %s: %+v", obj.GetName(), file, err)
+			}
+			limitRanges = append(limitRanges, limitRange)
+		default:
+			return nil, nil, fmt.Errorf("quota manifest %s contains %s %s, only ResourceQuota and LimitRange objects are supported", file, obj.GetKind(), obj.GetName())
+		}
+	}
+}
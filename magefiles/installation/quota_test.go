@@ -0,0 +1,90 @@
+package installation
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testQuotaManifest = `apiVersion: v1
+kind: ResourceQuota
+metadata:
+  name: pods
+  namespace: ignored
+spec:
+  hard:
+    pods: "20"
+---
+apiVersion: v1
+kind: LimitRange
+metadata:
+  name: containers
+spec:
+  limits:
+  - type: Container
+    default:
+      memory: 256Mi
+`
+
+func TestApplyE2ENamespaceQuota(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	i := &InstallAppStudio{
+		clientset:                 clientset,
+		E2EApplicationsNamespace:  "e2e-apps",
+		E2ENamespaceResourceQuota: &corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{corev1.ResourceLimitsCPU: resource.MustParse("8")}},
+		E2ENamespaceLimitRange: &corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+			Type:    corev1.LimitTypeContainer,
+			Default: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+		}}},
+	}
+
+	assert.NoError(t, i.applyE2ENamespaceQuota(context.Background()))
+	_, err := clientset.CoreV1().Namespaces().Get(context.Background(), "e2e-apps", metav1.GetOptions{})
+	assert.NoError(t, err)
+	quota, err := clientset.CoreV1().ResourceQuotas("e2e-apps").Get(context.Background(), e2eNamespaceResourceQuota, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "8", quota.Spec.Hard.Name(corev1.ResourceLimitsCPU, resource.DecimalSI).String())
+	limitRange, err := clientset.CoreV1().LimitRanges("e2e-apps").Get(context.Background(), e2eNamespaceLimitRange, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, *i.E2ENamespaceLimitRange, limitRange.Spec)
+
+	// The existing quota is reconciled to the configured spec
+	i.E2ENamespaceResourceQuota = &corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{corev1.ResourceLimitsCPU: resource.MustParse("4")}}
+	assert.NoError(t, i.applyE2ENamespaceQuota(context.Background()))
+	quota, err = clientset.CoreV1().ResourceQuotas("e2e-apps").Get(context.Background(), e2eNamespaceResourceQuota, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "4", quota.Spec.Hard.Name(corev1.ResourceLimitsCPU, resource.DecimalSI).String())
+}
+
+func TestApplyE2ENamespaceQuotaManifest(t *testing.T) {
+	manifest := filepath.Join(t.TempDir(), "quota.yaml")
+	assert.NoError(t, os.WriteFile(manifest, []byte(testQuotaManifest), 0600))
+	clientset := fake.NewSimpleClientset()
+	i := &InstallAppStudio{clientset: clientset, E2EApplicationsNamespace: "e2e-apps", E2ENamespaceQuotaManifest: manifest}
+
+	assert.NoError(t, i.applyE2ENamespaceQuota(context.Background()))
+	quota, err := clientset.CoreV1().ResourceQuotas("e2e-apps").Get(context.Background(), "pods", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "20", quota.Spec.Hard.Pods().String())
+	limitRange, err := clientset.CoreV1().LimitRanges("e2e-apps").Get(context.Background(), "containers", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "256Mi", limitRange.Spec.Limits[0].Default.Memory().String())
+	_, err = clientset.CoreV1().ResourceQuotas("ignored").Get(context.Background(), "pods", metav1.GetOptions{})
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(manifest, []byte(testConfigMapManifest), 0600))
+	assert.ErrorContains(t, i.applyE2ENamespaceQuota(context.Background()), "contains ConfigMap extra, only ResourceQuota and LimitRange objects are supported")
+}
+
+func TestApplyE2ENamespaceQuotaNotConfigured(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	assert.NoError(t, (&InstallAppStudio{clientset: clientset, E2EApplicationsNamespace: "e2e-apps"}).applyE2ENamespaceQuota(context.Background()))
+	assert.Empty(t, clientset.Actions())
+}
@@ -0,0 +1,203 @@
+package installation
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/konflux-ci/e2e-tests/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// Annotation of the installed ref ConfigMap holding the infra-deployments commit installed on the cluster
+	installedCommitAnnotation = "e2e-tests.konflux-ci.dev/installed-commit"
+	// ConfigMap recording what was installed on the cluster. It's kept in the namespace of the e2e quay secret, so
+	// deleting that namespace (e.g. by Uninstall) also removes the record of the installation
+	defaultInstalledRefNamespace = constants.QuayRepositorySecretNamespace
+	defaultInstalledRefConfigMap = "infra-deployments-installed-ref"
+)
+
+// InstallResult describes the outcome of the last installation
+type InstallResult struct {
+	// Commit of infra-deployments which was installed
+	CommitSHA string
+	// Commit of upstream main the clone was rebased on. Empty when InfraDeploymentsCommit is pinned
+	UpstreamCommitSHA string
+	// Phases executed by the installation, in order. The last one failed if the installation failed
+	Phases []PhaseTiming
+	// Envs exported for the bootstrap script, the values of the envs with credentials are redacted
+	Environment map[string]string
+	// Suffix of the names of the resources created by the installation, see InstallAppStudio.InstanceSuffix
+	InstanceSuffix string
+	// Namespaces the installation created or wrote into, sorted
+	TouchedNamespaces []string
+}
+
+// Result returns the outcome of the last installation
+func (i *InstallAppStudio) Result() InstallResult {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	result := i.result
+	result.Phases = append([]PhaseTiming(nil), i.result.Phases...)
+	result.Environment = maps.Clone(i.result.Environment)
+	result.TouchedNamespaces = slices.Clone(i.result.TouchedNamespaces)
+	return result
+}
+
+// TouchedNamespaces returns the namespaces the installation created or wrote into, sorted
+func (i *InstallAppStudio) TouchedNamespaces() []string {
+	return i.Result().TouchedNamespaces
+}
+
+// touchNamespace records that the installation created or wrote into the namespace
+func (i *InstallAppStudio) touchNamespace(namespace string) {
+	if namespace == "" {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if index, found := slices.BinarySearch(i.result.TouchedNamespaces, namespace); !found {
+		i.result.TouchedNamespaces = slices.Insert(i.result.TouchedNamespaces, index, namespace)
+	}
+}
+
+// InstalledCommitSHA returns the commit checked out in the infra-deployments clone
+func (i *InstallAppStudio) InstalledCommitSHA() (string, error) {
+	repo, err := git.PlainOpen(i.InfraDeploymentsCloneDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to open infra-deployments clone %s: %+v", i.InfraDeploymentsCloneDir, err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD of %s: %+v", i.InfraDeploymentsCloneDir, err)
+	}
+	return head.Hash().String(), nil
+}
+
+// upstreamCommitSHA returns the commit of upstream main fetched into the infra-deployments clone
+func (i *InstallAppStudio) upstreamCommitSHA() (string, error) {
+	repo, err := git.PlainOpen(i.InfraDeploymentsCloneDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to open infra-deployments clone %s: %+v", i.InfraDeploymentsCloneDir, err)
+	}
+	ref, err := repo.Reference(plumbing.NewRemoteReferenceName("upstream", "main"), true)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve upstream/main in %s: %+v", i.InfraDeploymentsCloneDir, err)
+	}
+	return ref.Hash().String(), nil
+}
+
+// SnapshotDeploymentGenerations returns the observed generation of the deployments, keyed by "namespace/name".
+// Comparing snapshots taken before and after an installation shows which deployments were changed by it.
+// Deployments which don't exist are left out of the snapshot.
+func (i *InstallAppStudio) SnapshotDeploymentGenerations(ctx context.Context, targets []types.NamespacedName) (map[string]int64, error) {
+	if err := i.checkKubeClient(); err != nil {
+		return nil, err
+	}
+	generations := make(map[string]int64, len(targets))
+	for _, target := range targets {
+		deployment, err := i.kubeClient().AppsV1().Deployments(target.Namespace).Get(ctx, target.Name, metav1.GetOptions{})
+		if err != nil {
+			if k8sErrors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get deployment %s: %+v", target, err)
+		}
+		generations[target.String()] = deployment.Status.ObservedGeneration
+	}
+
+	return generations, nil
+}
+
+// CheckInstalledRefDrift compares the infra-deployments commit recorded on the cluster by the installer with the desired one.
+// It returns whether they differ and the installed commit. An error is returned when no installed commit is recorded.
+func (i *InstallAppStudio) CheckInstalledRefDrift(ctx context.Context, desiredSHA string) (bool, string, error) {
+	if err := i.checkKubeClient(); err != nil {
+		return false, "", err
+	}
+	namespace, name := i.installedRefConfigMap()
+	cm, err := i.kubeClient().CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return false, "", fmt.Errorf("failed to get installed ref configmap %s/%s: %+v", namespace, name, err)
+	}
+	installedSHA := cm.Annotations[installedCommitAnnotation]
+	if installedSHA == "" {
+		return false, "", fmt.Errorf("configmap %s/%s has no %s annotation", namespace, name, installedCommitAnnotation)
+	}
+
+	return !strings.EqualFold(installedSHA, strings.TrimSpace(desiredSHA)), installedSHA, nil
+}
+
+// installedRefConfigMap returns the namespace and name of the ConfigMap recording the installed commit
+func (i *InstallAppStudio) installedRefConfigMap() (string, string) {
+	namespace, name := i.InstalledRefNamespace, i.InstalledRefConfigMap
+	if namespace == "" {
+		namespace = defaultInstalledRefNamespace
+	}
+	if name == "" {
+		name = defaultInstalledRefConfigMap
+	}
+	return namespace, i.withInstanceSuffix(name)
+}
+
+// recordInstalledRef annotates the installed ref ConfigMap with the infra-deployments commit of the installation,
+// creating the ConfigMap if it doesn't exist
+func (i *InstallAppStudio) recordInstalledRef(ctx context.Context) error {
+	if err := i.checkKubeClient(); err != nil {
+		return err
+	}
+	i.mu.Lock()
+	commitSHA := i.result.CommitSHA
+	i.mu.Unlock()
+	if commitSHA == "" && i.InfraDeploymentsTarball != "" {
+		klog.Warningf("not recording the installed ref, the commit of infra-deployments tarball %s is not known", i.InfraDeploymentsTarball)
+		return nil
+	}
+	if commitSHA == "" {
+		return fmt.Errorf("installed commit of infra-deployments is not known")
+	}
+
+	namespace, name := i.installedRefConfigMap()
+	if err := i.ensureNamespace(ctx, namespace, nil, nil); err != nil {
+		return err
+	}
+	i.touchNamespace(namespace)
+	cm, err := i.kubeClient().CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		_, err = i.kubeClient().CoreV1().ConfigMaps(namespace).Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   namespace,
+				Annotations: map[string]string{installedCommitAnnotation: commitSHA},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create configmap %s/%s: %+v", namespace, name, err)
+		}
+		klog.Infof("recorded installed commit %s in configmap %s/%s", commitSHA, namespace, name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get configmap %s/%s: %+v", namespace, name, err)
+	}
+
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	cm.Annotations[installedCommitAnnotation] = commitSHA
+	if _, err := i.kubeClient().CoreV1().ConfigMaps(namespace).Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update configmap %s/%s: %+v", namespace, name, err)
+	}
+	klog.Infof("recorded installed commit %s in configmap %s/%s", commitSHA, namespace, name)
+
+	return nil
+}
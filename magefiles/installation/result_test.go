@@ -0,0 +1,151 @@
+package installation
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/konflux-ci/e2e-tests/pkg/constants"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestInstalledCommitSHA(t *testing.T) {
+	sourceDir, source := newFixtureRepo(t)
+	tip := commitFile(t, source, sourceDir, "new-file", "content")
+
+	i := &InstallAppStudio{InfraDeploymentsCloneDir: filepath.Join(t.TempDir(), "infra-deployments")}
+	_, err := cloneOrResume(i.InfraDeploymentsCloneDir, &git.CloneOptions{URL: sourceDir, ReferenceName: plumbing.NewBranchReferenceName("main"), RemoteName: "upstream"})
+	assert.NoError(t, err)
+
+	sha, err := i.InstalledCommitSHA()
+	assert.NoError(t, err)
+	assert.Equal(t, tip.String(), sha)
+}
+
+func TestInstalledCommitSHAWithoutClone(t *testing.T) {
+	_, err := (&InstallAppStudio{InfraDeploymentsCloneDir: t.TempDir()}).InstalledCommitSHA()
+	assert.ErrorContains(t, err, "failed to open infra-deployments clone")
+}
+
+func TestSnapshotDeploymentGenerations(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "test"},
+			Data:       map[string]string{"KEY": "value"},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: "test", Generation: 3},
+			Status:     appsv1.DeploymentStatus{ObservedGeneration: 3},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "test", Generation: 7},
+			Status:     appsv1.DeploymentStatus{ObservedGeneration: 6},
+		},
+	)
+	i := &InstallAppStudio{clientset: clientset}
+	targets := []types.NamespacedName{{Namespace: "test", Name: "service"}, {Namespace: "test", Name: "other"}, {Namespace: "test", Name: "missing"}}
+
+	before, err := i.SnapshotDeploymentGenerations(context.Background(), targets)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"test/service": 3, "test/other": 6}, before)
+
+	// Applying the same configuration again doesn't touch the deployments
+	assert.NoError(t, i.PatchConfigMapAndRestart(context.Background(), "test", "config", "service", map[string]string{"KEY": "value"}))
+	after, err := i.SnapshotDeploymentGenerations(context.Background(), targets)
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+}
+
+func installedRefConfigMap(sha string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name:        defaultInstalledRefConfigMap,
+		Namespace:   defaultInstalledRefNamespace,
+		Annotations: map[string]string{installedCommitAnnotation: sha},
+	}}
+}
+
+func TestCheckInstalledRefDrift(t *testing.T) {
+	installed := "3f786850e387550fdab836ed7e6dc881de23001b"
+	i := &InstallAppStudio{clientset: fake.NewSimpleClientset(installedRefConfigMap(installed))}
+
+	drift, current, err := i.CheckInstalledRefDrift(context.Background(), "3F786850E387550FDAB836ED7E6DC881DE23001B")
+	assert.NoError(t, err)
+	assert.False(t, drift)
+	assert.Equal(t, installed, current)
+
+	drift, current, err = i.CheckInstalledRefDrift(context.Background(), "89e6c98d92887913cadf06b2adb97f26cde4849b")
+	assert.NoError(t, err)
+	assert.True(t, drift)
+	assert.Equal(t, installed, current)
+}
+
+func TestCheckInstalledRefDriftWithoutRecord(t *testing.T) {
+	_, _, err := (&InstallAppStudio{clientset: fake.NewSimpleClientset()}).CheckInstalledRefDrift(context.Background(), "89e6c98d92887913cadf06b2adb97f26cde4849b")
+	assert.ErrorContains(t, err, "failed to get installed ref configmap e2e-secrets/infra-deployments-installed-ref")
+
+	_, _, err = (&InstallAppStudio{clientset: fake.NewSimpleClientset(installedRefConfigMap(""))}).CheckInstalledRefDrift(context.Background(), "89e6c98d92887913cadf06b2adb97f26cde4849b")
+	assert.ErrorContains(t, err, "has no e2e-tests.konflux-ci.dev/installed-commit annotation")
+}
+
+func TestRecordInstalledRef(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	i := &InstallAppStudio{clientset: clientset, InstalledRefNamespace: "audit", InstalledRefConfigMap: "installed"}
+	i.result.CommitSHA = "3f786850e387550fdab836ed7e6dc881de23001b"
+
+	assert.NoError(t, i.recordInstalledRef(context.Background()))
+	cm, err := clientset.CoreV1().ConfigMaps("audit").Get(context.Background(), "installed", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "3f786850e387550fdab836ed7e6dc881de23001b", cm.Annotations[installedCommitAnnotation])
+
+	// A later installation updates the record and keeps other annotations
+	cm.Annotations["owner"] = "ci"
+	_, err = clientset.CoreV1().ConfigMaps("audit").Update(context.Background(), cm, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	i.result.CommitSHA = "89e6c98d92887913cadf06b2adb97f26cde4849b"
+	assert.NoError(t, i.recordInstalledRef(context.Background()))
+	cm, err = clientset.CoreV1().ConfigMaps("audit").Get(context.Background(), "installed", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{installedCommitAnnotation: "89e6c98d92887913cadf06b2adb97f26cde4849b", "owner": "ci"}, cm.Annotations)
+
+	drift, current, err := i.CheckInstalledRefDrift(context.Background(), "89e6c98d92887913cadf06b2adb97f26cde4849b")
+	assert.NoError(t, err)
+	assert.False(t, drift)
+	assert.Equal(t, "89e6c98d92887913cadf06b2adb97f26cde4849b", current)
+}
+
+func TestRecordInstalledRefWithoutCommit(t *testing.T) {
+	i := &InstallAppStudio{clientset: fake.NewSimpleClientset()}
+	assert.ErrorContains(t, i.recordInstalledRef(context.Background()), "installed commit of infra-deployments is not known")
+}
+
+func TestTouchedNamespaces(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	i := &InstallAppStudio{
+		clientset:                 clientset,
+		SecretSource:              fakeSecretSource{dockerConfig: []byte(testDockerConfig)},
+		E2EApplicationsNamespace:  "e2e-apps",
+		E2ENamespaceResourceQuota: &corev1.ResourceQuotaSpec{},
+		InstalledRefNamespace:     "audit",
+		InstanceSuffix:            "abc",
+	}
+
+	assert.NoError(t, i.runPhases(context.Background(), []installPhase{
+		{name: PhaseQuaySecret, weight: 10, run: i.ensureE2EQuaySecret},
+		{name: PhaseNamespaceQuota, weight: 1, run: i.applyE2ENamespaceQuota},
+	}))
+	assert.Equal(t, []string{"e2e-apps-abc", constants.QuayRepositorySecretNamespace}, i.TouchedNamespaces())
+	assert.Equal(t, "abc", i.Result().InstanceSuffix)
+
+	i.mu.Lock()
+	i.result.CommitSHA = "3f786850e387550fdab836ed7e6dc881de23001b"
+	i.mu.Unlock()
+	assert.NoError(t, i.recordInstalledRef(context.Background()))
+	assert.Equal(t, []string{"audit", "e2e-apps-abc", constants.QuayRepositorySecretNamespace}, i.Result().TouchedNamespaces)
+}
@@ -0,0 +1,250 @@
+package installation
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Time given to the process group of a cancelled command to exit after SIGTERM, before it gets SIGKILL
+const defaultCommandGracePeriod = 10 * time.Second
+
+// Number of output lines of a failed command included in the returned error
+const outputTailLines = 50
+
+// Envs of the installer passed to commands run with CleanEnv. KUBECONFIG is kept, so the command targets the same cluster
+var cleanEnvPassthrough = []string{"PATH", "HOME", "KUBECONFIG"}
+
+// Command describes a command executed by a CommandRunner
+type Command struct {
+	// Name or path of the executable
+	Name string
+	Args []string
+	// Working directory of the command
+	Dir string
+	// Optional file the command output (stdout and stderr) is appended to, in addition to the installer's stdout and stderr
+	LogFile string
+	// Additional environment variables of the command, on top of the installer's environment
+	Env map[string]string
+	// If true, the command doesn't inherit the installer's environment: it gets only Env and the cleanEnvPassthrough envs
+	CleanEnv bool
+	// Optional channel receiving the output of the command line by line, closed when the command completes.
+	// The command is never blocked by a slow receiver: lines which don't fit into the channel buffer are dropped
+	Lines chan<- string
+}
+
+// CommandRunner executes external commands like the bootstrap script
+type CommandRunner interface {
+	Run(ctx context.Context, command Command) error
+}
+
+// ExecCommandRunner runs the command as a local process in its own process group.
+// When the context is cancelled, the whole group (including child processes like helm or oc)
+// gets SIGTERM and, after GracePeriod, SIGKILL.
+type ExecCommandRunner struct {
+	GracePeriod time.Duration
+}
+
+func (r ExecCommandRunner) Run(ctx context.Context, command Command) error {
+	gracePeriod := r.GracePeriod
+	if gracePeriod == 0 {
+		gracePeriod = defaultCommandGracePeriod
+	}
+
+	var stdoutLines, stderrLines *lineWriter
+	if command.Lines != nil {
+		lines := &lineChannel{out: command.Lines}
+		stdoutLines, stderrLines = lines.writer(), lines.writer()
+		defer lines.close(stdoutLines, stderrLines)
+	}
+
+	tail := newTailBuffer(outputTailLines)
+	captured := []io.Writer{tail}
+	if command.LogFile != "" {
+		logFile, err := os.OpenFile(filepath.Clean(command.LogFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open log file %s: %+v", command.LogFile, err)
+		}
+		defer logFile.Close()
+		captured = append(captured, logFile)
+	}
+
+	stdout, stderr := append([]io.Writer{os.Stdout}, captured...), append([]io.Writer{os.Stderr}, captured...)
+	if stdoutLines != nil {
+		stdout, stderr = append(stdout, stdoutLines), append(stderr, stderrLines)
+	}
+
+	cmd := exec.Command(command.Name, command.Args...) // #nosec G204
+	cmd.Dir = command.Dir
+	if command.CleanEnv {
+		cmd.Env = []string{}
+		for _, name := range cleanEnvPassthrough {
+			if value, ok := os.LookupEnv(name); ok {
+				cmd.Env = append(cmd.Env, name+"="+value)
+			}
+		}
+	} else if len(command.Env) > 0 {
+		cmd.Env = os.Environ()
+	}
+	if cmd.Env != nil {
+		for name, value := range command.Env {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
+	// The bootstrap script may prompt for an option, keep the answer given by utils.ExecuteCommandInASpecificDirectory
+	cmd.Stdin = strings.NewReader("4\n")
+	cmd.Stdout = io.MultiWriter(stdout...)
+	cmd.Stderr = io.MultiWriter(stderr...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	// Don't wait forever for the output of orphaned child processes
+	cmd.WaitDelay = gracePeriod
+
+	if err := cmd.Start(); err != nil {
+		klog.Errorf("an error occurred: %s", err)
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("'%s' failed: %w; last lines of its output:\n%s", command.Name, err, tail)
+		}
+		return nil
+	case <-ctx.Done():
+		klog.Warningf("terminating '%s': %v", command.Name, ctx.Err())
+		// A negative pid signals the whole process group
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+		select {
+		case <-done:
+		case <-time.After(gracePeriod):
+			klog.Warningf("'%s' did not exit in %v, killing it", command.Name, gracePeriod)
+			_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			<-done
+		}
+		return ctx.Err()
+	}
+}
+
+// tailBuffer is a writer keeping only the last lines written into it
+type tailBuffer struct {
+	mu       sync.Mutex
+	maxLines int
+	lines    []string
+	partial  []byte
+}
+
+func newTailBuffer(maxLines int) *tailBuffer {
+	return &tailBuffer{maxLines: maxLines}
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.partial = append(t.partial, p...)
+	for {
+		end := bytes.IndexByte(t.partial, '\n')
+		if end < 0 {
+			break
+		}
+		t.lines = append(t.lines, string(t.partial[:end]))
+		t.partial = t.partial[end+1:]
+	}
+	if len(t.lines) > t.maxLines {
+		t.lines = t.lines[len(t.lines)-t.maxLines:]
+	}
+
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	lines := t.lines
+	if len(t.partial) > 0 {
+		lines = append(lines[:len(lines):len(lines)], string(t.partial))
+	}
+	if len(lines) > t.maxLines {
+		lines = lines[len(lines)-t.maxLines:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// lineChannel sends the lines written by its writers to a channel without blocking, dropping lines when it's full
+type lineChannel struct {
+	mu      sync.Mutex
+	out     chan<- string
+	dropped int
+}
+
+// lineWriter splits the output of one stream (stdout or stderr) into lines sent to the lineChannel
+type lineWriter struct {
+	lines   *lineChannel
+	partial []byte
+}
+
+func (c *lineChannel) writer() *lineWriter {
+	return &lineWriter{lines: c}
+}
+
+func (c *lineChannel) send(line string) {
+	select {
+	case c.out <- line:
+	default:
+		c.dropped++
+	}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.lines.mu.Lock()
+	defer w.lines.mu.Unlock()
+
+	w.partial = append(w.partial, p...)
+	for {
+		end := bytes.IndexByte(w.partial, '\n')
+		if end < 0 {
+			break
+		}
+		w.lines.send(string(w.partial[:end]))
+		w.partial = w.partial[end+1:]
+	}
+	return len(p), nil
+}
+
+// close sends the unterminated last lines of the writers and closes the channel
+func (c *lineChannel) close(writers ...*lineWriter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, w := range writers {
+		if len(w.partial) > 0 {
+			c.send(string(w.partial))
+			w.partial = nil
+		}
+	}
+	if c.dropped > 0 {
+		klog.Warningf("%d output lines were dropped because their receiver was too slow", c.dropped)
+	}
+	close(c.out)
+}
+
+func (i *InstallAppStudio) commandRunner() CommandRunner {
+	if i.CommandRunner != nil {
+		return i.CommandRunner
+	}
+	return ExecCommandRunner{}
+}
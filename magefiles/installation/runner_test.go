@@ -0,0 +1,131 @@
+package installation
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// processRunning returns false for processes which exited, including zombies waiting to be reaped
+func processRunning(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(stat))
+	return len(fields) > 2 && fields[2] != "Z"
+}
+
+func TestExecCommandRunnerKillsProcessTreeOnCancel(t *testing.T) {
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "pids")
+	script := fmt.Sprintf("trap '' TERM; sleep 60 & echo $! >> %[1]s; sleep 60 & echo $! >> %[1]s; wait", pidFile)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		assert.Eventually(t, func() bool {
+			pids, _ := os.ReadFile(pidFile)
+			return len(strings.Fields(string(pids))) == 2
+		}, 5*time.Second, 10*time.Millisecond)
+		cancel()
+	}()
+
+	err := ExecCommandRunner{GracePeriod: 100 * time.Millisecond}.Run(ctx, Command{Name: "sh", Args: []string{"-c", script}, Dir: dir})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	pids, err := os.ReadFile(pidFile)
+	assert.NoError(t, err)
+	for _, field := range strings.Fields(string(pids)) {
+		pid, err := strconv.Atoi(field)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool { return !processRunning(pid) }, 5*time.Second, 10*time.Millisecond, "child process %d is still running", pid)
+	}
+}
+
+func TestExecCommandRunner(t *testing.T) {
+	assert.NoError(t, ExecCommandRunner{}.Run(context.Background(), Command{Name: "true"}))
+	assert.Error(t, ExecCommandRunner{}.Run(context.Background(), Command{Name: "false"}))
+}
+
+func TestExecCommandRunnerEnv(t *testing.T) {
+	t.Setenv("INHERITED", "yes")
+	command := Command{Name: "sh", Args: []string{"-c", `[ "$EXTRA" = "value" ] && [ "$INHERITED" = "yes" ]`}, Env: map[string]string{"EXTRA": "value"}}
+	assert.NoError(t, ExecCommandRunner{}.Run(context.Background(), command))
+	_, exported := os.LookupEnv("EXTRA")
+	assert.False(t, exported)
+}
+
+func TestExecCommandRunnerCleanEnv(t *testing.T) {
+	t.Setenv("UNRELATED_PARENT_VAR", "leaked")
+	lines := make(chan string, 100)
+	command := Command{Name: "env", Env: map[string]string{"EXTRA": "value"}, CleanEnv: true, Lines: lines}
+	assert.NoError(t, ExecCommandRunner{}.Run(context.Background(), command))
+
+	var env []string
+	for line := range lines {
+		env = append(env, line)
+	}
+	assert.Contains(t, env, "EXTRA=value")
+	assert.Contains(t, env, "PATH="+os.Getenv("PATH"))
+	for _, line := range env {
+		assert.False(t, strings.HasPrefix(line, "UNRELATED_PARENT_VAR="), "parent env is inherited")
+	}
+}
+
+func TestExecCommandRunnerCapturesOutput(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "bootstrap.log")
+	script := "i=0; while [ $i -lt 60 ]; do echo line-$i; i=$((i+1)); done; echo failing; exit 3"
+
+	err := ExecCommandRunner{}.Run(context.Background(), Command{Name: "sh", Args: []string{"-c", script}, LogFile: logFile})
+	assert.ErrorContains(t, err, "exit status 3")
+	assert.ErrorContains(t, err, "line-59\nfailing")
+	assert.NotContains(t, err.Error(), "line-5\n")
+
+	assert.NoError(t, ExecCommandRunner{}.Run(context.Background(), Command{Name: "sh", Args: []string{"-c", "echo from-stderr >&2"}, LogFile: logFile}))
+
+	captured, err := os.ReadFile(logFile)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(captured), "line-0\nline-1\n"), string(captured))
+	assert.True(t, strings.HasSuffix(string(captured), "line-59\nfailing\nfrom-stderr\n"), string(captured))
+}
+
+func TestExecCommandRunnerStreamsLines(t *testing.T) {
+	lines := make(chan string, 100)
+	err := ExecCommandRunner{}.Run(context.Background(), Command{Name: "sh", Args: []string{"-c", "for n in 1 2 3 4 5; do echo line $n; done; printf last"}, Lines: lines})
+	assert.NoError(t, err)
+
+	var received []string
+	for line := range lines {
+		received = append(received, line)
+	}
+	assert.Equal(t, []string{"line 1", "line 2", "line 3", "line 4", "line 5", "last"}, received)
+}
+
+func TestExecCommandRunnerDropsLinesOfSlowReceiver(t *testing.T) {
+	// Nobody reads the unbuffered channel, the command must complete anyway
+	lines := make(chan string)
+	err := ExecCommandRunner{}.Run(context.Background(), Command{Name: "sh", Args: []string{"-c", "seq 1000"}, Lines: lines})
+	assert.NoError(t, err)
+	_, open := <-lines
+	assert.False(t, open)
+
+	lines = make(chan string, 1)
+	err = ExecCommandRunner{}.Run(context.Background(), Command{Name: "does-not-exist", Lines: lines})
+	assert.Error(t, err)
+	_, open = <-lines
+	assert.False(t, open, "channel is closed when the command fails to start")
+}
+
+func TestTailBuffer(t *testing.T) {
+	tail := newTailBuffer(2)
+	_, _ = tail.Write([]byte("one\ntwo\nthr"))
+	_, _ = tail.Write([]byte("ee\nfour"))
+	assert.Equal(t, "three\nfour", tail.String())
+}
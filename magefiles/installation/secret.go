@@ -0,0 +1,238 @@
+package installation
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// SecretSource provides the credentials used for the e2e quay pull secret.
+// It allows to plug in e.g. a Vault-backed source without changing the installation logic.
+type SecretSource interface {
+	// QuayDockerConfig returns the content of a docker/config.json file with valid login credentials for quay.io
+	QuayDockerConfig(ctx context.Context) ([]byte, error)
+}
+
+// EnvSecretSource reads the credentials from the base64-encoded QUAY_TOKEN env
+type EnvSecretSource struct{}
+
+func (EnvSecretSource) QuayDockerConfig(ctx context.Context) ([]byte, error) {
+	return decodeQuayToken(os.Getenv("QUAY_TOKEN"))
+}
+
+// quayTokenSecretSource returns the base64-encoded QUAY_TOKEN value kept in memory
+type quayTokenSecretSource string
+
+func (s quayTokenSecretSource) QuayDockerConfig(ctx context.Context) ([]byte, error) {
+	return decodeQuayToken(string(s))
+}
+
+func decodeQuayToken(quayToken string) ([]byte, error) {
+	if quayToken == "" {
+		return nil, fmt.Errorf("failed to obtain quay token from 'QUAY_TOKEN' env; make sure the env exists")
+	}
+
+	data, err := parseDockerConfigJSON(quayToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return data[corev1.DockerConfigJsonKey], nil
+}
+
+// parseDockerConfigJSON decodes the base64-encoded docker/config.json and returns it as the data of a dockerconfigjson secret
+func parseDockerConfigJSON(encoded string) (map[string][]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode quay token. Make sure that QUAY_TOKEN env contain a base64 token")
+	}
+
+	return dockerConfigSecretData(decoded)
+}
+
+// dockerConfigSecretData checks that the content is a docker/config.json with credentials
+// and returns it as the data of a dockerconfigjson secret
+func dockerConfigSecretData(dockerConfig []byte) (map[string][]byte, error) {
+	config := dockerConfigJSON{}
+	if err := json.Unmarshal(dockerConfig, &config); err != nil {
+		return nil, fmt.Errorf("quay token is not a valid docker config: %+v", err)
+	}
+	if len(config.Auths) == 0 {
+		return nil, fmt.Errorf("quay token is not a valid docker config: no auths found")
+	}
+
+	return map[string][]byte{corev1.DockerConfigJsonKey: dockerConfig}, nil
+}
+
+func (i *InstallAppStudio) secretSource() SecretSource {
+	if i.SecretSource != nil {
+		return i.SecretSource
+	}
+	if i.KeepQuayTokenOutOfEnv {
+		return quayTokenSecretSource(i.QuayToken)
+	}
+	return EnvSecretSource{}
+}
+
+// Registry the e2e quay secret is used for
+const defaultQuayRegistry = "quay.io"
+
+// Size limit of the data of a Kubernetes secret
+const maxSecretDataBytes = 1 << 20
+
+// Annotation of the e2e quay secret with the time of its last write, for external rotation tooling
+const lastRotatedAnnotation = "e2e-tests.konflux-ci.dev/last-rotated"
+
+// Returns the time recorded in the lastRotatedAnnotation. Replaced in unit tests
+var secretRotationTime = time.Now
+
+// dockerConfigJSON is the content of a docker/config.json file
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigAuth `json:"auths"`
+}
+
+type dockerConfigAuth struct {
+	Auth     string `json:"auth,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// credentials returns the username and password of the auth entry
+func (a dockerConfigAuth) credentials() (string, string, error) {
+	if a.Auth == "" {
+		return a.Username, a.Password, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode auth: %+v", err)
+	}
+	username, password, found := strings.Cut(string(decoded), ":")
+	if !found {
+		return "", "", fmt.Errorf("auth is not in the 'username:password' format")
+	}
+	return username, password, nil
+}
+
+// VerifyQuayLogin checks that the credentials of the e2e quay secret are accepted by the registry,
+// by going through the registry token authentication flow.
+func (i *InstallAppStudio) VerifyQuayLogin(ctx context.Context) error {
+	dockerConfig, err := i.secretSource().QuayDockerConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	config := dockerConfigJSON{}
+	if err := json.Unmarshal(dockerConfig, &config); err != nil {
+		return fmt.Errorf("quay token is not a valid docker config: %+v", err)
+	}
+	registryURL := i.quayRegistryURL()
+	host := strings.TrimPrefix(strings.TrimPrefix(registryURL, "https://"), "http://")
+	auth, ok := config.Auths[host]
+	if !ok {
+		return fmt.Errorf("quay token doesn't contain credentials for %s", host)
+	}
+	username, password, err := auth.credentials()
+	if err != nil {
+		return fmt.Errorf("invalid credentials for %s: %+v", host, err)
+	}
+
+	client := i.httpClient()
+	challenge, err := httpGet(ctx, client, registryURL+"/v2/", "", "")
+	if err != nil {
+		return err
+	}
+	challenge.Body.Close()
+	if challenge.StatusCode != http.StatusUnauthorized {
+		return fmt.Errorf("unexpected response of %s registry: %s", host, challenge.Status)
+	}
+
+	realm, service := parseBearerChallenge(challenge.Header.Get("WWW-Authenticate"))
+	if realm == "" {
+		return fmt.Errorf("%s registry didn't return a token authentication challenge", host)
+	}
+	tokenURL := realm
+	if service != "" {
+		tokenURL = fmt.Sprintf("%s?service=%s", realm, url.QueryEscape(service))
+	}
+	res, err := httpGet(ctx, client, tokenURL, username, password)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s registry rejected the credentials of user '%s': %s", host, username, res.Status)
+	}
+	klog.Infof("verified login of user '%s' to %s", username, host)
+
+	return nil
+}
+
+func (i *InstallAppStudio) quayRegistryURL() string {
+	if i.registryURL != "" {
+		return i.registryURL
+	}
+	return "https://" + i.registryHost()
+}
+
+// registryHost returns the host of the registry the e2e quay secret is used for, quay.io by default
+func (i *InstallAppStudio) registryHost() string {
+	if i.RegistryHost != "" {
+		return i.RegistryHost
+	}
+	return defaultQuayRegistry
+}
+
+// checkRegistryCredentials returns an error if the docker config has no credentials for RegistryHost
+func (i *InstallAppStudio) checkRegistryCredentials(dockerConfig []byte) error {
+	config := dockerConfigJSON{}
+	if err := json.Unmarshal(dockerConfig, &config); err != nil {
+		return fmt.Errorf("quay token is not a valid docker config: %+v", err)
+	}
+	if _, ok := config.Auths[i.registryHost()]; !ok {
+		return fmt.Errorf("quay token doesn't contain credentials for %s", i.registryHost())
+	}
+	return nil
+}
+
+func httpGet(ctx context.Context, client *http.Client, url, username, password string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to %s failed: %+v", url, err)
+	}
+	return res, nil
+}
+
+// parseBearerChallenge returns realm and service of a 'Bearer realm="...",service="..."' WWW-Authenticate header
+func parseBearerChallenge(header string) (realm, service string) {
+	params, found := strings.CutPrefix(header, "Bearer ")
+	if !found {
+		return "", ""
+	}
+	for _, param := range strings.Split(params, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		value = strings.Trim(value, `"`)
+		switch key {
+		case "realm":
+			realm = value
+		case "service":
+			service = value
+		}
+	}
+	return realm, service
+}
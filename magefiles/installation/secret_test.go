@@ -0,0 +1,358 @@
+package installation
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/konflux-ci/e2e-tests/pkg/constants"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testDockerConfig = `{"auths":{"quay.io":{"auth":"dXNlcjpwYXNzd29yZA=="}}}`
+
+type fakeSecretSource struct {
+	dockerConfig []byte
+}
+
+func (f fakeSecretSource) QuayDockerConfig(ctx context.Context) ([]byte, error) {
+	return f.dockerConfig, nil
+}
+
+func getQuaySecret(t *testing.T, i *InstallAppStudio) *corev1.Secret {
+	secret, err := i.kubeClient().CoreV1().Secrets(constants.QuayRepositorySecretNamespace).Get(context.Background(), constants.QuayRepositorySecretName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	return secret
+}
+
+func TestCreateE2EQuaySecretFromSecretSource(t *testing.T) {
+	i := &InstallAppStudio{
+		clientset:    fake.NewSimpleClientset(),
+		SecretSource: fakeSecretSource{dockerConfig: []byte(testDockerConfig)},
+	}
+
+	assert.NoError(t, i.createE2EQuaySecret(context.Background()))
+
+	secret := getQuaySecret(t, i)
+	assert.Equal(t, corev1.SecretTypeDockerConfigJson, secret.Type)
+	assert.Equal(t, testDockerConfig, string(secret.Data[corev1.DockerConfigJsonKey]))
+}
+
+func TestCreateE2EQuaySecretWithCustomDataKey(t *testing.T) {
+	i := &InstallAppStudio{
+		clientset:         fake.NewSimpleClientset(),
+		SecretSource:      fakeSecretSource{dockerConfig: []byte(testDockerConfig)},
+		QuaySecretDataKey: "config.json",
+	}
+
+	assert.NoError(t, i.createE2EQuaySecret(context.Background()))
+	secret := getQuaySecret(t, i)
+	assert.Equal(t, corev1.SecretTypeOpaque, secret.Type)
+	assert.Equal(t, map[string][]byte{"config.json": []byte(testDockerConfig)}, secret.Data)
+
+	// Switching back to the standard key recreates the secret with the dockerconfigjson type
+	i.QuaySecretDataKey = corev1.DockerConfigJsonKey
+	assert.NoError(t, i.createE2EQuaySecret(context.Background()))
+	secret = getQuaySecret(t, i)
+	assert.Equal(t, corev1.SecretTypeDockerConfigJson, secret.Type)
+	assert.Equal(t, map[string][]byte{corev1.DockerConfigJsonKey: []byte(testDockerConfig)}, secret.Data)
+}
+
+func TestCreateE2EQuaySecretWithDockerConfigTransform(t *testing.T) {
+	i := &InstallAppStudio{
+		clientset:    fake.NewSimpleClientset(),
+		SecretSource: fakeSecretSource{dockerConfig: []byte(testDockerConfig)},
+		DockerConfigTransform: func(data []byte) ([]byte, error) {
+			config := map[string]map[string]interface{}{}
+			if err := json.Unmarshal(data, &config); err != nil {
+				return nil, err
+			}
+			config["auths"]["registry.example.com"] = map[string]string{"auth": "b3RoZXI6cGFzc3dvcmQ="}
+			return json.Marshal(config)
+		},
+	}
+
+	assert.NoError(t, i.createE2EQuaySecret(context.Background()))
+	secret := getQuaySecret(t, i)
+	assert.JSONEq(t, `{"auths":{"quay.io":{"auth":"dXNlcjpwYXNzd29yZA=="},"registry.example.com":{"auth":"b3RoZXI6cGFzc3dvcmQ="}}}`, string(secret.Data[corev1.DockerConfigJsonKey]))
+}
+
+func TestCreateE2EQuaySecretWithInvalidDockerConfigTransform(t *testing.T) {
+	i := &InstallAppStudio{
+		clientset:             fake.NewSimpleClientset(),
+		SecretSource:          fakeSecretSource{dockerConfig: []byte(testDockerConfig)},
+		DockerConfigTransform: func(data []byte) ([]byte, error) { return []byte(`{"credsStore":"desktop"}`), nil },
+	}
+	assert.ErrorContains(t, i.createE2EQuaySecret(context.Background()), "transformed docker config of the e2e quay secret is invalid")
+
+	i.DockerConfigTransform = func(data []byte) ([]byte, error) { return nil, fmt.Errorf("no credentials helper") }
+	assert.ErrorContains(t, i.createE2EQuaySecret(context.Background()), "failed to transform docker config of the e2e quay secret: no credentials helper")
+
+	_, err := i.kubeClient().CoreV1().Secrets(constants.QuayRepositorySecretNamespace).Get(context.Background(), constants.QuayRepositorySecretName, metav1.GetOptions{})
+	assert.True(t, k8sErrors.IsNotFound(err))
+}
+
+func TestCreateE2EQuaySecretWithLabels(t *testing.T) {
+	i := &InstallAppStudio{
+		clientset:    fake.NewSimpleClientset(),
+		SecretSource: fakeSecretSource{dockerConfig: []byte(testDockerConfig)},
+		SecretLabels: map[string]string{"e2e.konflux-ci.dev/pull-secret": "true"},
+	}
+
+	assert.NoError(t, i.createE2EQuaySecret(context.Background()))
+	secret := getQuaySecret(t, i)
+	assert.Equal(t, map[string]string{"e2e.konflux-ci.dev/pull-secret": "true"}, secret.Labels)
+
+	// Labels added by others are preserved when the secret is updated
+	secret.Labels["owner"] = "ci"
+	secret.Labels["e2e.konflux-ci.dev/pull-secret"] = "false"
+	_, err := i.kubeClient().CoreV1().Secrets(secret.Namespace).Update(context.Background(), secret, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	i.SecretLabels["tier"] = "e2e"
+	assert.NoError(t, i.createE2EQuaySecret(context.Background()))
+	secret = getQuaySecret(t, i)
+	assert.Equal(t, map[string]string{"e2e.konflux-ci.dev/pull-secret": "true", "owner": "ci", "tier": "e2e"}, secret.Labels)
+}
+
+func TestCreateE2EQuaySecretWithAnnotations(t *testing.T) {
+	rotated := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	original := secretRotationTime
+	secretRotationTime = func() time.Time { return rotated }
+	t.Cleanup(func() { secretRotationTime = original })
+
+	i := &InstallAppStudio{
+		clientset:         fake.NewSimpleClientset(),
+		SecretSource:      fakeSecretSource{dockerConfig: []byte(testDockerConfig)},
+		SecretAnnotations: map[string]string{"rotation.example.com/source": "vault"},
+	}
+
+	assert.NoError(t, i.createE2EQuaySecret(context.Background()))
+	secret := getQuaySecret(t, i)
+	assert.Equal(t, map[string]string{"rotation.example.com/source": "vault", lastRotatedAnnotation: "2024-05-01T10:00:00Z"}, secret.Annotations)
+
+	// A rewrite bumps the timestamp and keeps annotations added by others
+	secret.Annotations["owner"] = "ci"
+	_, err := i.kubeClient().CoreV1().Secrets(secret.Namespace).Update(context.Background(), secret, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	rotated = rotated.Add(time.Hour)
+	assert.NoError(t, i.createE2EQuaySecret(context.Background()))
+	secret = getQuaySecret(t, i)
+	assert.Equal(t, map[string]string{"rotation.example.com/source": "vault", lastRotatedAnnotation: "2024-05-01T11:00:00Z", "owner": "ci"}, secret.Annotations)
+	assert.Empty(t, i.SecretAnnotations[lastRotatedAnnotation], "the configured annotations are not modified")
+}
+
+func TestEnvSecretSource(t *testing.T) {
+	t.Setenv("QUAY_TOKEN", "")
+	_, err := EnvSecretSource{}.QuayDockerConfig(context.Background())
+	assert.ErrorContains(t, err, "failed to obtain quay token")
+
+	t.Setenv("QUAY_TOKEN", "not base64!")
+	_, err = EnvSecretSource{}.QuayDockerConfig(context.Background())
+	assert.ErrorContains(t, err, "failed to decode quay token")
+}
+
+func TestParseDockerConfigJSON(t *testing.T) {
+	data, err := parseDockerConfigJSON(base64.StdEncoding.EncodeToString([]byte(testDockerConfig)))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{corev1.DockerConfigJsonKey: []byte(testDockerConfig)}, data)
+
+	_, err = parseDockerConfigJSON("not base64!")
+	assert.ErrorContains(t, err, "failed to decode quay token")
+
+	_, err = parseDockerConfigJSON(base64.StdEncoding.EncodeToString([]byte("token")))
+	assert.ErrorContains(t, err, "quay token is not a valid docker config")
+
+	_, err = parseDockerConfigJSON(base64.StdEncoding.EncodeToString([]byte(`{"credHelpers":{"quay.io":"secretservice"}}`)))
+	assert.ErrorContains(t, err, "no auths found")
+}
+
+func TestCreateE2EQuaySecretRejectsInvalidDockerConfig(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	i := &InstallAppStudio{clientset: clientset, SecretSource: fakeSecretSource{dockerConfig: []byte("token")}}
+
+	assert.ErrorContains(t, i.createE2EQuaySecret(context.Background()), "quay token is not a valid docker config")
+	assert.Empty(t, clientset.Actions())
+}
+
+func TestSkipQuaySecret(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	i := &InstallAppStudio{clientset: clientset, SkipQuaySecret: true}
+
+	assert.NoError(t, i.Validate())
+	assert.NoError(t, i.ensureE2EQuaySecret(context.Background()))
+	assert.Empty(t, clientset.Actions())
+}
+
+func TestValidateRequiresQuayToken(t *testing.T) {
+	assert.ErrorContains(t, (&InstallAppStudio{}).Validate(), "quay token is required")
+	assert.ErrorContains(t, (&InstallAppStudio{SecretSource: EnvSecretSource{}}).Validate(), "quay token is required")
+	assert.NoError(t, (&InstallAppStudio{QuayToken: "token"}).Validate())
+	assert.NoError(t, (&InstallAppStudio{SecretSource: fakeSecretSource{}}).Validate())
+}
+
+func TestCreateE2EQuaySecretRetriesNamespaceGet(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	gets := 0
+	clientset.PrependReactor("get", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		if gets == 1 {
+			return true, nil, k8sErrors.NewServerTimeout(corev1.Resource("namespaces"), "get", 1)
+		}
+		return false, nil, nil
+	})
+	i := &InstallAppStudio{clientset: clientset, SecretSource: fakeSecretSource{dockerConfig: []byte(testDockerConfig)}}
+
+	assert.NoError(t, i.createE2EQuaySecret(context.Background()))
+	assert.Equal(t, 2, gets)
+	getQuaySecret(t, i)
+}
+
+func TestCreateE2EQuaySecretUpdatesExistingSecret(t *testing.T) {
+	i := &InstallAppStudio{
+		clientset: fake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: constants.QuayRepositorySecretName, Namespace: constants.QuayRepositorySecretNamespace},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`)},
+		}),
+		SecretSource: fakeSecretSource{dockerConfig: []byte(testDockerConfig)},
+	}
+
+	assert.NoError(t, i.createE2EQuaySecret(context.Background()))
+	assert.Equal(t, testDockerConfig, string(getQuaySecret(t, i).Data[corev1.DockerConfigJsonKey]))
+}
+
+func TestCreateE2EQuaySecretReplacesSecretWithDifferentType(t *testing.T) {
+	i := &InstallAppStudio{
+		clientset: fake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: constants.QuayRepositorySecretName, Namespace: constants.QuayRepositorySecretNamespace},
+			Type:       corev1.SecretTypeOpaque,
+			Data:       map[string][]byte{"token": []byte("opaque")},
+		}),
+		SecretSource: fakeSecretSource{dockerConfig: []byte(testDockerConfig)},
+	}
+
+	assert.NoError(t, i.createE2EQuaySecret(context.Background()))
+
+	secret := getQuaySecret(t, i)
+	assert.Equal(t, corev1.SecretTypeDockerConfigJson, secret.Type)
+	assert.Equal(t, map[string][]byte{corev1.DockerConfigJsonKey: []byte(testDockerConfig)}, secret.Data)
+}
+
+func newFakeRegistry(t *testing.T, username, password string) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/v2/auth",service="%s"`, server.URL, r.Host))
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/v2/auth":
+			if u, p, ok := r.BasicAuth(); !ok || u != username || p != password || r.URL.Query().Get("service") != r.Host {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"token":"token"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func dockerConfigFor(host, username, password string) []byte {
+	auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	return []byte(fmt.Sprintf(`{"auths":{"%s":{"auth":"%s"}}}`, host, auth))
+}
+
+func TestVerifyQuayLogin(t *testing.T) {
+	registry := newFakeRegistry(t, "robot", "secret")
+	host := strings.TrimPrefix(registry.URL, "http://")
+
+	i := &InstallAppStudio{registryURL: registry.URL, SecretSource: fakeSecretSource{dockerConfig: dockerConfigFor(host, "robot", "secret")}}
+	assert.NoError(t, i.VerifyQuayLogin(context.Background()))
+
+	i.SecretSource = fakeSecretSource{dockerConfig: dockerConfigFor(host, "robot", "wrong")}
+	assert.ErrorContains(t, i.VerifyQuayLogin(context.Background()), "rejected the credentials of user 'robot': 401 Unauthorized")
+
+	i.SecretSource = fakeSecretSource{dockerConfig: dockerConfigFor("other.registry.io", "robot", "secret")}
+	assert.ErrorContains(t, i.VerifyQuayLogin(context.Background()), "doesn't contain credentials for "+host)
+}
+
+func TestCreateE2EQuaySecretRejectsOversizedDockerConfig(t *testing.T) {
+	auths := make([]string, 0, 20000)
+	for n := 0; n < 20000; n++ {
+		auths = append(auths, fmt.Sprintf(`"registry-%d.example.com":{"auth":"dXNlcjpwYXNzd29yZA=="}`, n))
+	}
+	dockerConfig := `{"auths":{"quay.io":{"auth":"dXNlcjpwYXNzd29yZA=="},` + strings.Join(auths, ",") + `}}`
+	clientset := fake.NewSimpleClientset()
+	i := &InstallAppStudio{clientset: clientset, SecretSource: fakeSecretSource{dockerConfig: []byte(dockerConfig)}}
+
+	err := i.createE2EQuaySecret(context.Background())
+	assert.ErrorContains(t, err, fmt.Sprintf("docker config of the e2e quay secret is %d bytes, more than the 1048576 bytes a Kubernetes secret can hold", len(dockerConfig)))
+	assert.Empty(t, clientset.Actions())
+}
+
+func TestCreateE2EQuaySecretRegistryHost(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	i := &InstallAppStudio{clientset: clientset, SecretSource: fakeSecretSource{dockerConfig: []byte(testDockerConfig)}, RegistryHost: "quay.example.com"}
+
+	assert.ErrorContains(t, i.createE2EQuaySecret(context.Background()), "quay token doesn't contain credentials for quay.example.com")
+	assert.Empty(t, clientset.Actions())
+
+	dockerConfig := dockerConfigFor("quay.example.com", "robot", "secret")
+	i.SecretSource = fakeSecretSource{dockerConfig: dockerConfig}
+	assert.NoError(t, i.createE2EQuaySecret(context.Background()))
+	assert.Equal(t, string(dockerConfig), string(getQuaySecret(t, i).Data[corev1.DockerConfigJsonKey]))
+}
+
+func TestVerifyQuayLoginRegistryHost(t *testing.T) {
+	i := &InstallAppStudio{RegistryHost: "quay.example.com", SecretSource: fakeSecretSource{dockerConfig: []byte(testDockerConfig)}}
+
+	assert.Equal(t, "https://quay.example.com", i.quayRegistryURL())
+	assert.ErrorContains(t, i.VerifyQuayLogin(context.Background()), "quay token doesn't contain credentials for quay.example.com")
+}
+
+func TestCreateE2EQuaySecretWaitsForTerminatingNamespace(t *testing.T) {
+	clientset := fake.NewSimpleClientset(terminatingNamespace(constants.QuayRepositorySecretNamespace))
+	gets := 0
+	clientset.PrependReactor("get", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		if gets == 3 {
+			// The namespace controller removes the namespace
+			if err := clientset.Tracker().Delete(corev1.SchemeGroupVersion.WithResource("namespaces"), "", constants.QuayRepositorySecretNamespace); err != nil {
+				return true, nil, err
+			}
+		}
+		return false, nil, nil
+	})
+	i := &InstallAppStudio{clientset: clientset, SecretSource: fakeSecretSource{dockerConfig: []byte(testDockerConfig)}}
+
+	assert.NoError(t, i.createE2EQuaySecret(context.Background()))
+	ns, err := clientset.CoreV1().Namespaces().Get(context.Background(), constants.QuayRepositorySecretNamespace, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NotEqual(t, corev1.NamespaceTerminating, ns.Status.Phase)
+	assert.Equal(t, testDockerConfig, string(getQuaySecret(t, i).Data[corev1.DockerConfigJsonKey]))
+}
+
+func TestCreateE2EQuaySecretStuckTerminatingNamespace(t *testing.T) {
+	original := namespaceTerminationTimeout
+	namespaceTerminationTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { namespaceTerminationTimeout = original })
+	clientset := fake.NewSimpleClientset(terminatingNamespace(constants.QuayRepositorySecretNamespace))
+	i := &InstallAppStudio{clientset: clientset, SecretSource: fakeSecretSource{dockerConfig: []byte(testDockerConfig)}}
+
+	err := i.createE2EQuaySecret(context.Background())
+	assert.ErrorContains(t, err, "namespace "+constants.QuayRepositorySecretNamespace+" is stuck in the Terminating phase")
+}
@@ -0,0 +1,146 @@
+package installation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// ConfigMap with the environment of the SPI OAuth service
+	spiOAuthConfigMap = "spi-oauth-service-environment-config"
+	// Deployment of the SPI OAuth service, consuming spiOAuthConfigMap
+	spiOAuthDeployment = "spi-oauth-service"
+	// Key of the OAuth redirect proxy URL in spiOAuthConfigMap
+	oauthRedirectProxyURLKey = "OAUTH_REDIRECT_PROXY_URL"
+	// Annotation of the SPI OAuth deployment holding its replica count from before the installation
+	originalReplicasAnnotation = "e2e-tests.konflux-ci.dev/original-replicas"
+)
+
+// configureSPIOAuth sets the OAuth redirect proxy URL in the ConfigMap of the SPI OAuth service and restarts the service
+// when the URL changed. The bootstrap gets the URL in the OAUTH_REDIRECT_PROXY_URL env, this makes sure the running
+// service uses it. Nothing is done without a proxy URL or when SPI is not installed.
+func (i *InstallAppStudio) configureSPIOAuth(ctx context.Context) error {
+	proxyURL, err := i.oauthRedirectProxyURL()
+	if err != nil {
+		klog.Warningf("not configuring the SPI OAuth service: %+v", err)
+		return nil
+	} else if proxyURL == "" {
+		return nil
+	}
+	if err := i.checkKubeClient(); err != nil {
+		return err
+	}
+
+	if _, err := i.kubeClient().CoreV1().ConfigMaps(spiNamespace).Get(ctx, spiOAuthConfigMap, metav1.GetOptions{}); k8sErrors.IsNotFound(err) {
+		klog.Infof("configmap %s/%s not found, SPI is not installed", spiNamespace, spiOAuthConfigMap)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get configmap %s/%s: %+v", spiNamespace, spiOAuthConfigMap, err)
+	}
+	if err := i.recordSPIOAuthReplicas(ctx); err != nil {
+		return err
+	}
+	return i.PatchConfigMapAndRestart(ctx, spiNamespace, spiOAuthConfigMap, spiOAuthDeployment, map[string]string{oauthRedirectProxyURLKey: proxyURL})
+}
+
+// recordSPIOAuthReplicas records the replica count of the SPI OAuth deployment in its original-replicas annotation
+// before the installer touches the deployment, so RevertSPIConfig can scale it back. A recorded count is kept, it
+// is the one from before the first installation.
+func (i *InstallAppStudio) recordSPIOAuthReplicas(ctx context.Context) error {
+	deployment, err := i.kubeClient().AppsV1().Deployments(spiNamespace).Get(ctx, spiOAuthDeployment, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get deployment %s/%s: %+v", spiNamespace, spiOAuthDeployment, err)
+	}
+	if _, ok := deployment.Annotations[originalReplicasAnnotation]; ok {
+		return nil
+	}
+	// The API server defaults a missing replica count to 1
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	patch := map[string]interface{}{"metadata": map[string]interface{}{"annotations": map[string]interface{}{originalReplicasAnnotation: strconv.Itoa(int(replicas))}}}
+	return i.patchSPIObject(ctx, "deployment", spiOAuthDeployment, patch)
+}
+
+// RevertSPIConfig reverts the changes of the SPI OAuth configuration without uninstalling anything else:
+// the OAuth redirect proxy URL is removed from the OAuth service ConfigMap and the OAuth service deployment is
+// scaled back to the replica count recorded by the installation in its original-replicas annotation. Missing objects
+// are skipped.
+func (i *InstallAppStudio) RevertSPIConfig(ctx context.Context) error {
+	if err := i.checkKubeClient(); err != nil {
+		return err
+	}
+
+	cm, err := i.kubeClient().CoreV1().ConfigMaps(spiNamespace).Get(ctx, spiOAuthConfigMap, metav1.GetOptions{})
+	switch {
+	case k8sErrors.IsNotFound(err):
+		klog.Infof("configmap %s/%s not found, nothing to revert", spiNamespace, spiOAuthConfigMap)
+	case err != nil:
+		return fmt.Errorf("failed to get configmap %s/%s: %+v", spiNamespace, spiOAuthConfigMap, err)
+	default:
+		if _, ok := cm.Data[oauthRedirectProxyURLKey]; ok {
+			if err := i.patchSPIObject(ctx, "configmap", spiOAuthConfigMap, map[string]interface{}{"data": map[string]interface{}{oauthRedirectProxyURLKey: nil}}); err != nil {
+				return err
+			}
+			klog.Infof("removed %s from configmap %s/%s", oauthRedirectProxyURLKey, spiNamespace, spiOAuthConfigMap)
+		}
+	}
+
+	deployment, err := i.kubeClient().AppsV1().Deployments(spiNamespace).Get(ctx, spiOAuthDeployment, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		klog.Infof("deployment %s/%s not found, nothing to revert", spiNamespace, spiOAuthDeployment)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get deployment %s/%s: %+v", spiNamespace, spiOAuthDeployment, err)
+	}
+	original, ok := deployment.Annotations[originalReplicasAnnotation]
+	if !ok {
+		return nil
+	}
+	replicas, err := strconv.ParseInt(original, 10, 32)
+	if err != nil || replicas < 0 {
+		return fmt.Errorf("invalid %s annotation %q of deployment %s/%s", originalReplicasAnnotation, original, spiNamespace, spiOAuthDeployment)
+	}
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": map[string]interface{}{originalReplicasAnnotation: nil}},
+		"spec":     map[string]interface{}{"replicas": replicas},
+	}
+	if err := i.patchSPIObject(ctx, "deployment", spiOAuthDeployment, patch); err != nil {
+		return err
+	}
+	klog.Infof("restored %d replicas of deployment %s/%s", replicas, spiNamespace, spiOAuthDeployment)
+
+	return nil
+}
+
+// patchSPIObject applies the merge patch to the configmap or deployment of SPI, or only logs it in DryRun mode
+func (i *InstallAppStudio) patchSPIObject(ctx context.Context, kind, name string, patch map[string]interface{}) error {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal patch for %s %s/%s: %+v", kind, spiNamespace, name, err)
+	}
+	if i.DryRun {
+		klog.Infof("dry run: %s %s/%s would be patched with %s", kind, spiNamespace, name, data)
+		return nil
+	}
+
+	if kind == "configmap" {
+		_, err = i.kubeClient().CoreV1().ConfigMaps(spiNamespace).Patch(ctx, name, types.MergePatchType, data, metav1.PatchOptions{})
+	} else {
+		_, err = i.kubeClient().AppsV1().Deployments(spiNamespace).Patch(ctx, name, types.MergePatchType, data, metav1.PatchOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to patch %s %s/%s: %+v", kind, spiNamespace, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package installation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRevertSPIConfig(t *testing.T) {
+	replicas := int32(0)
+	clientset := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: spiOAuthConfigMap, Namespace: spiNamespace},
+			Data:       map[string]string{oauthRedirectProxyURLKey: "https://spi-oauth.apps.example.com", "BASEURL": "https://spi.example.com"},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: spiOAuthDeployment, Namespace: spiNamespace, Annotations: map[string]string{originalReplicasAnnotation: "2"}},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		},
+	)
+	i := &InstallAppStudio{clientset: clientset}
+
+	assert.NoError(t, i.RevertSPIConfig(context.Background()))
+
+	cm, err := clientset.CoreV1().ConfigMaps(spiNamespace).Get(context.Background(), spiOAuthConfigMap, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"BASEURL": "https://spi.example.com"}, cm.Data)
+
+	deployment, err := clientset.AppsV1().Deployments(spiNamespace).Get(context.Background(), spiOAuthDeployment, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), *deployment.Spec.Replicas)
+	assert.NotContains(t, deployment.Annotations, originalReplicasAnnotation)
+
+	// Nothing is left to revert
+	clientset.ClearActions()
+	assert.NoError(t, i.RevertSPIConfig(context.Background()))
+	for _, action := range clientset.Actions() {
+		assert.Equal(t, "get", action.GetVerb())
+	}
+}
+
+func TestRevertSPIConfigMissingObjects(t *testing.T) {
+	assert.NoError(t, (&InstallAppStudio{clientset: fake.NewSimpleClientset()}).RevertSPIConfig(context.Background()))
+
+	clientset := fake.NewSimpleClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: spiOAuthDeployment, Namespace: spiNamespace, Annotations: map[string]string{originalReplicasAnnotation: "many"}},
+	})
+	assert.ErrorContains(t, (&InstallAppStudio{clientset: clientset}).RevertSPIConfig(context.Background()), `invalid e2e-tests.konflux-ci.dev/original-replicas annotation "many"`)
+}
+
+func TestConfigureSPIOAuth(t *testing.T) {
+	t.Setenv("OAUTH_REDIRECT_PROXY_URL", "")
+	clientset := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: spiOAuthConfigMap, Namespace: spiNamespace},
+			Data:       map[string]string{"BASEURL": "https://spi.example.com"},
+		},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: spiOAuthDeployment, Namespace: spiNamespace}},
+	)
+	i := &InstallAppStudio{clientset: clientset, AppsDomain: "apps.example.com"}
+
+	assert.NoError(t, i.configureSPIOAuth(context.Background()))
+	cm, err := clientset.CoreV1().ConfigMaps(spiNamespace).Get(context.Background(), spiOAuthConfigMap, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://spi-oauth-route-spi-system.apps.example.com", cm.Data[oauthRedirectProxyURLKey])
+	deployment, err := clientset.AppsV1().Deployments(spiNamespace).Get(context.Background(), spiOAuthDeployment, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, deployment.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"])
+
+	// The configured URL is not patched nor restarted again
+	clientset.ClearActions()
+	assert.NoError(t, i.configureSPIOAuth(context.Background()))
+	for _, action := range clientset.Actions() {
+		assert.Equal(t, "get", action.GetVerb())
+	}
+}
+
+func TestConfigureSPIOAuthWithoutSPI(t *testing.T) {
+	t.Setenv("OAUTH_REDIRECT_PROXY_URL", "https://spi-oauth.example.com")
+	assert.NoError(t, (&InstallAppStudio{clientset: fake.NewSimpleClientset()}).configureSPIOAuth(context.Background()))
+
+	// Without a proxy URL the cluster is not needed
+	t.Setenv("OAUTH_REDIRECT_PROXY_URL", "")
+	assert.NoError(t, (&InstallAppStudio{}).configureSPIOAuth(context.Background()))
+}
+
+func TestRevertSPIConfigRestoresRecordedReplicas(t *testing.T) {
+	t.Setenv("OAUTH_REDIRECT_PROXY_URL", "https://spi-oauth.example.com")
+	replicas := int32(3)
+	clientset := fake.NewSimpleClientset(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: spiOAuthConfigMap, Namespace: spiNamespace}},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: spiOAuthDeployment, Namespace: spiNamespace},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		},
+	)
+	i := &InstallAppStudio{clientset: clientset}
+	getReplicas := func() int32 {
+		deployment, err := clientset.AppsV1().Deployments(spiNamespace).Get(context.Background(), spiOAuthDeployment, metav1.GetOptions{})
+		assert.NoError(t, err)
+		return *deployment.Spec.Replicas
+	}
+
+	assert.NoError(t, i.configureSPIOAuth(context.Background()))
+	deployment, err := clientset.AppsV1().Deployments(spiNamespace).Get(context.Background(), spiOAuthDeployment, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "3", deployment.Annotations[originalReplicasAnnotation])
+
+	// The deployment is scaled after the installation, e.g. by a test
+	scaled := int32(0)
+	deployment.Spec.Replicas = &scaled
+	_, err = clientset.AppsV1().Deployments(spiNamespace).Update(context.Background(), deployment, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), getReplicas())
+
+	// Another installation keeps the count recorded by the first one
+	t.Setenv("OAUTH_REDIRECT_PROXY_URL", "https://spi-oauth-2.example.com")
+	assert.NoError(t, i.configureSPIOAuth(context.Background()))
+
+	assert.NoError(t, i.RevertSPIConfig(context.Background()))
+	assert.Equal(t, int32(3), getReplicas())
+}
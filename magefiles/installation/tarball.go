@@ -0,0 +1,158 @@
+package installation
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// extractTarball extracts the .tar.gz of infra-deployments into dir, replacing its content. The archive may hold the
+// repository at its root or in a single top-level directory, as the archives downloaded from GitHub do.
+func extractTarball(tarball, dir string) error {
+	parent := filepath.Dir(dir)
+	if err := os.MkdirAll(parent, 0750); err != nil {
+		return fmt.Errorf("failed to create directory %s: %+v", parent, err)
+	}
+	tmp, err := os.MkdirTemp(parent, ".infra-deployments-tarball-")
+	if err != nil {
+		return fmt.Errorf("failed to create directory for extracting %s: %+v", tarball, err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := untar(tarball, tmp); err != nil {
+		return err
+	}
+
+	root := tmp
+	if _, err := os.Stat(filepath.Join(root, bootstrapScript)); err != nil {
+		entries, err := os.ReadDir(tmp)
+		if err != nil {
+			return fmt.Errorf("failed to read extracted tarball %s: %+v", tarball, err)
+		}
+		if len(entries) == 1 && entries[0].IsDir() {
+			root = filepath.Join(tmp, entries[0].Name())
+		}
+		if _, err := os.Stat(filepath.Join(root, bootstrapScript)); err != nil {
+			return fmt.Errorf("tarball %s doesn't contain the bootstrap script %s", tarball, bootstrapScript)
+		}
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove clone directory %s: %+v", dir, err)
+	}
+	if err := os.Rename(root, dir); err != nil {
+		return fmt.Errorf("failed to move extracted tarball to %s: %+v", dir, err)
+	}
+
+	return nil
+}
+
+// untar extracts the .tar.gz into dir, rejecting entries and links outside of it and entries of types other than
+// directories, regular files, symlinks and hardlinks. Symlinks are created once everything else is extracted so that
+// no entry is written through one.
+func untar(tarball, dir string) error {
+	f, err := os.Open(filepath.Clean(tarball))
+	if err != nil {
+		return fmt.Errorf("failed to open tarball %s: %+v", tarball, err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read tarball %s: %+v", tarball, err)
+	}
+	defer gz.Close()
+
+	reader := tar.NewReader(gz)
+	var symlinks []*tar.Header
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return createSymlinks(tarball, dir, symlinks)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tarball %s: %+v", tarball, err)
+		}
+
+		target := filepath.Join(dir, header.Name) // #nosec G305 -- the target is checked to be inside dir
+		if !insideDir(dir, target) {
+			return fmt.Errorf("tarball %s has entry %s outside of the archive root", tarball, header.Name)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0750); err != nil {
+				return fmt.Errorf("failed to create directory %s: %+v", target, err)
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0750); err != nil {
+				return fmt.Errorf("failed to create directory %s: %+v", filepath.Dir(target), err)
+			}
+			// #nosec G115 -- tar modes fit into a file mode
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm())
+			if err != nil {
+				return fmt.Errorf("failed to create file %s: %+v", target, err)
+			}
+			// #nosec G110 -- the tarball is provided by the user running the installation
+			_, err = io.Copy(out, reader)
+			out.Close()
+			if err != nil {
+				return fmt.Errorf("failed to extract %s: %+v", target, err)
+			}
+		case tar.TypeLink:
+			source := filepath.Join(dir, header.Linkname) // #nosec G305 -- the source is checked to be inside dir
+			if !insideDir(dir, source) {
+				return fmt.Errorf("tarball %s has hardlink %s to %s outside of the archive root", tarball, header.Name, header.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0750); err != nil {
+				return fmt.Errorf("failed to create directory %s: %+v", filepath.Dir(target), err)
+			}
+			if err := os.Link(source, target); err != nil {
+				return fmt.Errorf("failed to create hardlink %s: %+v", target, err)
+			}
+		case tar.TypeSymlink:
+			if filepath.IsAbs(header.Linkname) || !insideDir(dir, filepath.Join(filepath.Dir(target), header.Linkname)) {
+				return fmt.Errorf("tarball %s has symlink %s to %s outside of the archive root", tarball, header.Name, header.Linkname)
+			}
+			symlinks = append(symlinks, header)
+		case tar.TypeXGlobalHeader:
+			// pax global headers, such as the commit of the archives downloaded from GitHub, hold no file
+		default:
+			return fmt.Errorf("tarball %s has entry %s of unsupported type %q", tarball, header.Name, header.Typeflag)
+		}
+	}
+}
+
+// createSymlinks creates the symlinks extracted from the tarball into dir, rejecting the ones that don't resolve inside
+// of it, e.g. through another symlink
+func createSymlinks(tarball, dir string, symlinks []*tar.Header) error {
+	for _, header := range symlinks {
+		target := filepath.Join(dir, header.Name) // #nosec G305 -- the target was checked to be inside dir
+		if err := os.MkdirAll(filepath.Dir(target), 0750); err != nil {
+			return fmt.Errorf("failed to create directory %s: %+v", filepath.Dir(target), err)
+		}
+		if err := os.Symlink(header.Linkname, target); err != nil {
+			return fmt.Errorf("failed to create symlink %s: %+v", target, err)
+		}
+	}
+
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve directory %s: %+v", dir, err)
+	}
+	for _, header := range symlinks {
+		resolved, err := filepath.EvalSymlinks(filepath.Join(dir, header.Name))
+		if err != nil || !insideDir(realDir, resolved) {
+			return fmt.Errorf("tarball %s has symlink %s to %s, which doesn't resolve inside the archive root", tarball, header.Name, header.Linkname)
+		}
+	}
+
+	return nil
+}
+
+// insideDir returns whether path is dir or inside of it
+func insideDir(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
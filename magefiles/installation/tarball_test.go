@@ -0,0 +1,142 @@
+package installation
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTarball creates a .tar.gz fixture with the given files, keyed by their path in the archive
+func writeTarball(t *testing.T, files map[string]string) string {
+	return writeTarballWithHeaders(t, files)
+}
+
+// writeTarballWithHeaders creates a .tar.gz fixture with the given files followed by the given content-less entries,
+// e.g. links
+func writeTarballWithHeaders(t *testing.T, files map[string]string, headers ...*tar.Header) string {
+	path := filepath.Join(t.TempDir(), "infra-deployments.tar.gz")
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	for _, header := range headers {
+		assert.NoError(t, tw.WriteHeader(header))
+	}
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	assert.NoError(t, f.Close())
+	return path
+}
+
+func TestCloneInfraDeploymentsFromTarball(t *testing.T) {
+	tarball := writeTarball(t, map[string]string{
+		"infra-deployments-main/" + bootstrapScript: "#!/bin/bash\n",
+		"infra-deployments-main/components/README":  "components",
+	})
+	cloneDir := filepath.Join(t.TempDir(), "infra-deployments")
+	i := &InstallAppStudio{InfraDeploymentsTarball: tarball, InfraDeploymentsCloneDir: cloneDir}
+
+	assert.NoError(t, i.cloneInfraDeployments(context.Background()))
+	content, err := os.ReadFile(filepath.Join(cloneDir, "components", "README"))
+	assert.NoError(t, err)
+	assert.Equal(t, "components", string(content))
+	info, err := os.Stat(filepath.Join(cloneDir, bootstrapScript))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	assert.NoError(t, i.checkBootstrapExecutable())
+
+	entries, err := os.ReadDir(filepath.Dir(cloneDir))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1, "the extraction directory is removed")
+}
+
+func TestCloneInfraDeploymentsFromTarballAtRoot(t *testing.T) {
+	tarball := writeTarball(t, map[string]string{bootstrapScript: "#!/bin/bash\n"})
+	cloneDir := filepath.Join(t.TempDir(), "infra-deployments")
+
+	assert.NoError(t, (&InstallAppStudio{InfraDeploymentsTarball: tarball, InfraDeploymentsCloneDir: cloneDir}).cloneInfraDeployments(context.Background()))
+	assert.FileExists(t, filepath.Join(cloneDir, bootstrapScript))
+}
+
+func TestCloneInfraDeploymentsFromInvalidTarball(t *testing.T) {
+	cloneDir := filepath.Join(t.TempDir(), "infra-deployments")
+
+	i := &InstallAppStudio{InfraDeploymentsTarball: writeTarball(t, map[string]string{"README.md": "readme"}), InfraDeploymentsCloneDir: cloneDir}
+	assert.ErrorContains(t, i.cloneInfraDeployments(context.Background()), "doesn't contain the bootstrap script "+bootstrapScript)
+	assert.NoDirExists(t, cloneDir)
+
+	i.InfraDeploymentsTarball = writeTarball(t, map[string]string{"../" + bootstrapScript: "#!/bin/bash\n"})
+	assert.ErrorContains(t, i.cloneInfraDeployments(context.Background()), "outside of the archive root")
+}
+
+func TestCloneInfraDeploymentsFromTarballWithLinks(t *testing.T) {
+	tarball := writeTarballWithHeaders(t, map[string]string{
+		"infra-deployments-main/" + bootstrapScript: "#!/bin/bash\n",
+		"infra-deployments-main/components/README":  "components",
+	},
+		&tar.Header{Name: "pax_global_header", Typeflag: tar.TypeXGlobalHeader, PAXRecords: map[string]string{"comment": "0123abc"}},
+		&tar.Header{Name: "infra-deployments-main/README", Typeflag: tar.TypeSymlink, Linkname: "components/README"},
+		&tar.Header{Name: "infra-deployments-main/docs/README", Typeflag: tar.TypeLink, Linkname: "infra-deployments-main/components/README"},
+	)
+	cloneDir := filepath.Join(t.TempDir(), "infra-deployments")
+
+	assert.NoError(t, (&InstallAppStudio{InfraDeploymentsTarball: tarball, InfraDeploymentsCloneDir: cloneDir}).cloneInfraDeployments(context.Background()))
+	link, err := os.Readlink(filepath.Join(cloneDir, "README"))
+	assert.NoError(t, err)
+	assert.Equal(t, "components/README", link)
+	for _, name := range []string{"README", filepath.Join("docs", "README")} {
+		content, err := os.ReadFile(filepath.Join(cloneDir, name))
+		assert.NoError(t, err)
+		assert.Equal(t, "components", string(content))
+	}
+}
+
+func TestCloneInfraDeploymentsFromTarballWithUnsafeEntries(t *testing.T) {
+	files := map[string]string{bootstrapScript: "#!/bin/bash\n"}
+	for name, tc := range map[string]struct {
+		headers []*tar.Header
+		err     string
+	}{
+		"absolute symlink": {
+			headers: []*tar.Header{{Name: "passwd", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}},
+			err:     "has symlink passwd to /etc/passwd outside of the archive root",
+		},
+		"relative symlink": {
+			headers: []*tar.Header{{Name: "components/parent", Typeflag: tar.TypeSymlink, Linkname: "../.."}},
+			err:     "has symlink components/parent to ../.. outside of the archive root",
+		},
+		"symlink through another symlink": {
+			headers: []*tar.Header{
+				{Name: "root", Typeflag: tar.TypeSymlink, Linkname: "."},
+				{Name: "parent", Typeflag: tar.TypeSymlink, Linkname: "root/.."},
+			},
+			err: "has symlink parent to root/.., which doesn't resolve inside the archive root",
+		},
+		"hardlink": {
+			headers: []*tar.Header{{Name: "passwd", Typeflag: tar.TypeLink, Linkname: "../../etc/passwd"}},
+			err:     "has hardlink passwd to ../../etc/passwd outside of the archive root",
+		},
+		"device": {
+			headers: []*tar.Header{{Name: "null", Typeflag: tar.TypeChar, Devmajor: 1, Devminor: 3}},
+			err:     "has entry null of unsupported type '3'",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cloneDir := filepath.Join(t.TempDir(), "infra-deployments")
+			i := &InstallAppStudio{InfraDeploymentsTarball: writeTarballWithHeaders(t, files, tc.headers...), InfraDeploymentsCloneDir: cloneDir}
+
+			assert.ErrorContains(t, i.cloneInfraDeployments(context.Background()), tc.err)
+			assert.NoDirExists(t, cloneDir)
+		})
+	}
+}
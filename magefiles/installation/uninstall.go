@@ -0,0 +1,113 @@
+package installation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/konflux-ci/e2e-tests/pkg/constants"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// uninstallStep removes one resource created by the installer
+type uninstallStep struct {
+	resource string
+	run      func(ctx context.Context) error
+}
+
+// Uninstall removes the resources the installer creates besides the bootstrap: the installed ref ConfigMap,
+// the namespace of the e2e quay secret and E2EApplicationsNamespace. Only the namespaces in TouchedNamespaces are
+// deleted, other namespaces may be shared with other jobs; UninstallDeletesNamespaces deletes them regardless, e.g.
+// when this instance didn't run the installation. Of a namespace of the e2e quay secret which isn't deleted, or is
+// shared with other installations by InstanceSuffix, only the secret is removed. The deletions and the waits for the
+// namespaces to terminate respect the deadline of ctx; when it is hit, the returned error lists the removed
+// resources and the ones which are left.
+func (i *InstallAppStudio) Uninstall(ctx context.Context) error {
+	if err := i.checkKubeClient(); err != nil {
+		return err
+	}
+
+	refNamespace, refName := i.installedRefConfigMap()
+	steps := []uninstallStep{{
+		resource: fmt.Sprintf("configmap %s/%s", refNamespace, refName),
+		run: func(ctx context.Context) error {
+			err := i.kubeClient().CoreV1().ConfigMaps(refNamespace).Delete(ctx, refName, metav1.DeleteOptions{})
+			if err != nil && !k8sErrors.IsNotFound(err) {
+				return err
+			}
+			return nil
+		},
+	}}
+	if !i.SkipQuaySecret && (i.InstanceSuffix != "" || !i.targetsNamespace(constants.QuayRepositorySecretNamespace)) {
+		namespace, name := constants.QuayRepositorySecretNamespace, i.quaySecretName()
+		steps = append(steps, uninstallStep{
+			resource: fmt.Sprintf("secret %s/%s", namespace, name),
+			run: func(ctx context.Context) error {
+				err := i.kubeClient().CoreV1().Secrets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+				if err != nil && !k8sErrors.IsNotFound(err) {
+					return err
+				}
+				return nil
+			},
+		})
+	} else if !i.SkipQuaySecret {
+		steps = append(steps, i.deleteNamespaceStep(constants.QuayRepositorySecretNamespace))
+	}
+	if namespace := i.e2eApplicationsNamespace(); namespace != "" && i.targetsNamespace(namespace) {
+		steps = append(steps, i.deleteNamespaceStep(namespace))
+	}
+
+	var removed []string
+	var errs []error
+	for index, step := range steps {
+		err := step.run(ctx)
+		if err == nil {
+			klog.Infof("removed %s", step.resource)
+			removed = append(removed, step.resource)
+			continue
+		}
+		errs = append(errs, fmt.Errorf("failed to remove %s: %w", step.resource, err))
+		if ctx.Err() != nil {
+			var left []string
+			for _, s := range steps[index:] {
+				left = append(left, s.resource)
+			}
+			return fmt.Errorf("uninstall is incomplete, removed: [%s], not removed: [%s]: %w",
+				strings.Join(removed, ", "), strings.Join(left, ", "), errors.Join(append(errs, ctx.Err())...))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// targetsNamespace reports whether Uninstall deletes the namespace: a namespace touched by the installation of this
+// instance, or any namespace with UninstallDeletesNamespaces
+func (i *InstallAppStudio) targetsNamespace(namespace string) bool {
+	return i.UninstallDeletesNamespaces || slices.Contains(i.TouchedNamespaces(), namespace)
+}
+
+// deleteNamespaceStep deletes the namespace and waits until it is terminated, at most until the deadline of the context
+func (i *InstallAppStudio) deleteNamespaceStep(name string) uninstallStep {
+	return uninstallStep{
+		resource: "namespace " + name,
+		run: func(ctx context.Context) error {
+			err := i.kubeClient().CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{})
+			if k8sErrors.IsNotFound(err) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			timeout := namespaceTerminationTimeout
+			if deadline, ok := ctx.Deadline(); ok {
+				timeout = time.Until(deadline)
+			}
+			return i.WaitForNamespaceTerminated(ctx, name, timeout)
+		},
+	}
+}
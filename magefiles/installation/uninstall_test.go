@@ -0,0 +1,91 @@
+package installation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/konflux-ci/e2e-tests/pkg/constants"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func installedObjects() []runtime.Object {
+	return []runtime.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: constants.QuayRepositorySecretNamespace}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "e2e-apps"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: defaultInstalledRefConfigMap, Namespace: defaultInstalledRefNamespace}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: constants.QuayRepositorySecretName, Namespace: constants.QuayRepositorySecretNamespace}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "other-job-secret", Namespace: constants.QuayRepositorySecretNamespace}},
+	}
+}
+
+func TestUninstall(t *testing.T) {
+	clientset := fake.NewSimpleClientset(installedObjects()...)
+	i := &InstallAppStudio{clientset: clientset, E2EApplicationsNamespace: "e2e-apps"}
+
+	// This instance didn't install, the namespaces which may be shared are kept
+	assert.NoError(t, i.Uninstall(context.Background()))
+
+	namespaces, err := clientset.CoreV1().Namespaces().List(context.Background(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, namespaces.Items, 2)
+	_, err = clientset.CoreV1().Secrets(constants.QuayRepositorySecretNamespace).Get(context.Background(), constants.QuayRepositorySecretName, metav1.GetOptions{})
+	assert.True(t, k8sErrors.IsNotFound(err))
+	_, err = clientset.CoreV1().Secrets(constants.QuayRepositorySecretNamespace).Get(context.Background(), "other-job-secret", metav1.GetOptions{})
+	assert.NoError(t, err)
+	_, err = clientset.CoreV1().ConfigMaps(defaultInstalledRefNamespace).Get(context.Background(), defaultInstalledRefConfigMap, metav1.GetOptions{})
+	assert.True(t, k8sErrors.IsNotFound(err))
+
+	// The namespaces are deleted only when asked for
+	i.UninstallDeletesNamespaces = true
+	assert.NoError(t, i.Uninstall(context.Background()))
+	namespaces, err = clientset.CoreV1().Namespaces().List(context.Background(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, namespaces.Items)
+
+	// Nothing is left to remove on a second run
+	assert.NoError(t, i.Uninstall(context.Background()))
+}
+
+func TestUninstallDeadlineExceeded(t *testing.T) {
+	clientset := fake.NewSimpleClientset(installedObjects()...)
+	// The namespace of the quay secret is stuck in Terminating
+	clientset.PrependReactor("delete", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.(k8stesting.DeleteAction).GetName() != constants.QuayRepositorySecretNamespace {
+			return false, nil, nil
+		}
+		return true, nil, clientset.Tracker().Update(corev1.SchemeGroupVersion.WithResource("namespaces"), terminatingNamespace(constants.QuayRepositorySecretNamespace), "")
+	})
+	i := &InstallAppStudio{clientset: clientset, E2EApplicationsNamespace: "e2e-apps", UninstallDeletesNamespaces: true}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := i.Uninstall(ctx)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	assert.ErrorContains(t, err, "uninstall is incomplete, removed: [configmap e2e-secrets/infra-deployments-installed-ref], not removed: [namespace e2e-secrets, namespace e2e-apps]")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = clientset.CoreV1().Namespaces().Get(context.Background(), "e2e-apps", metav1.GetOptions{})
+	assert.NoError(t, err)
+}
+
+func TestUninstallTargetsTouchedNamespaces(t *testing.T) {
+	clientset := fake.NewSimpleClientset(installedObjects()...)
+	i := &InstallAppStudio{clientset: clientset, E2EApplicationsNamespace: "e2e-apps"}
+	// The installation only wrote into the namespace of the quay secret, e2e-apps is owned by someone else
+	i.touchNamespace(constants.QuayRepositorySecretNamespace)
+
+	assert.NoError(t, i.Uninstall(context.Background()))
+
+	_, err := clientset.CoreV1().Namespaces().Get(context.Background(), constants.QuayRepositorySecretNamespace, metav1.GetOptions{})
+	assert.True(t, k8sErrors.IsNotFound(err))
+	_, err = clientset.CoreV1().Namespaces().Get(context.Background(), "e2e-apps", metav1.GetOptions{})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,103 @@
+package installation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/konflux-ci/e2e-tests/pkg/constants"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	spiNamespace = "spi-system"
+	// Secret holding the configuration of the SPI operator, created by the bootstrap of infra-deployments
+	spiConfigurationSecret = "shared-configuration-file"
+	// Route of the SPI OAuth service, its host is the default OAuth redirect proxy URL
+	defaultSPIOAuthRouteName = "spi-oauth-route"
+)
+
+// Deployments which have to be ready on an installed cluster. The image-controller is checked in ImageControllerNamespace
+var verifiedDeployments = []types.NamespacedName{
+	{Namespace: "build-service", Name: "build-service-controller-manager"},
+	{Namespace: spiNamespace, Name: "spi-controller-manager"},
+}
+
+// Name of the image-controller deployment checked by VerifyOnly
+const imageControllerDeployment = "image-controller-controller-manager"
+
+// VerifyOnly checks the health of an already installed cluster without changing it: the deployments of the
+// installed services are ready, the e2e quay secret is present and SPI is configured. All failures are reported.
+func (i *InstallAppStudio) VerifyOnly(ctx context.Context) error {
+	if err := i.checkKubeClient(); err != nil {
+		return err
+	}
+
+	deployments := append(append([]types.NamespacedName(nil), verifiedDeployments...), types.NamespacedName{Namespace: i.imageControllerNamespace(), Name: imageControllerDeployment})
+	errs := i.verifyDeployments(ctx, deployments)
+
+	if !i.SkipQuaySecret {
+		dataKey, _ := i.quaySecretLayout()
+		secret, err := i.kubeClient().CoreV1().Secrets(constants.QuayRepositorySecretNamespace).Get(ctx, i.quaySecretName(), metav1.GetOptions{})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get secret %s/%s: %w", constants.QuayRepositorySecretNamespace, i.quaySecretName(), err))
+		} else if len(secret.Data[dataKey]) == 0 {
+			errs = append(errs, fmt.Errorf("secret %s/%s has no %s data", constants.QuayRepositorySecretNamespace, i.quaySecretName(), dataKey))
+		}
+	}
+
+	if _, err := i.kubeClient().CoreV1().Secrets(spiNamespace).Get(ctx, spiConfigurationSecret, metav1.GetOptions{}); err != nil {
+		errs = append(errs, fmt.Errorf("SPI is not configured, failed to get secret %s/%s: %w", spiNamespace, spiConfigurationSecret, err))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("verification of the installation failed: %w", err)
+	}
+	klog.Infof("verification of the installation succeeded")
+
+	return nil
+}
+
+// verifyDeployments checks that the deployments are ready, using up to VerifyConcurrency parallel workers.
+// The errors are returned in the order of the deployments.
+func (i *InstallAppStudio) verifyDeployments(ctx context.Context, targets []types.NamespacedName) []error {
+	workers := i.VerifyConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	results := make([]error, len(targets))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(targets); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				target := targets[index]
+				deployment, err := i.kubeClient().AppsV1().Deployments(target.Namespace).Get(ctx, target.Name, metav1.GetOptions{})
+				if err != nil {
+					results[index] = fmt.Errorf("failed to get deployment %s: %w", target, err)
+				} else if !deploymentReady(deployment) {
+					results[index] = fmt.Errorf("deployment %s is not ready", target)
+				}
+			}
+		}()
+	}
+	for index := range targets {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	var errs []error
+	for _, err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
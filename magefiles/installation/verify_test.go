@@ -0,0 +1,137 @@
+package installation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/konflux-ci/e2e-tests/pkg/constants"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	appsv1client "k8s.io/client-go/kubernetes/typed/apps/v1"
+)
+
+func readyDeployment(namespace, name string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Generation: 1},
+		Status:     appsv1.DeploymentStatus{ObservedGeneration: 1, UpdatedReplicas: 1, AvailableReplicas: 1},
+	}
+}
+
+func installedClusterObjects() []runtime.Object {
+	objects := []runtime.Object{
+		readyDeployment("image-controller", imageControllerDeployment),
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: constants.QuayRepositorySecretName, Namespace: constants.QuayRepositorySecretNamespace},
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(testDockerConfig)},
+		},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: spiConfigurationSecret, Namespace: spiNamespace}},
+	}
+	for _, target := range verifiedDeployments {
+		objects = append(objects, readyDeployment(target.Namespace, target.Name))
+	}
+	return objects
+}
+
+func TestVerifyOnly(t *testing.T) {
+	clientset := fake.NewSimpleClientset(installedClusterObjects()...)
+	i := &InstallAppStudio{clientset: clientset}
+
+	assert.NoError(t, i.VerifyOnly(context.Background()))
+	assert.NotEmpty(t, clientset.Actions())
+	for _, action := range clientset.Actions() {
+		assert.Contains(t, []string{"get", "list", "watch"}, action.GetVerb(), "unexpected %s of %s", action.GetVerb(), action.GetResource().Resource)
+	}
+}
+
+func TestVerifyOnlyReportsAllFailures(t *testing.T) {
+	clientset := fake.NewSimpleClientset(installedClusterObjects()...)
+	notReady := readyDeployment("build-service", "build-service-controller-manager")
+	notReady.Status.AvailableReplicas = 0
+	_, err := clientset.AppsV1().Deployments("build-service").Update(context.Background(), notReady, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, clientset.CoreV1().Secrets(spiNamespace).Delete(context.Background(), spiConfigurationSecret, metav1.DeleteOptions{}))
+	i := &InstallAppStudio{clientset: clientset, QuaySecretDataKey: "token"}
+
+	err = i.VerifyOnly(context.Background())
+	assert.ErrorContains(t, err, "deployment build-service/build-service-controller-manager is not ready")
+	assert.ErrorContains(t, err, "secret e2e-secrets/quay-repository has no token data")
+	assert.ErrorContains(t, err, "SPI is not configured")
+	assert.NotContains(t, err.Error(), "spi-controller-manager")
+
+	i.SkipQuaySecret = true
+	assert.NotContains(t, i.VerifyOnly(context.Background()).Error(), "quay-repository")
+}
+
+// concurrencyTrackingClientset records the maximum number of deployment gets running at the same time
+type concurrencyTrackingClientset struct {
+	*fake.Clientset
+	mu            sync.Mutex
+	inFlight, max int
+}
+
+func (c *concurrencyTrackingClientset) AppsV1() appsv1client.AppsV1Interface {
+	return trackingAppsV1{AppsV1Interface: c.Clientset.AppsV1(), clientset: c}
+}
+
+type trackingAppsV1 struct {
+	appsv1client.AppsV1Interface
+	clientset *concurrencyTrackingClientset
+}
+
+func (a trackingAppsV1) Deployments(namespace string) appsv1client.DeploymentInterface {
+	return trackingDeployments{DeploymentInterface: a.AppsV1Interface.Deployments(namespace), clientset: a.clientset}
+}
+
+type trackingDeployments struct {
+	appsv1client.DeploymentInterface
+	clientset *concurrencyTrackingClientset
+}
+
+func (d trackingDeployments) Get(ctx context.Context, name string, opts metav1.GetOptions) (*appsv1.Deployment, error) {
+	c := d.clientset
+	c.mu.Lock()
+	c.inFlight++
+	c.max = max(c.max, c.inFlight)
+	c.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	c.mu.Lock()
+	c.inFlight--
+	c.mu.Unlock()
+	return d.DeploymentInterface.Get(ctx, name, opts)
+}
+
+func TestVerifyOnlyConcurrently(t *testing.T) {
+	original := verifiedDeployments
+	t.Cleanup(func() { verifiedDeployments = original })
+	verifiedDeployments = nil
+	objects := installedClusterObjects()
+	for n := 0; n < 20; n++ {
+		target := types.NamespacedName{Namespace: fmt.Sprintf("service-%02d", n), Name: "controller-manager"}
+		verifiedDeployments = append(verifiedDeployments, target)
+		deployment := readyDeployment(target.Namespace, target.Name)
+		if n%5 == 0 {
+			deployment.Status.AvailableReplicas = 0
+		}
+		objects = append(objects, deployment)
+	}
+	clientset := &concurrencyTrackingClientset{Clientset: fake.NewSimpleClientset(objects...)}
+	i := &InstallAppStudio{clientset: clientset, VerifyConcurrency: 4}
+
+	err := i.VerifyOnly(context.Background())
+	assert.Equal(t, 4, clientset.max)
+	assert.ErrorContains(t, err, strings.Join([]string{
+		"deployment service-00/controller-manager is not ready",
+		"deployment service-05/controller-manager is not ready",
+		"deployment service-10/controller-manager is not ready",
+		"deployment service-15/controller-manager is not ready",
+	}, "\n"))
+}
@@ -0,0 +1,475 @@
+package installation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Interval between two checks of the wait helpers when PollInterval is not set. Shortened in unit tests
+var defaultPollInterval = 5 * time.Second
+
+// pollInterval returns the interval between two checks of the wait helpers
+func (i *InstallAppStudio) pollInterval() time.Duration {
+	if i.PollInterval > 0 {
+		return i.PollInterval
+	}
+	return defaultPollInterval
+}
+
+// How long API calls failing with transient errors are retried
+const transientErrorRetryTimeout = 2 * time.Minute
+
+// How long the installer waits for a terminating namespace to be deleted before recreating it
+var namespaceTerminationTimeout = 2 * time.Minute
+
+// isTransientAPIError returns true for errors which are worth to retry, e.g. when API server is not yet fully available after bootstrap
+func isTransientAPIError(err error) bool {
+	return k8sErrors.IsServerTimeout(err) || k8sErrors.IsTimeout(err) || k8sErrors.IsTooManyRequests(err) ||
+		k8sErrors.IsServiceUnavailable(err) || utilnet.IsConnectionRefused(err) || utilnet.IsConnectionReset(err) || utilnet.IsProbableEOF(err)
+}
+
+// retryOnTransientAPIErrors calls fn until it succeeds, fails with a non-transient error, the timeout is reached
+// or the RetryBudget is spent. The last error returned by fn is returned.
+func (i *InstallAppStudio) retryOnTransientAPIErrors(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+	return i.retryOnAPIErrors(ctx, timeout, isTransientAPIError, fn)
+}
+
+// retryOnAPIErrors is retryOnTransientAPIErrors with custom retriable errors
+func (i *InstallAppStudio) retryOnAPIErrors(ctx context.Context, timeout time.Duration, retriable func(error) bool, fn func(ctx context.Context) error) error {
+	var lastErr error
+	err := wait.PollUntilContextTimeout(ctx, i.pollInterval(), timeout, true, func(ctx context.Context) (bool, error) {
+		lastErr = fn(ctx)
+		if lastErr == nil {
+			return true, nil
+		}
+		if retriable(lastErr) {
+			if err := i.spendRetry(); err != nil {
+				lastErr = fmt.Errorf("%w; last error: %+v", err, lastErr)
+				return false, lastErr
+			}
+			klog.Warningf("got a transient error, will retry: %+v", lastErr)
+			return false, nil
+		}
+		return false, lastErr
+	})
+	if err != nil && lastErr != nil {
+		return lastErr
+	}
+
+	return err
+}
+
+// WaitForNamespaceTerminated waits until the namespace is completely removed from the cluster, so it can be safely created again
+func (i *InstallAppStudio) WaitForNamespaceTerminated(ctx context.Context, name string, timeout time.Duration) error {
+	if err := i.checkKubeClient(); err != nil {
+		return err
+	}
+	err := wait.PollUntilContextTimeout(ctx, i.pollInterval(), timeout, true, func(ctx context.Context) (bool, error) {
+		ns, err := i.kubeClient().CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			if k8sErrors.IsNotFound(err) {
+				return true, nil
+			}
+			klog.Warningf("failed to get namespace %s: %+v", name, err)
+			return false, nil
+		}
+		klog.Infof("namespace %s is still present (phase: %s)", name, ns.Status.Phase)
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("namespace %s was not terminated in %v: %+v", name, timeout, err)
+	}
+
+	return nil
+}
+
+// WaitForDeploymentReady waits until the deployment controller observed the current generation of the deployment
+// and all its replicas are updated and available
+func (i *InstallAppStudio) WaitForDeploymentReady(ctx context.Context, namespace, name string, timeout time.Duration) error {
+	if err := i.checkKubeClient(); err != nil {
+		return err
+	}
+	err := wait.PollUntilContextTimeout(ctx, i.pollInterval(), timeout, true, func(ctx context.Context) (bool, error) {
+		deployment, err := i.kubeClient().AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			klog.Warningf("failed to get deployment %s/%s: %+v", namespace, name, err)
+			return false, nil
+		}
+		return deploymentReady(deployment), nil
+	})
+	if err != nil {
+		return fmt.Errorf("deployment %s/%s did not become ready in %v: %+v", namespace, name, timeout, err)
+	}
+
+	return nil
+}
+
+// deploymentReady returns true when the deployment controller observed the current generation of the deployment
+// and all its replicas are updated and available
+func deploymentReady(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	return status.ObservedGeneration >= deployment.Generation && status.UpdatedReplicas >= replicas && status.AvailableReplicas >= replicas
+}
+
+// deleteSecretAndWait deletes the secret and waits until it is removed from the cluster
+func (i *InstallAppStudio) deleteSecretAndWait(ctx context.Context, namespace, name string, timeout time.Duration) error {
+	if err := i.checkKubeClient(); err != nil {
+		return err
+	}
+	err := i.kubeClient().CoreV1().Secrets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return fmt.Errorf("error when deleting secret %s/%s: %+v", namespace, name, err)
+	}
+
+	err = wait.PollUntilContextTimeout(ctx, i.pollInterval(), timeout, true, func(ctx context.Context) (bool, error) {
+		_, err := i.kubeClient().CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		return k8sErrors.IsNotFound(err), nil
+	})
+	if err != nil {
+		return fmt.Errorf("secret %s/%s was not deleted in %v: %+v", namespace, name, timeout, err)
+	}
+
+	return nil
+}
+
+// WaitForNamespaceServiceAccount waits until the default service account is provisioned in the namespace
+func (i *InstallAppStudio) WaitForNamespaceServiceAccount(ctx context.Context, namespace string, timeout time.Duration) error {
+	if err := i.checkKubeClient(); err != nil {
+		return err
+	}
+	err := wait.PollUntilContextTimeout(ctx, i.pollInterval(), timeout, true, func(ctx context.Context) (bool, error) {
+		_, err := i.kubeClient().CoreV1().ServiceAccounts(namespace).Get(ctx, "default", metav1.GetOptions{})
+		if err != nil {
+			if !k8sErrors.IsNotFound(err) {
+				klog.Warningf("failed to get default service account in namespace %s: %+v", namespace, err)
+			}
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("default service account was not created in namespace %s in %v: %+v", namespace, timeout, err)
+	}
+
+	return nil
+}
+
+// WaitForSecretLinkedToSA waits until the secret is listed in the image pull secrets of the default service account of the namespace
+func (i *InstallAppStudio) WaitForSecretLinkedToSA(ctx context.Context, namespace, secretName string, timeout time.Duration) error {
+	if err := i.checkKubeClient(); err != nil {
+		return err
+	}
+	err := wait.PollUntilContextTimeout(ctx, i.pollInterval(), timeout, true, func(ctx context.Context) (bool, error) {
+		sa, err := i.kubeClient().CoreV1().ServiceAccounts(namespace).Get(ctx, "default", metav1.GetOptions{})
+		if err != nil {
+			if !k8sErrors.IsNotFound(err) {
+				klog.Warningf("failed to get default service account in namespace %s: %+v", namespace, err)
+			}
+			return false, nil
+		}
+		for _, pullSecret := range sa.ImagePullSecrets {
+			if pullSecret.Name == secretName {
+				return true, nil
+			}
+		}
+		klog.Infof("secret %s is not linked to the default service account in namespace %s yet", secretName, namespace)
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("secret %s was not linked to the default service account in namespace %s in %v: %+v", secretName, namespace, timeout, err)
+	}
+
+	return nil
+}
+
+// WaitForE2ENamespaceReady waits until E2EApplicationsNamespace exists and is active, its default service account is
+// provisioned and, when E2ENamespacePullSecret is set, the pull secret is linked to the service account.
+// The timeout applies to all the steps together.
+func (i *InstallAppStudio) WaitForE2ENamespaceReady(ctx context.Context, timeout time.Duration) error {
+	if err := i.checkKubeClient(); err != nil {
+		return err
+	}
+	namespace := i.e2eApplicationsNamespace()
+	if namespace == "" {
+		return fmt.Errorf("E2EApplicationsNamespace is not set")
+	}
+	deadline := time.Now().Add(timeout)
+
+	err := wait.PollUntilContextTimeout(ctx, i.pollInterval(), timeout, true, func(ctx context.Context) (bool, error) {
+		ns, err := i.kubeClient().CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+		if err != nil {
+			if !k8sErrors.IsNotFound(err) {
+				klog.Warningf("failed to get namespace %s: %+v", namespace, err)
+			}
+			return false, nil
+		}
+		return ns.Status.Phase != corev1.NamespaceTerminating, nil
+	})
+	if err != nil {
+		return fmt.Errorf("namespace %s did not become active in %v: %+v", namespace, timeout, err)
+	}
+
+	if err := i.WaitForNamespaceServiceAccount(ctx, namespace, time.Until(deadline)); err != nil {
+		return err
+	}
+	if i.E2ENamespacePullSecret == "" {
+		return nil
+	}
+	return i.WaitForSecretLinkedToSA(ctx, namespace, i.E2ENamespacePullSecret, time.Until(deadline))
+}
+
+// ClusterServiceVersion list kind of OLM, used through unstructured objects since OLM API types are not a dependency
+var csvListGVK = schema.GroupVersionKind{Group: "operators.coreos.com", Version: "v1alpha1", Kind: "ClusterServiceVersionList"}
+
+// WaitForCSVSucceeded waits until there is at least one ClusterServiceVersion in the namespace for each of the name prefixes
+// and all the matching ClusterServiceVersions reached the Succeeded phase
+func (i *InstallAppStudio) WaitForCSVSucceeded(ctx context.Context, namespace string, csvPrefixes []string, timeout time.Duration) error {
+	if err := i.checkKubeRest(); err != nil {
+		return err
+	}
+	var pending []string
+	err := wait.PollUntilContextTimeout(ctx, i.pollInterval(), timeout, true, func(ctx context.Context) (bool, error) {
+		csvs := &unstructured.UnstructuredList{}
+		csvs.SetGroupVersionKind(csvListGVK)
+		if err := i.kubeRest().List(ctx, csvs, crclient.InNamespace(namespace)); err != nil {
+			klog.Warningf("failed to list cluster service versions in namespace %s: %+v", namespace, err)
+			return false, nil
+		}
+
+		pending = pendingCSVs(csvs.Items, csvPrefixes)
+		if len(pending) > 0 {
+			klog.Infof("waiting for cluster service versions in namespace %s: %s", namespace, strings.Join(pending, ", "))
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("cluster service versions in namespace %s did not succeed in %v (pending: %s): %+v", namespace, timeout, strings.Join(pending, ", "), err)
+	}
+
+	return nil
+}
+
+// pendingCSVs returns the ClusterServiceVersions matching the prefixes which are not in the Succeeded phase, with their phase,
+// and the prefixes with no matching ClusterServiceVersion yet
+func pendingCSVs(csvs []unstructured.Unstructured, prefixes []string) []string {
+	var pending []string
+	for _, prefix := range prefixes {
+		found := false
+		for _, csv := range csvs {
+			if !strings.HasPrefix(csv.GetName(), prefix) {
+				continue
+			}
+			found = true
+			phase, _, _ := unstructured.NestedString(csv.Object, "status", "phase")
+			if phase != "Succeeded" {
+				if phase == "" {
+					phase = "Unknown"
+				}
+				pending = append(pending, fmt.Sprintf("%s (%s)", csv.GetName(), phase))
+			}
+		}
+		if !found {
+			pending = append(pending, fmt.Sprintf("%s* (not found)", prefix))
+		}
+	}
+	sort.Strings(pending)
+
+	return pending
+}
+
+// CustomResourceDefinition kinds, used through unstructured objects like the ClusterServiceVersions
+var (
+	crdGVK     = schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}
+	crdListGVK = schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinitionList"}
+)
+
+// WaitForCRDsEstablished waits until all the CustomResourceDefinitions are established. All of them are checked
+// on every poll, so the total wait is driven by the slowest one: listed with a single request, or fetched by up to
+// CRDWaitConcurrency parallel workers when it's set.
+func (i *InstallAppStudio) WaitForCRDsEstablished(ctx context.Context, names []string, timeout time.Duration) error {
+	if err := i.checkKubeRest(); err != nil {
+		return err
+	}
+	var pending []string
+	err := wait.PollUntilContextTimeout(ctx, i.pollInterval(), timeout, true, func(ctx context.Context) (bool, error) {
+		crds, err := i.getCRDs(ctx, names)
+		if err != nil {
+			klog.Warningf("failed to get custom resource definitions: %+v", err)
+			return false, nil
+		}
+
+		pending = pendingCRDs(crds, names)
+		if len(pending) > 0 {
+			klog.Infof("waiting for custom resource definitions: %s", strings.Join(pending, ", "))
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("custom resource definitions were not established in %v (pending: %s): %+v", timeout, strings.Join(pending, ", "), err)
+	}
+
+	return nil
+}
+
+// getCRDs returns the existing CustomResourceDefinitions among names. They're listed with a single request unless
+// CRDWaitConcurrency is set, in which case each of them is fetched by up to CRDWaitConcurrency parallel workers.
+func (i *InstallAppStudio) getCRDs(ctx context.Context, names []string) ([]unstructured.Unstructured, error) {
+	if i.CRDWaitConcurrency < 1 {
+		crds := &unstructured.UnstructuredList{}
+		crds.SetGroupVersionKind(crdListGVK)
+		if err := i.kubeRest().List(ctx, crds); err != nil {
+			return nil, err
+		}
+		return crds.Items, nil
+	}
+
+	crds := make([]*unstructured.Unstructured, len(names))
+	results := make([]error, len(names))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < i.CRDWaitConcurrency && w < len(names); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				crd := &unstructured.Unstructured{}
+				crd.SetGroupVersionKind(crdGVK)
+				err := i.kubeRest().Get(ctx, types.NamespacedName{Name: names[index]}, crd)
+				if err == nil {
+					crds[index] = crd
+				} else if !k8sErrors.IsNotFound(err) {
+					results[index] = fmt.Errorf("failed to get custom resource definition %s: %w", names[index], err)
+				}
+			}
+		}()
+	}
+	for index := range names {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	var found []unstructured.Unstructured
+	for index, crd := range crds {
+		if results[index] != nil {
+			return nil, results[index]
+		}
+		if crd != nil {
+			found = append(found, *crd)
+		}
+	}
+	return found, nil
+}
+
+// pendingCRDs returns the names of the CustomResourceDefinitions which are missing or not established yet
+func pendingCRDs(crds []unstructured.Unstructured, names []string) []string {
+	established := map[string]bool{}
+	for _, crd := range crds {
+		conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+		for _, c := range conditions {
+			condition, ok := c.(map[string]interface{})
+			if ok && condition["type"] == "Established" && condition["status"] == "True" {
+				established[crd.GetName()] = true
+			}
+		}
+	}
+
+	var pending []string
+	for _, name := range names {
+		if !established[name] {
+			pending = append(pending, name)
+		}
+	}
+	sort.Strings(pending)
+
+	return pending
+}
+
+// WaitForRouteAdmitted waits until the route is admitted by at least one of its routers
+func (i *InstallAppStudio) WaitForRouteAdmitted(ctx context.Context, namespace, routeName string, timeout time.Duration) error {
+	if err := i.checkKubeRest(); err != nil {
+		return err
+	}
+	err := wait.PollUntilContextTimeout(ctx, i.pollInterval(), timeout, true, func(ctx context.Context) (bool, error) {
+		route := &routev1.Route{}
+		if err := i.kubeRest().Get(ctx, types.NamespacedName{Namespace: namespace, Name: routeName}, route); err != nil {
+			klog.Warningf("failed to get route %s/%s: %+v", namespace, routeName, err)
+			return false, nil
+		}
+		for _, ingress := range route.Status.Ingress {
+			for _, condition := range ingress.Conditions {
+				if condition.Type == routev1.RouteAdmitted && condition.Status == corev1.ConditionTrue {
+					return true, nil
+				}
+			}
+		}
+		klog.Infof("route %s/%s is not admitted yet", namespace, routeName)
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("route %s/%s was not admitted in %v: %+v", namespace, routeName, timeout, err)
+	}
+
+	return nil
+}
+
+// WaitForHTTPHealthy polls the URL until it responds with HealthyHTTPStatus, 200 by default. Each request is limited by HTTPTimeout
+func (i *InstallAppStudio) WaitForHTTPHealthy(ctx context.Context, url string, timeout time.Duration) error {
+	expected := i.HealthyHTTPStatus
+	if expected == 0 {
+		expected = http.StatusOK
+	}
+	client := i.httpClient()
+	err := wait.PollUntilContextTimeout(ctx, i.pollInterval(), timeout, true, func(ctx context.Context) (bool, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return false, fmt.Errorf("invalid health endpoint %s: %+v", url, err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			klog.Warningf("health endpoint %s is not reachable: %+v", url, err)
+			return false, nil
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			klog.Infof("health endpoint %s responded with %d, waiting for %d", url, resp.StatusCode, expected)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s was not healthy in %v: %+v", url, timeout, err)
+	}
+
+	return nil
+}
+
+// WaitForSPIOAuthRouteAdmitted waits until the route of the SPI OAuth service is admitted
+func (i *InstallAppStudio) WaitForSPIOAuthRouteAdmitted(ctx context.Context, timeout time.Duration) error {
+	namespace, name := i.spiOAuthRoute()
+	return i.WaitForRouteAdmitted(ctx, namespace, name, timeout)
+}
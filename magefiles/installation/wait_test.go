@@ -0,0 +1,475 @@
+package installation
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func init() {
+	defaultPollInterval = 10 * time.Millisecond
+}
+
+func terminatingNamespace(name string) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceTerminating},
+	}
+}
+
+func TestWaitForNamespaceTerminated(t *testing.T) {
+	clientset := fake.NewSimpleClientset(terminatingNamespace("test"))
+	gets := 0
+	clientset.PrependReactor("get", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		if gets > 3 {
+			return true, nil, k8sErrors.NewNotFound(corev1.Resource("namespaces"), "test")
+		}
+		return false, nil, nil
+	})
+	i := &InstallAppStudio{clientset: clientset}
+
+	assert.NoError(t, i.WaitForNamespaceTerminated(context.Background(), "test", time.Second))
+	assert.Equal(t, 4, gets)
+}
+
+func TestWaitForNamespaceTerminatedTimeout(t *testing.T) {
+	i := &InstallAppStudio{clientset: fake.NewSimpleClientset(terminatingNamespace("test"))}
+
+	err := i.WaitForNamespaceTerminated(context.Background(), "test", 100*time.Millisecond)
+	assert.ErrorContains(t, err, "namespace test was not terminated")
+}
+
+func restartedDeployment(ready bool) *appsv1.Deployment {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: "test", Generation: 2},
+		Status:     appsv1.DeploymentStatus{ObservedGeneration: 1, UpdatedReplicas: 0, AvailableReplicas: 1},
+	}
+	if ready {
+		deployment.Status = appsv1.DeploymentStatus{ObservedGeneration: 2, UpdatedReplicas: 1, AvailableReplicas: 1}
+	}
+	return deployment
+}
+
+func TestRestartDeploymentWaitsForReadiness(t *testing.T) {
+	clientset := fake.NewSimpleClientset(restartedDeployment(false))
+	gets := 0
+	clientset.PrependReactor("get", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		return gets > 2, restartedDeployment(true), nil
+	})
+	i := &InstallAppStudio{clientset: clientset, RestartReadinessTimeout: time.Second}
+
+	assert.NoError(t, i.restartDeployment(context.Background(), "test", "service"))
+	assert.Equal(t, 3, gets)
+}
+
+func TestRestartDeploymentReadinessTimeout(t *testing.T) {
+	i := &InstallAppStudio{clientset: fake.NewSimpleClientset(restartedDeployment(false)), RestartReadinessTimeout: 100 * time.Millisecond}
+
+	err := i.restartDeployment(context.Background(), "test", "service")
+	assert.ErrorContains(t, err, "deployment test/service did not become ready")
+}
+
+func TestWaitForDeploymentReady(t *testing.T) {
+	clientset := fake.NewSimpleClientset(restartedDeployment(false))
+	gets := 0
+	clientset.PrependReactor("get", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		return gets > 2, restartedDeployment(true), nil
+	})
+	i := &InstallAppStudio{clientset: clientset}
+
+	assert.NoError(t, i.WaitForDeploymentReady(context.Background(), "test", "service", time.Second))
+	assert.Equal(t, 3, gets)
+}
+
+func TestWaitForDeploymentReadyTimeout(t *testing.T) {
+	replicas := int32(3)
+	deployment := restartedDeployment(true)
+	deployment.Spec.Replicas = &replicas
+	i := &InstallAppStudio{clientset: fake.NewSimpleClientset(deployment)}
+
+	err := i.WaitForDeploymentReady(context.Background(), "test", "service", 100*time.Millisecond)
+	assert.ErrorContains(t, err, "deployment test/service did not become ready in 100ms")
+}
+
+func TestWaitForDeploymentReadyPollInterval(t *testing.T) {
+	replicas := int32(3)
+	deployment := restartedDeployment(true)
+	deployment.Spec.Replicas = &replicas
+	clientset := fake.NewSimpleClientset(deployment)
+	gets := 0
+	clientset.PrependReactor("get", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		return false, nil, nil
+	})
+	i := &InstallAppStudio{clientset: clientset, PollInterval: 100 * time.Millisecond}
+
+	assert.Error(t, i.WaitForDeploymentReady(context.Background(), "test", "service", 450*time.Millisecond))
+	// Polled immediately and then every 100ms, the default interval of the tests would poll ~45 times
+	assert.GreaterOrEqual(t, gets, 4)
+	assert.LessOrEqual(t, gets, 6)
+}
+
+func TestWaitForE2ENamespaceReady(t *testing.T) {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "e2e-apps"}}
+	sa := &corev1.ServiceAccount{
+		ObjectMeta:       metav1.ObjectMeta{Name: "default", Namespace: "e2e-apps"},
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "quay-pull"}},
+	}
+	i := &InstallAppStudio{clientset: fake.NewSimpleClientset(namespace, sa), E2EApplicationsNamespace: "e2e-apps", E2ENamespacePullSecret: "quay-pull"}
+	assert.NoError(t, i.WaitForE2ENamespaceReady(context.Background(), time.Second))
+
+	// The pull secret link is only awaited when E2ENamespacePullSecret is set
+	unlinked := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "e2e-apps"}}
+	i = &InstallAppStudio{clientset: fake.NewSimpleClientset(namespace, unlinked), E2EApplicationsNamespace: "e2e-apps"}
+	assert.NoError(t, i.WaitForE2ENamespaceReady(context.Background(), time.Second))
+	i.E2ENamespacePullSecret = "quay-pull"
+	assert.ErrorContains(t, i.WaitForE2ENamespaceReady(context.Background(), 100*time.Millisecond), "secret quay-pull was not linked to the default service account in namespace e2e-apps")
+
+	i = &InstallAppStudio{clientset: fake.NewSimpleClientset(namespace), E2EApplicationsNamespace: "e2e-apps"}
+	assert.ErrorContains(t, i.WaitForE2ENamespaceReady(context.Background(), 100*time.Millisecond), "default service account was not created in namespace e2e-apps")
+
+	i = &InstallAppStudio{clientset: fake.NewSimpleClientset(terminatingNamespace("e2e-apps"), sa), E2EApplicationsNamespace: "e2e-apps"}
+	assert.ErrorContains(t, i.WaitForE2ENamespaceReady(context.Background(), 100*time.Millisecond), "namespace e2e-apps did not become active in 100ms")
+
+	i.E2EApplicationsNamespace = ""
+	assert.ErrorContains(t, i.WaitForE2ENamespaceReady(context.Background(), time.Second), "E2EApplicationsNamespace is not set")
+}
+
+func TestWaitForNamespaceServiceAccount(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	gets := 0
+	clientset.PrependReactor("get", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		if gets > 2 {
+			return true, &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "test"}}, nil
+		}
+		return false, nil, nil
+	})
+	i := &InstallAppStudio{clientset: clientset}
+
+	assert.NoError(t, i.WaitForNamespaceServiceAccount(context.Background(), "test", time.Second))
+	assert.Equal(t, 3, gets)
+}
+
+func TestWaitForNamespaceServiceAccountTimeout(t *testing.T) {
+	i := &InstallAppStudio{clientset: fake.NewSimpleClientset()}
+
+	err := i.WaitForNamespaceServiceAccount(context.Background(), "test", 100*time.Millisecond)
+	assert.ErrorContains(t, err, "default service account was not created in namespace test")
+}
+
+func TestWaitForSecretLinkedToSA(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.ServiceAccount{
+		ObjectMeta:       metav1.ObjectMeta{Name: "default", Namespace: "test"},
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "other"}},
+	})
+	gets := 0
+	clientset.PrependReactor("get", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		if gets > 2 {
+			return true, &corev1.ServiceAccount{
+				ObjectMeta:       metav1.ObjectMeta{Name: "default", Namespace: "test"},
+				ImagePullSecrets: []corev1.LocalObjectReference{{Name: "other"}, {Name: "quay-repository"}},
+			}, nil
+		}
+		return false, nil, nil
+	})
+	i := &InstallAppStudio{clientset: clientset}
+
+	assert.NoError(t, i.WaitForSecretLinkedToSA(context.Background(), "test", "quay-repository", time.Second))
+	assert.Equal(t, 3, gets)
+}
+
+func TestWaitForSecretLinkedToSATimeout(t *testing.T) {
+	i := &InstallAppStudio{clientset: fake.NewSimpleClientset(&corev1.ServiceAccount{
+		ObjectMeta:       metav1.ObjectMeta{Name: "default", Namespace: "test"},
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "other"}},
+	})}
+
+	err := i.WaitForSecretLinkedToSA(context.Background(), "test", "quay-repository", 100*time.Millisecond)
+	assert.ErrorContains(t, err, "secret quay-repository was not linked to the default service account in namespace test")
+}
+
+func testCSV(name, phase string) *unstructured.Unstructured {
+	csv := &unstructured.Unstructured{}
+	csv.SetGroupVersionKind(schema.GroupVersionKind{Group: "operators.coreos.com", Version: "v1alpha1", Kind: "ClusterServiceVersion"})
+	csv.SetNamespace("openshift-operators")
+	csv.SetName(name)
+	if phase != "" {
+		csv.Object["status"] = map[string]interface{}{"phase": phase}
+	}
+	return csv
+}
+
+func TestWaitForCSVSucceeded(t *testing.T) {
+	lists := 0
+	client := crfake.NewClientBuilder().
+		WithObjects(testCSV("openshift-pipelines-operator-rh.v1.14.0", "Installing"), testCSV("other-operator.v1.0.0", "Failed")).
+		WithInterceptorFuncs(interceptor.Funcs{
+			List: func(ctx context.Context, client crclient.WithWatch, list crclient.ObjectList, opts ...crclient.ListOption) error {
+				lists++
+				if lists == 3 {
+					csv := testCSV("openshift-pipelines-operator-rh.v1.14.0", "")
+					if err := client.Get(ctx, crclient.ObjectKeyFromObject(csv), csv); err != nil {
+						return err
+					}
+					if err := unstructured.SetNestedField(csv.Object, "Succeeded", "status", "phase"); err != nil {
+						return err
+					}
+					if err := client.Update(ctx, csv); err != nil {
+						return err
+					}
+					if err := client.Create(ctx, testCSV("openshift-gitops-operator.v1.11.0", "Succeeded")); err != nil {
+						return err
+					}
+				}
+				return client.List(ctx, list, opts...)
+			},
+		}).Build()
+	i := &InstallAppStudio{crClient: client}
+
+	err := i.WaitForCSVSucceeded(context.Background(), "openshift-operators", []string{"openshift-pipelines-operator", "openshift-gitops-operator"}, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, lists)
+}
+
+func TestWaitForCSVSucceededTimeout(t *testing.T) {
+	client := crfake.NewClientBuilder().WithObjects(testCSV("openshift-pipelines-operator-rh.v1.14.0", "Installing")).Build()
+	i := &InstallAppStudio{crClient: client}
+
+	err := i.WaitForCSVSucceeded(context.Background(), "openshift-operators", []string{"openshift-pipelines-operator", "openshift-gitops-operator"}, 100*time.Millisecond)
+	assert.ErrorContains(t, err, "openshift-gitops-operator* (not found)")
+	assert.ErrorContains(t, err, "openshift-pipelines-operator-rh.v1.14.0 (Installing)")
+}
+
+// readyAfter returns an interceptor which updates the objects to their ready state once their delay since the first list elapsed
+func readyAfter(delays map[string]time.Duration, ready func(name string) crclient.Object) interceptor.Funcs {
+	var start time.Time
+	return interceptor.Funcs{
+		List: func(ctx context.Context, client crclient.WithWatch, list crclient.ObjectList, opts ...crclient.ListOption) error {
+			if start.IsZero() {
+				start = time.Now()
+			}
+			for name, delay := range delays {
+				if time.Since(start) < delay {
+					continue
+				}
+				if err := client.Create(ctx, ready(name)); err != nil {
+					return err
+				}
+				delete(delays, name)
+			}
+			return client.List(ctx, list, opts...)
+		},
+	}
+}
+
+func TestWaitForCSVSucceededPollsAllTargets(t *testing.T) {
+	client := crfake.NewClientBuilder().WithInterceptorFuncs(readyAfter(map[string]time.Duration{
+		"first-operator.v1.0.0":  100 * time.Millisecond,
+		"second-operator.v1.0.0": 200 * time.Millisecond,
+		"third-operator.v1.0.0":  300 * time.Millisecond,
+	}, func(name string) crclient.Object { return testCSV(name, "Succeeded") })).Build()
+	i := &InstallAppStudio{crClient: client}
+
+	start := time.Now()
+	err := i.WaitForCSVSucceeded(context.Background(), "openshift-operators", []string{"first-operator", "second-operator", "third-operator"}, 2*time.Second)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+	assert.Less(t, time.Since(start), 600*time.Millisecond)
+}
+
+func testCRD(name string, established bool) *unstructured.Unstructured {
+	crd := &unstructured.Unstructured{}
+	crd.SetGroupVersionKind(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"})
+	crd.SetName(name)
+	status := "False"
+	if established {
+		status = "True"
+	}
+	crd.Object["status"] = map[string]interface{}{"conditions": []interface{}{
+		map[string]interface{}{"type": "NamesAccepted", "status": "True"},
+		map[string]interface{}{"type": "Established", "status": status},
+	}}
+	return crd
+}
+
+func TestWaitForCRDsEstablished(t *testing.T) {
+	client := crfake.NewClientBuilder().WithInterceptorFuncs(readyAfter(map[string]time.Duration{
+		"applications.argoproj.io":        100 * time.Millisecond,
+		"pipelineruns.tekton.dev":         200 * time.Millisecond,
+		"components.appstudio.redhat.com": 300 * time.Millisecond,
+	}, func(name string) crclient.Object { return testCRD(name, true) })).Build()
+	i := &InstallAppStudio{crClient: client}
+
+	start := time.Now()
+	err := i.WaitForCRDsEstablished(context.Background(), []string{"applications.argoproj.io", "pipelineruns.tekton.dev", "components.appstudio.redhat.com"}, 2*time.Second)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+	assert.Less(t, time.Since(start), 600*time.Millisecond)
+}
+
+func TestWaitForCRDsEstablishedTimeout(t *testing.T) {
+	client := crfake.NewClientBuilder().WithObjects(testCRD("applications.argoproj.io", true), testCRD("pipelineruns.tekton.dev", false)).Build()
+	i := &InstallAppStudio{crClient: client}
+
+	err := i.WaitForCRDsEstablished(context.Background(), []string{"applications.argoproj.io", "pipelineruns.tekton.dev", "components.appstudio.redhat.com"}, 100*time.Millisecond)
+	assert.ErrorContains(t, err, "pending: components.appstudio.redhat.com, pipelineruns.tekton.dev)")
+}
+
+func TestWaitForCRDsEstablishedWithConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight, gets := 0, 0, 0
+	client := crfake.NewClientBuilder().WithObjects(
+		testCRD("applications.argoproj.io", true), testCRD("pipelineruns.tekton.dev", true), testCRD("components.appstudio.redhat.com", true),
+	).WithInterceptorFuncs(interceptor.Funcs{
+		Get: func(ctx context.Context, client crclient.WithWatch, key crclient.ObjectKey, obj crclient.Object, opts ...crclient.GetOption) error {
+			mu.Lock()
+			inFlight++
+			gets++
+			maxInFlight = max(maxInFlight, inFlight)
+			mu.Unlock()
+			time.Sleep(50 * time.Millisecond)
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			return client.Get(ctx, key, obj, opts...)
+		},
+		List: func(ctx context.Context, client crclient.WithWatch, list crclient.ObjectList, opts ...crclient.ListOption) error {
+			t.Error("the custom resource definitions are fetched one by one")
+			return client.List(ctx, list, opts...)
+		},
+	}).Build()
+	i := &InstallAppStudio{crClient: client, CRDWaitConcurrency: 2}
+
+	assert.NoError(t, i.WaitForCRDsEstablished(context.Background(), []string{"applications.argoproj.io", "pipelineruns.tekton.dev", "components.appstudio.redhat.com"}, 2*time.Second))
+	assert.Equal(t, 3, gets)
+	assert.Equal(t, 2, maxInFlight)
+}
+
+func TestWaitForCRDsEstablishedWithConcurrencyTimeout(t *testing.T) {
+	client := crfake.NewClientBuilder().WithObjects(testCRD("applications.argoproj.io", true), testCRD("pipelineruns.tekton.dev", false)).Build()
+	i := &InstallAppStudio{crClient: client, CRDWaitConcurrency: 4}
+
+	err := i.WaitForCRDsEstablished(context.Background(), []string{"applications.argoproj.io", "pipelineruns.tekton.dev", "components.appstudio.redhat.com"}, 100*time.Millisecond)
+	assert.ErrorContains(t, err, "pending: components.appstudio.redhat.com, pipelineruns.tekton.dev)")
+}
+
+func testRoute(admitted corev1.ConditionStatus) *routev1.Route {
+	route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Name: "spi-oauth-route", Namespace: "spi-system"}}
+	if admitted != "" {
+		route.Status.Ingress = []routev1.RouteIngress{{
+			RouterName: "default",
+			Conditions: []routev1.RouteIngressCondition{{Type: routev1.RouteAdmitted, Status: admitted}},
+		}}
+	}
+	return route
+}
+
+func routeScheme(t *testing.T) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, routev1.AddToScheme(scheme))
+	return scheme
+}
+
+func TestWaitForRouteAdmitted(t *testing.T) {
+	gets := 0
+	client := crfake.NewClientBuilder().WithScheme(routeScheme(t)).WithObjects(testRoute("")).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(ctx context.Context, client crclient.WithWatch, key crclient.ObjectKey, obj crclient.Object, opts ...crclient.GetOption) error {
+				gets++
+				if gets == 3 {
+					route := testRoute(corev1.ConditionTrue)
+					current := &routev1.Route{}
+					if err := client.Get(ctx, key, current); err != nil {
+						return err
+					}
+					route.ResourceVersion = current.ResourceVersion
+					if err := client.Status().Update(ctx, route); err != nil {
+						return err
+					}
+				}
+				return client.Get(ctx, key, obj, opts...)
+			},
+		}).WithStatusSubresource(&routev1.Route{}).Build()
+	i := &InstallAppStudio{crClient: client}
+
+	assert.NoError(t, i.WaitForSPIOAuthRouteAdmitted(context.Background(), time.Second))
+	assert.Equal(t, 3, gets)
+}
+
+func TestWaitForRouteAdmittedTimeout(t *testing.T) {
+	client := crfake.NewClientBuilder().WithScheme(routeScheme(t)).WithObjects(testRoute(corev1.ConditionFalse)).Build()
+	i := &InstallAppStudio{crClient: client, SPIOAuthRouteName: "spi-oauth-route"}
+
+	err := i.WaitForRouteAdmitted(context.Background(), "spi-system", "spi-oauth-route", 100*time.Millisecond)
+	assert.ErrorContains(t, err, "route spi-system/spi-oauth-route was not admitted in 100ms")
+	assert.ErrorContains(t, i.WaitForRouteAdmitted(context.Background(), "spi-system", "missing", 100*time.Millisecond), "route spi-system/missing was not admitted")
+}
+
+// healthServer responds with 503 to the first unhealthyRequests requests and with 200 afterwards
+func healthServer(t *testing.T, unhealthyRequests int32) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= unhealthyRequests {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestWaitForHTTPHealthy(t *testing.T) {
+	server, requests := healthServer(t, 3)
+
+	assert.NoError(t, (&InstallAppStudio{}).WaitForHTTPHealthy(context.Background(), server.URL+"/healthz", time.Second))
+	assert.Equal(t, int32(4), requests.Load())
+}
+
+func TestWaitForHTTPHealthyExpectedStatus(t *testing.T) {
+	server, _ := healthServer(t, 1000)
+	i := &InstallAppStudio{HealthyHTTPStatus: http.StatusServiceUnavailable}
+	assert.NoError(t, i.WaitForHTTPHealthy(context.Background(), server.URL, time.Second))
+
+	i.HealthyHTTPStatus = 0
+	assert.ErrorContains(t, i.WaitForHTTPHealthy(context.Background(), server.URL, 100*time.Millisecond), server.URL+" was not healthy in 100ms")
+}
+
+func TestWaitForHTTPHealthyRequestTimeout(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only the first request hangs longer than HTTPTimeout
+		if requests.Add(1) == 1 {
+			time.Sleep(200 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	i := &InstallAppStudio{HTTPTimeout: 50 * time.Millisecond}
+	assert.NoError(t, i.WaitForHTTPHealthy(context.Background(), server.URL, time.Second))
+	assert.Equal(t, int32(2), requests.Load())
+}
@@ -168,12 +168,18 @@ func NewAdminKubernetesClient() (*CustomClient, error) {
 	if err != nil {
 		return nil, err
 	}
-	clientSets, err := createClientSetsFromConfig(adminKubeconfig)
+
+	return NewKubernetesClientFromConfig(adminKubeconfig)
+}
+
+// Creates a kubernetes client from the given rest config
+func NewKubernetesClientFromConfig(cfg *rest.Config) (*CustomClient, error) {
+	clientSets, err := createClientSetsFromConfig(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	crClient, err := crclient.New(adminKubeconfig, crclient.Options{
+	crClient, err := crclient.New(cfg, crclient.Options{
 		Scheme: scheme,
 	})
 